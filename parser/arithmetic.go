@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"piwasm/quintir"
+)
+
+// quint integers are unbounded, while the plain rust operators panic on overflow in debug builds and wrap in
+// release builds, which is what contracts are deployed as. --arithmetic chooses how the integer operators of the
+// model are translated instead:
+//   - plain: `a + b` on u64
+//   - checked: `a.checked_add(b).ok_or(StdError::overflow(...))?` on u64, failing the entry point on overflow
+//   - saturating: `a.saturating_add(b)` on u64, which stops at the bounds
+//   - uint128, uint256: cosmwasm's Uint128 or Uint256, with their checked operators, `a.checked_add(b)?`
+//
+// with checked operators, the functions that use them, or call functions that do, return
+// Result<T, cosmwasm_std::StdError> to propagate the error. where there is no result to propagate it with,
+// like in the tests, the error panics instead.
+var arithmetics = []string{"plain", "checked", "saturating", "uint128", "uint256"}
+
+// validArithmetic checks the value of --arithmetic
+func validArithmetic(arithmetic string) error {
+	if !contains(arithmetics, arithmetic) {
+		return fmt.Errorf("unknown arithmetic %q, expected one of %s", arithmetic, strings.Join(arithmetics, ", "))
+	}
+	return nil
+}
+
+// the rust names of the operations, as in checked_add and OverflowOperation::Add
+var arithmeticOperations = map[string]string{
+	"iadd": "add",
+	"isub": "sub",
+	"imul": "mul",
+	"idiv": "div",
+	"imod": "rem",
+	"ipow": "pow",
+}
+
+// bigUint returns the name of the cosmwasm integer type that the arithmetic uses, or "" for u64
+func (t *translator) bigUint() string {
+	switch t.arithmetic {
+	case "uint128":
+		return "Uint128"
+	case "uint256":
+		return "Uint256"
+	}
+	return ""
+}
+
+// checksArithmetic checks if the integer operators can fail
+func (t *translator) checksArithmetic() bool {
+	return t.arithmetic == "checked" || t.bigUint() != ""
+}
+
+// intType returns the rust type of quint integers, where their width is not inferred
+func (t *translator) intType() Type {
+	if name := t.bigUint(); name != "" {
+		return &BigUintType{Name: name}
+	}
+	return widthType(t.intDefault)
+}
+
+// intLiteral returns the rust literal of a quint integer
+func (t *translator) intLiteral(value *big.Int) Expr {
+	if name := t.bigUint(); name != "" {
+		return &BigUintLiteral{TypeName: name, Value: value}
+	}
+	switch t.intDefault {
+	case "i64", "i128":
+		return &SignedLiteral{TypeName: t.intDefault, Value: value}
+	case "Uint128":
+		return &BigUintLiteral{TypeName: t.intDefault, Value: value}
+	}
+	return &UInt64Literal{Value: value.Uint64()}
+}
+
+// resolveArithmetic translates an integer operator of the model, like iadd, with the arithmetic
+func (t *translator) resolveArithmetic(e *quintir.App) Expr {
+	operation := arithmeticOperations[e.Opcode]
+	left := t.resolveExpr(e.Args[0], t.intType())
+	var right Expr
+	if operation == "pow" {
+		right = t.resolveExponent(e.Args[1])
+	} else {
+		right = t.resolveExpr(e.Args[1], t.intType())
+	}
+
+	switch {
+	case t.checksArithmetic():
+		checked := &MethodCall{Value: left, MethodName: "checked_" + operation, Arguments: []Expr{right}}
+		if t.bigUint() != "" {
+			// the cosmwasm integers already return errors, which convert into StdError
+			return t.propagate(checked)
+		}
+		return t.propagate(&MethodCall{Value: checked, MethodName: "ok_or", Arguments: []Expr{arithmeticError(operation)}})
+	case t.arithmetic == "saturating" && operation != "div" && operation != "rem":
+		// there is nothing to saturate to when dividing by zero, which still panics
+		return &MethodCall{Value: left, MethodName: "saturating_" + operation, Arguments: []Expr{right}}
+	case operation == "pow":
+		return &MethodCall{Value: left, MethodName: "pow", Arguments: []Expr{right}}
+	}
+	return &BinaryOp{Op: integerOperators[e.Opcode], Left: left, Right: right}
+}
+
+// resolveExponent translates the exponent of a power into the u32 that rust expects
+func (t *translator) resolveExponent(exponent quintir.Expr) Expr {
+	if t.bigUint() == "" {
+		return tryInto(t.resolveExpr(exponent, t.intType()))
+	}
+	// the cosmwasm integers do not convert into u32, the exponent has to be a literal
+	lit, ok := exponent.(*quintir.IntLit)
+	if !ok || !lit.Value.IsUint64() {
+		t.errorf(exponent, "with --arithmetic %s, the exponents of powers must be integer literals", t.arithmetic)
+		return newTodo()
+	}
+	return tryInto(&UInt64Literal{Value: lit.Value.Uint64()})
+}
+
+// arithmeticError returns the StdError of an operation on u64 that failed
+func arithmeticError(operation string) Expr {
+	if operation == "div" || operation == "rem" {
+		divideByZero := &FunctionCall{FunctionName: "cosmwasm_std::DivideByZeroError::new"}
+		return &FunctionCall{FunctionName: "cosmwasm_std::StdError::divide_by_zero", Arguments: []Expr{divideByZero}}
+	}
+	op := &Variable{VariableName: "cosmwasm_std::OverflowOperation::" + strings.ToUpper(operation[:1]) + operation[1:]}
+	overflow := &FunctionCall{FunctionName: "cosmwasm_std::OverflowError::new", Arguments: []Expr{op}}
+	return &FunctionCall{FunctionName: "cosmwasm_std::StdError::overflow", Arguments: []Expr{overflow}}
+}
+
+// propagate returns the value of a result, returning its error from the function if it can fail,
+// and panicking otherwise
+func (t *translator) propagate(result Expr) Expr {
+	if t.propagates {
+		return &Try{Value: result}
+	}
+	return &MethodCall{Value: result, MethodName: "unwrap"}
+}
+
+// resultType returns the type of functions that can fail and return a value of typ
+func resultType(typ Type) Type {
+	return &TypeCons{Name: "Result", Params: []Type{typ, stdError}}
+}
+
+// stdError is the error of checked arithmetic
+var stdError = &ConstType{Name: "cosmwasm_std::StdError"}
+
+// wrapOk returns the value of a function that can fail as a success. let expressions are printed as statements,
+// so the value of their body is wrapped instead.
+func wrapOk(value Expr) Expr {
+	if let, ok := value.(*Let); ok {
+		let.Body = wrapOk(let.Body)
+		return let
+	}
+	return &FunctionCall{FunctionName: "Ok", Arguments: []Expr{value}}
+}
+
+// closureOk returns the value of a fallible closure as a success. the type of the error is spelled out, since
+// rust cannot infer it through the ? of the closure body and of the iterator chain.
+func closureOk(value Expr) Expr {
+	if let, ok := value.(*Let); ok {
+		let.Body = closureOk(let.Body)
+		return let
+	}
+	return &FunctionCall{FunctionName: "Ok", TypeArgs: []Type{WildcardType, stdError}, Arguments: []Expr{value}}
+}
+
+// findFallible finds the translated defs that can fail with the arithmetic, because they use checked operators
+// or call defs that can fail
+func (t *translator) findFallible() {
+	t.fallible = make(map[int]bool)
+	if !t.checksArithmetic() {
+		return
+	}
+	var defs []*quintir.OpDef
+	for id, def := range t.opDefs {
+		_, overridden := overrides[t.defModules[id]+"::"+def.Name]
+		if def.Qualifier == "puredef" && t.translates(t.defModules[id]) && !overridden {
+			defs = append(defs, def)
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, def := range defs {
+			if !t.fallible[def.ID] && t.canFail(def.Expr) {
+				t.fallible[def.ID] = true
+				changed = true
+			}
+		}
+	}
+}
+
+// canFail checks if expr uses checked operators or calls defs that can fail
+func (t *translator) canFail(expr quintir.Expr) bool {
+	fails := false
+	quintir.Walk(expr, func(expr quintir.Expr) {
+		app, ok := expr.(*quintir.App)
+		if !ok {
+			return
+		}
+		if _, ok := arithmeticOperations[app.Opcode]; ok {
+			fails = true
+		} else if lookup := t.ir.Lookup(app.ID); lookup != nil && t.fallible[lookup.Def.QuintID()] {
+			fails = true
+		}
+	})
+	return fails
+}
+
+// fallibleCall returns the value of a call of def, propagating its error if def can fail
+func (t *translator) fallibleCall(def *quintir.OpDef, call Expr) Expr {
+	if !t.fallible[def.ID] {
+		return call
+	}
+	return t.propagate(call)
+}
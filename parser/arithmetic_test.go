@@ -0,0 +1,143 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"piwasm/quintir"
+)
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		name       string
+		arithmetic string
+		// if the function around the operator returns errors
+		propagates bool
+		opcode     string
+		// the right operand is the literal 2 instead of the variable b
+		literal bool
+		want    string
+		// a part of the problem that is reported, if any
+		err string
+	}{
+		{name: "plain", arithmetic: "plain", opcode: "iadd", want: "a + b"},
+		{name: "plain power", arithmetic: "plain", opcode: "ipow", want: "a.pow(b.try_into().unwrap())"},
+		{
+			name:       "checked",
+			arithmetic: "checked",
+			propagates: true,
+			opcode:     "isub",
+			want:       "a.checked_sub(b).ok_or(cosmwasm_std::StdError::overflow(cosmwasm_std::OverflowError::new(cosmwasm_std::OverflowOperation::Sub)))?",
+		},
+		{
+			name:       "checked division",
+			arithmetic: "checked",
+			propagates: true,
+			opcode:     "idiv",
+			want:       "a.checked_div(b).ok_or(cosmwasm_std::StdError::divide_by_zero(cosmwasm_std::DivideByZeroError::new()))?",
+		},
+		{
+			name:       "checked without a result to propagate the error with",
+			arithmetic: "checked",
+			opcode:     "imul",
+			want:       "a.checked_mul(b).ok_or(cosmwasm_std::StdError::overflow(cosmwasm_std::OverflowError::new(cosmwasm_std::OverflowOperation::Mul))).unwrap()",
+		},
+		{name: "saturating", arithmetic: "saturating", opcode: "isub", want: "a.saturating_sub(b)"},
+		{name: "saturating division", arithmetic: "saturating", opcode: "idiv", want: "a / b"},
+		{
+			name:       "uint128",
+			arithmetic: "uint128",
+			propagates: true,
+			opcode:     "iadd",
+			literal:    true,
+			want:       "a.checked_add(cosmwasm_std::Uint128::new(2))?",
+		},
+		{
+			name:       "uint256 power",
+			arithmetic: "uint256",
+			propagates: true,
+			opcode:     "ipow",
+			literal:    true,
+			want:       "a.checked_pow(2_u64.try_into().unwrap())?",
+		},
+		{
+			name:       "uint128 power of a variable",
+			arithmetic: "uint128",
+			propagates: true,
+			opcode:     "ipow",
+			err:        "with --arithmetic uint128, the exponents of powers must be integer literals",
+		},
+	}
+	integer := &quintir.IntType{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ir := &quintir.Output{}
+			b := newExprBuilder(ir)
+			var right quintir.Expr = b.name("b", integer)
+			if test.literal {
+				right = b.int(2)
+			}
+			tr := newTranslator(ir)
+			tr.arithmetic = test.arithmetic
+			tr.propagates = test.propagates
+			got := rust(tr.resolveExpr(b.app(test.opcode, integer, b.name("a", integer), right), nil))
+			if test.err != "" {
+				if len(tr.diagnostics) != 1 || !strings.Contains(tr.diagnostics[0].Message, test.err) {
+					t.Errorf("got the problems %v, want one containing %q", tr.diagnostics, test.err)
+				}
+				return
+			}
+			if len(tr.diagnostics) > 0 {
+				t.Errorf("got the problems %v", tr.diagnostics)
+			}
+			if got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidArithmetic(t *testing.T) {
+	for _, arithmetic := range arithmetics {
+		if err := validArithmetic(arithmetic); err != nil {
+			t.Errorf("%s: %v", arithmetic, err)
+		}
+	}
+	if err := validArithmetic("wrapping"); err == nil || !strings.Contains(err.Error(), `unknown arithmetic "wrapping"`) {
+		t.Errorf("got error %v for wrapping", err)
+	}
+}
+
+// TestFindFallible checks that the defs with checked operators, and the ones that call them, return errors
+func TestFindFallible(t *testing.T) {
+	integer := &quintir.IntType{}
+	ir := &quintir.Output{}
+	b := newExprBuilder(ir)
+	function := func(name string, body func(x *quintir.Name) quintir.Expr) *quintir.OpDef {
+		param := quintir.LambdaParam{ID: b.id(integer), Name: "x"}
+		lambda := &quintir.Lambda{ID: b.id(nil), Params: []quintir.LambdaParam{param}, Qualifier: "puredef"}
+		lambda.Expr = body(b.name("x", integer))
+		return &quintir.OpDef{ID: b.id(nil), Name: name, Qualifier: "puredef", Expr: lambda}
+	}
+	inc := function("inc", func(x *quintir.Name) quintir.Expr { return b.app("iadd", integer, x, b.int(1)) })
+	twice := function("twice", func(x *quintir.Name) quintir.Expr { return b.call(inc, integer, b.call(inc, integer, x)) })
+	same := function("same", func(x *quintir.Name) quintir.Expr { return x })
+	helper := function("helper", func(x *quintir.Name) quintir.Expr { return b.app("imul", integer, x, x) })
+	ir.Modules = []*quintir.Module{
+		{Name: "bank", Declarations: []quintir.Declaration{inc, twice, same}},
+		{Name: "bank_test", Declarations: []quintir.Declaration{helper}},
+	}
+
+	for _, arithmetic := range []string{"plain", "saturating", "checked", "uint128"} {
+		tr := newTranslator(ir)
+		tr.arithmetic = arithmetic
+		tr.findFallible()
+		checks := tr.checksArithmetic()
+		want := map[*quintir.OpDef]bool{inc: checks, twice: checks, same: false, helper: false}
+		for def, fallible := range want {
+			if tr.fallible[def.ID] != fallible {
+				t.Errorf("%s: got %v for %s, want %v", arithmetic, tr.fallible[def.ID], def.Name, fallible)
+			}
+		}
+	}
+}
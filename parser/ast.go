@@ -1,9 +1,42 @@
 package main
 
+import (
+	"math/big"
+	"strconv"
+
+	"piwasm/quintir"
+)
+
 type AST interface {
 	PrettyPrint(level int) string
 }
 
+// Origin is the quint node an AST node was translated from.
+// it is embedded in every AST node, and is zero for nodes that have no counterpart in the quint model.
+type Origin struct {
+	QuintID int    `json:"quintId"`
+	Module  string `json:"module"`
+	Decl    string `json:"decl"`
+	// the location in the quint source, if the typechecker output contains a source map
+	Loc *quintir.Loc `json:"loc,omitempty"`
+}
+
+func (o *Origin) origin() *Origin {
+	return o
+}
+
+// Describe describes the origin for humans, preferring the source location if it is known
+func (o Origin) Describe() string {
+	if o.Loc != nil {
+		return o.Loc.String()
+	}
+	s := o.Module + "::" + o.Decl
+	if o.QuintID != 0 {
+		s += " (id " + strconv.Itoa(o.QuintID) + ")"
+	}
+	return s
+}
+
 // Types
 type (
 	Type interface {
@@ -11,6 +44,7 @@ type (
 	}
 	TypeCons struct {
 		Type
+		Origin
 		Name   string
 		Params []Type
 	}
@@ -19,45 +53,87 @@ type (
 type (
 	StructType struct {
 		Type
+		Origin
 		Fields []Field
 	}
 
 	UInt64Type struct {
 		Type
+		Origin
+	}
+	// a signed integer, i64 or i128, for the integers that can be negative
+	SignedType struct {
+		Type
+		Origin
+		Name string
+	}
+	// cosmwasm's Uint128 or Uint256, for --arithmetic uint128 and uint256
+	BigUintType struct {
+		Type
+		Origin
+		Name string
 	}
 	StringType struct {
 		Type
+		Origin
 	}
 	BoolType struct {
 		Type
+		Origin
 	}
 	TupleType struct {
 		Type
+		Origin
 		Types []Type
 	}
 	StrType struct {
 		Type
+		Origin
 	}
 	ListType struct {
 		Type
+		Origin
 		ElementType Type
 	}
 	SetType struct {
 		Type
+		Origin
 		ElementType Type
 	}
+	// a type parameter of a generic function
+	TypeVar struct {
+		Type
+		Origin
+		Name string
+	}
+	// the type of an operator parameter, which takes closures
+	FnType struct {
+		Type
+		Origin
+		Params []Type
+		Result Type
+	}
+	// an optional value, from the Option convention of the model
+	OptionType struct {
+		Type
+		Origin
+		ValueType Type
+	}
 	// a reference to a custom type that is already defined
 	ConstType struct {
 		Type
+		Origin
 		Name string
 	}
 	MapType struct {
 		Type
+		Origin
 		Key   Type
 		Value Type
 	}
 	TypeRef struct {
 		Type
+		Origin
 		OfType  Type
 		Mutable bool
 	}
@@ -65,15 +141,24 @@ type (
 
 var WildcardType Type = &ConstType{Name: "_"}
 
+// stands in for types that could not be translated
+var TodoType Type = &ConstType{Name: "Todo"}
+
 type Import struct {
 	AST
+	Origin
 	Path string
 }
 type Program struct {
 	AST
+	Origin
 
-	Imports []Import
-	Decls   []Decl
+	// attributes of the whole file, like allow(unused_imports)
+	InnerAttrs []string
+	Imports    []Import
+	Decls      []Decl
+	// print a `// quint: ...` comment with the origin before every declaration
+	QuintComments bool
 }
 type (
 	Decl interface {
@@ -81,22 +166,38 @@ type (
 	}
 	StructDecl struct {
 		Decl
+		Origin
 		Name   string
 		Fields []Field
 		Attrs  []string
 	}
 	FunctionDecl struct {
 		Decl
-		Name       string
+		Origin
+		Name string
+		// the type parameters of a generic function
+		TypeParams []TypeParam
 		Params     []Param
+		// nil for functions that return nothing
 		ReturnType Type
 		Body       []Stmt
 		Attrs      []string
 	}
 
+	// a module nested in the file, like the test modules
+	ModDecl struct {
+		Decl
+		Origin
+		Name    string
+		Attrs   []string
+		Imports []Import
+		Decls   []Decl
+	}
+
 	// declares a global constant
 	ConstDecl struct {
 		Decl
+		Origin
 		Name  string
 		Type  Type
 		Value Expr
@@ -104,21 +205,54 @@ type (
 
 	ValDecl struct {
 		Decl
+		Origin
 		Name  string
 		Value Expr
 	}
 
 	TypeDecl struct {
 		Decl
+		Origin
 		Name string
 		Type Type
 	}
+
+	EnumDecl struct {
+		Decl
+		Origin
+		Name     string
+		Variants []Variant
+		Attrs    []string
+	}
+
+	// hand-written rust code that is copied into the output as is
+	Verbatim struct {
+		Decl
+		Origin
+		Code string
+	}
 )
 
+// a variant of an enum, with the types of its unnamed fields
+type Variant struct {
+	Name  string
+	Types []Type
+	// the named fields of a struct variant, `Name { a: A, b: B }`, instead of Types
+	Fields []Field
+	// print a variant without fields as an empty struct, `Name {}`, instead of `Name`
+	Empty bool
+	// the variant is the default value of the enum, #[default]
+	Default bool
+}
+
 type Field struct {
 	Name string
 	Type Type
 }
+type TypeParam struct {
+	Name   string
+	Bounds []string
+}
 type Param struct {
 	Name    string
 	Type    Type
@@ -132,11 +266,32 @@ type Stmt interface {
 
 type Assign struct {
 	Stmt
+	Origin
 	Dest  Expr
 	Value Expr
 }
 type Return struct {
 	Stmt
+	Origin
+	Value Expr
+}
+
+// a let statement; unlike the Let expression, the variable is in scope for the rest of the enclosing block
+type LetStmt struct {
+	Stmt
+	Origin
+	VariableName string
+	// the variables a tuple value is destructured into instead, if any
+	Names []string
+	// the type of the variable, or nil to let rust infer it
+	Type  Type
+	Value Expr
+}
+
+// an expression evaluated for its side effects, followed by a semicolon
+type ExprStmt struct {
+	Stmt
+	Origin
 	Value Expr
 }
 
@@ -147,42 +302,50 @@ type (
 	}
 	Block struct {
 		Expr
+		Origin
 		Statements []Stmt
 	}
 )
 
 type FieldValue struct {
 	AST
+	Origin
 	Name  string
 	Value Expr
 }
 type StructCons struct {
 	Expr
+	Origin
 	StructName string
 	Fields     []FieldValue
 }
 type EnumCons struct {
 	Expr
+	Origin
 	EnumName string
 	Variant  string
 	Params   []Expr
 }
 type Borrow struct {
 	Expr
+	Origin
 	Value Expr
 }
 type Tuple struct {
 	Expr
+	Origin
 	Values []Expr
 }
 type FunctionCall struct {
 	Expr
+	Origin
 	FunctionName string
 	TypeArgs     []Type
 	Arguments    []Expr
 }
 type StaticMethodCall struct {
 	Expr
+	Origin
 	TypeName   Type
 	MethodName string
 	TypeArgs   []Type
@@ -190,6 +353,7 @@ type StaticMethodCall struct {
 }
 type MethodCall struct {
 	Expr
+	Origin
 	Value      Expr
 	MethodName string
 	TypeArgs   []Type
@@ -197,31 +361,91 @@ type MethodCall struct {
 }
 type Let struct {
 	Expr
+	Origin
 	VariableName string
-	Value        Expr
-	Body         Expr
+	// the variables a tuple value is destructured into instead, if any
+	Names []string
+	Value Expr
+	Body  Expr
 }
 type Variable struct {
 	Expr
+	Origin
 	VariableName string
+	// the value is an integer or a boolean, which rust copies instead of moving
+	Copy bool
 }
 type FieldAccess struct {
 	Expr
+	Origin
 	Value Expr
 	Field string
 }
 type IfElse struct {
 	Expr
+	Origin
 	Condition Expr
 	Then      Expr
 	Else      Expr
 }
-type Not struct {
+type Match struct {
 	Expr
+	Origin
 	Value Expr
+	Arms  []MatchArm
+}
+type MatchArm struct {
+	Pattern Expr
+	Body    Expr
+}
+
+// a pattern that matches a variant of an enum, like StdResult::Ok(r), NeutronResult::Error { .. } or QueryMsg::Total {}
+type VariantPattern struct {
+	Expr
+	Origin
+	EnumName string
+	Variant  string
+	// the payload is a struct, which is matched with braces
+	Struct bool
+	// the fields of a struct payload that are bound, `Variant { a: x }`
+	Fields []string
+	// the variables the payload is bound to, or the fields of a struct payload
+	Bindings []string
+	// ignore the rest of the payload, `Variant(..)` or `Variant { .. }`
+	Rest bool
 }
-type Add struct {
+
+// the ? operator
+type Try struct {
 	Expr
+	Origin
+	Value Expr
+}
+
+// a closure, like |k| map.get(&k) or move |k| ...
+type Closure struct {
+	Expr
+	Origin
+	Params []string
+	Body   Expr
+	Move   bool
+	// the closure returns a Result with the errors of checked arithmetic
+	Fallible bool
+}
+
+// a prefix operator, like !a or -a
+type UnaryOp struct {
+	Expr
+	Origin
+	Op    string
+	Value Expr
+}
+
+// an infix operator, like a + b or a && b
+type BinaryOp struct {
+	Expr
+	Origin
+	Op    string
 	Left  Expr
 	Right Expr
 }
@@ -231,20 +455,49 @@ type Literal interface {
 }
 type UInt64Literal struct {
 	Literal
+	Origin
 	Value uint64
 }
+type SignedLiteral struct {
+	Literal
+	Origin
+	TypeName string
+	Value    *big.Int
+}
+type BigUintLiteral struct {
+	Literal
+	Origin
+	TypeName string
+	Value    *big.Int
+}
+
+// a literal whose type rust infers, like the 1 of l.skip(1)
+type UntypedLiteral struct {
+	Literal
+	Origin
+	Value string
+}
 type StringLiteral struct {
 	Literal
+	Origin
 	Value string
 }
 type BoolLiteral struct {
 	Literal
+	Origin
 	Value bool
 }
 type Macro struct {
 	Expr
+	Origin
 	Name string
 	Args []Expr
 }
 
 var Todo = Macro{Name: "todo", Args: []Expr{}}
+
+// newTodo returns a copy of Todo, which can get its own origin
+func newTodo() *Macro {
+	todo := Todo
+	return &todo
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"piwasm/quintir"
+)
+
+// the applications of quint builtins and stdlib defs that are plain calls in rust, like `m.get(k)` becoming
+// `m.get(&k).cloned().unwrap()`, are described by the builtin mappings instead of a case in resolveExpr.
+// the default mappings are in builtins.json, and --builtins adds mappings from another file, or replaces them,
+// e.g. for another rust collection library. the keys are the names of the builtin operators of quint, or the
+// qualified names of stdlib defs like `quint_stdlib::mapRemove`, which only match that def outside of its module.
+
+//go:embed builtins.json
+var defaultBuiltins []byte
+
+// builtin describes the rust that the application of a quint operator becomes
+type builtin struct {
+	// method calls the method on the first argument, `a.name(b, c)`; function calls a function, `name(a, b)`;
+	// static calls an associated function, `Type::name(a, b)`; and macro invokes a macro, `name!(a, b)`
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// the types the arguments are translated with, as hints for their literals: set, map, list, bool, int,
+	// _ for any type, or "" for no hint. an application with another number of arguments is reported.
+	Args []string `json:"args,omitempty"`
+	// the arguments that are passed by reference
+	Borrow []int `json:"borrow,omitempty"`
+	// the methods called on the result, like unwrap
+	Then []builtinMethod `json:"then,omitempty"`
+}
+
+// builtinMethod is a method called on the result of a builtin
+type builtinMethod struct {
+	Name     string   `json:"name"`
+	TypeArgs []string `json:"typeArgs,omitempty"`
+	// the arguments of the application that are passed to the method instead of the call, like the default of
+	// `m.get(&k).cloned().unwrap_or(d)`
+	Args []int `json:"args,omitempty"`
+}
+
+// builtins are the mappings in use, by quint name
+var builtins = make(map[string]*builtin)
+
+func init() {
+	if err := registerBuiltins(defaultBuiltins); err != nil {
+		panic(fmt.Sprintf("the default builtin mappings are invalid: %v", err))
+	}
+}
+
+// loadBuiltins adds the mappings of the JSON file at path, replacing the ones with the same names
+func loadBuiltins(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return registerBuiltins(data)
+}
+
+// registerBuiltins adds the mappings of a JSON object from quint names to mappings
+func registerBuiltins(data []byte) error {
+	var mappings map[string]*builtin
+	if err := json.Unmarshal(data, &mappings); err != nil {
+		return err
+	}
+	for name, b := range mappings {
+		if err := registerBuiltin(name, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerBuiltin adds the mapping of the quint operator name, replacing an existing one
+func registerBuiltin(name string, b *builtin) error {
+	switch b.Kind {
+	case "method", "function", "static", "macro":
+	default:
+		return fmt.Errorf("%s: unknown kind %q, expected method, function, static or macro", name, b.Kind)
+	}
+	if b.Name == "" {
+		return fmt.Errorf("%s: the name of the rust %s is missing", name, b.Kind)
+	}
+	if b.Kind == "static" && !strings.Contains(b.Name, "::") {
+		return fmt.Errorf("%s: static calls are named Type::function, got %s", name, b.Name)
+	}
+	if b.Kind == "method" && len(b.Args) == 0 {
+		return fmt.Errorf("%s: a method needs at least one argument to be called on", name)
+	}
+	hints := append([]string{}, b.Args...)
+	for _, then := range b.Then {
+		hints = append(hints, then.TypeArgs...)
+	}
+	for _, hint := range hints {
+		if _, ok := hintTypes[hint]; !ok {
+			return fmt.Errorf("%s: unknown type %q", name, hint)
+		}
+	}
+	for _, i := range b.Borrow {
+		if i < 0 || (len(b.Args) > 0 && i >= len(b.Args)) {
+			return fmt.Errorf("%s: there is no argument %d to borrow", name, i)
+		}
+	}
+	for _, then := range b.Then {
+		for _, i := range then.Args {
+			if i < 0 || i >= len(b.Args) {
+				return fmt.Errorf("%s: there is no argument %d to pass to %s", name, i, then.Name)
+			}
+			if i == 0 && b.Kind == "method" {
+				return fmt.Errorf("%s: the method is called on argument 0, which cannot be passed to %s", name, then.Name)
+			}
+		}
+	}
+	builtins[name] = b
+	return nil
+}
+
+// hintTypes are the types that mappings can name
+var hintTypes = map[string]func() Type{
+	"":     func() Type { return nil },
+	"_":    func() Type { return WildcardType },
+	"set":  func() Type { return &SetType{ElementType: WildcardType} },
+	"map":  func() Type { return &MapType{Key: WildcardType, Value: WildcardType} },
+	"list": func() Type { return &ListType{ElementType: WildcardType} },
+	"bool": func() Type { return &BoolType{} },
+	"int":  func() Type { return &UInt64Type{} },
+}
+
+// builtinOf returns the mapping of the application. a call of a def only matches the qualified name of the def,
+// so that a def of the model that is named like a stdlib def or builtin, like has or get, is still called
+func (t *translator) builtinOf(app *quintir.App) *builtin {
+	if t.ir.Lookup(app.ID) == nil {
+		// the builtin operators of quint are no defs
+		return builtins[app.Opcode]
+	}
+	if name := t.qualifiedName(app); name != "" {
+		return builtins[name]
+	}
+	return nil
+}
+
+// qualifiedName returns the qualified name `module::def` of the top-level def that the application calls,
+// or "" if it calls no top-level def of another module. inside the module that defines it, the def is called
+// instead of its mapping, so that the run tests of the stdlib test the translation of its defs.
+func (t *translator) qualifiedName(app *quintir.App) string {
+	if lookup := t.ir.Lookup(app.ID); lookup != nil {
+		if module, ok := t.defModules[lookup.Def.QuintID()]; ok && module != t.context.module {
+			return module + "::" + app.Opcode
+		}
+	}
+	return ""
+}
+
+// resolveBuiltin translates the application of an operator with a mapping
+func (t *translator) resolveBuiltin(app *quintir.App, b *builtin) Expr {
+	if len(b.Args) > 0 && len(app.Args) != len(b.Args) {
+		t.errorf(app, "%s is mapped with %d arguments, but applied to %d", app.Opcode, len(b.Args), len(app.Args))
+		return newTodo()
+	}
+	args := make([]Expr, len(app.Args))
+	for i, arg := range app.Args {
+		var hint Type
+		if i < len(b.Args) {
+			hint = hintTypes[b.Args[i]]()
+		}
+		args[i] = t.resolveExpr(arg, hint)
+	}
+	for _, i := range b.Borrow {
+		if i < len(args) {
+			args[i] = &Borrow{Value: args[i]}
+		}
+	}
+
+	// the arguments that go to the methods on the result are not passed to the call
+	passed := make(map[int]bool)
+	for _, then := range b.Then {
+		for _, i := range then.Args {
+			passed[i] = true
+		}
+	}
+	var callArgs []Expr
+	for i, arg := range args {
+		if !passed[i] {
+			callArgs = append(callArgs, arg)
+		}
+	}
+
+	var result Expr
+	switch b.Kind {
+	case "method":
+		result = &MethodCall{Value: callArgs[0], MethodName: b.Name, Arguments: callArgs[1:]}
+	case "function":
+		result = &FunctionCall{FunctionName: b.Name, Arguments: callArgs}
+	case "static":
+		split := strings.LastIndex(b.Name, "::")
+		result = &StaticMethodCall{TypeName: &ConstType{Name: b.Name[:split]}, MethodName: b.Name[split+2:], Arguments: callArgs}
+	case "macro":
+		result = &Macro{Name: b.Name, Args: callArgs}
+	}
+	for _, then := range b.Then {
+		var types []Type
+		for _, hint := range then.TypeArgs {
+			types = append(types, hintTypes[hint]())
+		}
+		var arguments []Expr
+		for _, i := range then.Args {
+			arguments = append(arguments, args[i])
+		}
+		result = &MethodCall{Value: result, MethodName: then.Name, TypeArgs: types, Arguments: arguments}
+	}
+	return result
+}
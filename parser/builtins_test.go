@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"piwasm/quintir"
+)
+
+// TestStdlibMappings checks that the stdlib defs with a mapping are called inside the stdlib, so that its run
+// tests test their translation
+func TestStdlibMappings(t *testing.T) {
+	integer := &quintir.IntType{}
+	set := &quintir.SetType{Elem: integer}
+	tests := []struct {
+		name   string
+		module string
+		inRun  bool
+		want   string
+	}{
+		{name: "contract", module: "ibc_transfer", want: "s.without(&3_u64)"},
+		{name: "stdlib", module: "quint_stdlib", want: "setRemove(s, 3_u64)"},
+		// the type variable of setRemove is not one of the run, which would be unit
+		{name: "run of the stdlib", module: "quint_stdlib", inRun: true, want: "setRemove(HashSet::<u64>::new(), 3_u64)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ir := loadModel(t)
+			b := newExprBuilder(ir)
+			setRemove := findDef(t, ir, "quint_stdlib", "setRemove")
+			var s quintir.Expr = b.name("s", set)
+			if test.inRun {
+				s = b.app("Set", set)
+			}
+			tr := newTranslator(ir)
+			tr.enter(test.module, setRemove)
+			tr.inRun = test.inRun
+			if got := rust(tr.resolveExpr(b.call(setRemove, set, s, b.int(3)), nil)); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+			if len(tr.diagnostics) > 0 {
+				t.Errorf("got the problems %v", tr.diagnostics)
+			}
+		})
+	}
+}
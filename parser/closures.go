@@ -0,0 +1,113 @@
+package main
+
+import (
+	"piwasm/quintir"
+)
+
+// quint lambdas, like the `__k => __map.get(__k)` of mapBy, become rust closures. the variables a closure
+// captures from the def around it decide how it is written:
+//   - a closure that is passed to an operator right away borrows what it captures, `|k| map.get(&k)`.
+//     it may be called many times, so the captured values that are used by value are cloned at every use,
+//     except for integers and booleans, which are Copy.
+//   - a closure that outlives the expression it is written in, like the value of a local def, is a
+//     `move |k| ...`, which owns what it captures.
+//
+// in a function that returns the errors of checked arithmetic, the closures passed to the higher-order
+// operators on collections return them too, `|x| Ok::<_, StdError>(x.checked_add(1_u64).ok_or(...)?)`, and the
+// iterator chain propagates the first one. the other closures panic on overflow.
+
+// resolveClosure translates a lambda into a closure. escapes tells if the closure outlives the expression, and
+// fallible if it returns the errors of checked arithmetic, whose body has to be wrapped with closureOk then
+func (t *translator) resolveClosure(lambda *quintir.Lambda, escapes, fallible bool) *Closure {
+	closure := &Closure{Move: escapes && len(t.captures(lambda)) > 0, Fallible: fallible}
+	for _, param := range lambda.Params {
+		closure.Params = append(closure.Params, param.Name)
+	}
+
+	// the captured variables are cloned where they are used in the body, and the errors of checked arithmetic
+	// can only be returned from the closure if it is fallible
+	captured, propagates := t.captured, t.propagates
+	t.captured = make(map[int]bool, len(captured))
+	for id := range captured {
+		t.captured[id] = true
+	}
+	if !closure.Move {
+		for _, id := range t.captures(lambda) {
+			t.captured[id] = true
+		}
+	}
+	t.propagates = fallible
+	closure.Body = t.resolveExpr(lambda.Expr, nil)
+	t.captured, t.propagates = captured, propagates
+	return closure
+}
+
+// captures returns the ids of the variables that lambda uses but does not define, which are the parameters
+// and local defs of the defs and lambdas around it
+func (t *translator) captures(lambda *quintir.Lambda) []int {
+	defined := make(map[int]bool)
+	for _, param := range lambda.Params {
+		defined[param.ID] = true
+	}
+	quintir.Walk(lambda.Expr, func(expr quintir.Expr) {
+		switch e := expr.(type) {
+		case *quintir.Lambda:
+			for _, param := range e.Params {
+				defined[param.ID] = true
+			}
+		case *quintir.Let:
+			defined[e.Opdef.ID] = true
+		}
+	})
+
+	var ids []int
+	seen := make(map[int]bool)
+	quintir.Walk(lambda.Expr, func(expr quintir.Expr) {
+		name, ok := expr.(*quintir.Name)
+		if !ok {
+			return
+		}
+		lookup := t.ir.Lookup(name.ID)
+		if lookup == nil {
+			return
+		}
+		id := lookup.Def.QuintID()
+		if _, topLevel := t.opDefs[id]; topLevel || defined[id] || seen[id] {
+			return
+		}
+		switch lookup.Def.(type) {
+		case *quintir.Param, *quintir.OpDef:
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	})
+	return ids
+}
+
+// capturedUse returns the use of a variable in a closure, which is cloned if the closure borrows it
+// and it is not Copy
+func (t *translator) capturedUse(name *quintir.Name, variable Expr) Expr {
+	lookup := t.ir.Lookup(name.ID)
+	if lookup == nil {
+		return variable
+	}
+	return t.cloneCaptured(lookup.Def.QuintID(), t.ir.TypeOf(name.ID), variable)
+}
+
+// cloneCaptured returns the use of a value of the given type that comes from the variable with the given id,
+// which is cloned if a closure borrows the variable and the value is not Copy
+func (t *translator) cloneCaptured(id int, typ quintir.Type, variable Expr) Expr {
+	if !t.captured[id] || isCopy(typ) {
+		return variable
+	}
+	return &MethodCall{Value: variable, MethodName: "clone"}
+}
+
+// isCopy checks if the values of the type are Copy in rust, which integers and booleans are
+func isCopy(typ quintir.Type) bool {
+	switch typ.(type) {
+	case *quintir.IntType, *quintir.BoolType:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+
+	"piwasm/quintir"
+)
+
+// param declares a parameter of a def or lambda
+func (b *exprBuilder) param(name string, typ quintir.Type) *quintir.Param {
+	return &quintir.Param{ID: b.id(typ), Name: name}
+}
+
+// use builds a use of a parameter
+func (b *exprBuilder) use(param *quintir.Param, typ quintir.Type) *quintir.Name {
+	name := b.name(param.Name, typ)
+	b.ir.Table[name.ID] = &quintir.LookupDef{Def: param}
+	return name
+}
+
+func (b *exprBuilder) lambda(params []*quintir.Param, body quintir.Expr) *quintir.Lambda {
+	lambda := &quintir.Lambda{ID: b.id(nil), Qualifier: "def", Expr: body}
+	for _, param := range params {
+		lambda.Params = append(lambda.Params, quintir.LambdaParam{ID: param.ID, Name: param.Name})
+	}
+	return lambda
+}
+
+func TestClosures(t *testing.T) {
+	integer, str := &quintir.IntType{}, &quintir.StrType{}
+	tests := []struct {
+		name string
+		// the expression, in a def with the parameters s: str and n: int
+		expr func(b *exprBuilder, s, n *quintir.Param) quintir.Expr
+		want string
+	}{
+		{
+			name: "borrowed integer",
+			expr: func(b *exprBuilder, s, n *quintir.Param) quintir.Expr {
+				k := b.param("k", integer)
+				return b.lambda([]*quintir.Param{k}, b.app("iadd", integer, b.use(k, integer), b.use(n, integer)))
+			},
+			want: "|k| k + n",
+		},
+		{
+			name: "borrowed string",
+			expr: func(b *exprBuilder, s, n *quintir.Param) quintir.Expr {
+				k := b.param("k", integer)
+				return b.lambda([]*quintir.Param{k}, b.use(s, str))
+			},
+			want: "|k| s.clone()",
+		},
+		{
+			name: "nested lambda",
+			expr: func(b *exprBuilder, s, n *quintir.Param) quintir.Expr {
+				k, j := b.param("k", integer), b.param("j", str)
+				inner := b.lambda([]*quintir.Param{j}, b.use(k, integer))
+				return b.lambda([]*quintir.Param{k}, inner)
+			},
+			want: "|k| |j| k",
+		},
+		{
+			name: "local def",
+			expr: func(b *exprBuilder, s, n *quintir.Param) quintir.Expr {
+				k := b.param("k", integer)
+				def := &quintir.OpDef{ID: b.id(nil), Name: "f", Qualifier: "def", Expr: b.lambda([]*quintir.Param{k}, b.use(s, str))}
+				return &quintir.Let{ID: b.id(str), Opdef: def, Expr: b.str("done")}
+			},
+			want: "let f = move |k| s;\n\"done\".to_string()",
+		},
+		{
+			name: "local def without captures",
+			expr: func(b *exprBuilder, s, n *quintir.Param) quintir.Expr {
+				k := b.param("k", integer)
+				def := &quintir.OpDef{ID: b.id(nil), Name: "f", Qualifier: "def", Expr: b.lambda([]*quintir.Param{k}, b.use(k, integer))}
+				return &quintir.Let{ID: b.id(str), Opdef: def, Expr: b.str("done")}
+			},
+			want: "let f = |k| k;\n\"done\".to_string()",
+		},
+		{
+			name: "call of an operator parameter",
+			expr: func(b *exprBuilder, s, n *quintir.Param) quintir.Expr {
+				f := b.param("f", &quintir.OperType{Args: []quintir.Type{integer}, Res: integer})
+				call := b.app("f", integer, b.int(3))
+				b.ir.Table[call.ID] = &quintir.LookupDef{Def: f}
+				return call
+			},
+			want: "f(3_u64)",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ir := &quintir.Output{}
+			b := newExprBuilder(ir)
+			s, n := b.param("s", str), b.param("n", integer)
+			expr := test.expr(b, s, n)
+			tr := newTranslator(ir)
+			got := rust(tr.resolveExpr(expr, nil))
+			if len(tr.diagnostics) > 0 {
+				t.Errorf("got the problems %v", tr.diagnostics)
+			}
+			if got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFnType(t *testing.T) {
+	typ := &quintir.OperType{Args: []quintir.Type{&quintir.IntType{}, &quintir.StrType{}}, Res: &quintir.BoolType{}}
+	want := "impl Fn(u64, String) -> bool"
+	if got := rust(newTranslator(&quintir.Output{}).resolveType(typ)); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"piwasm/quintir"
+)
+
+// Diagnostic is a problem found while translating a quint declaration.
+// The translation does not stop at the first problem, so that all of them can be reported at once.
+type Diagnostic struct {
+	// the module and top-level declaration that was being translated
+	Module   string
+	DeclName string
+	DeclID   int
+	// the id of the expression or type the problem is about, or 0 if it is about the declaration itself
+	NodeID int
+	// where the node, or else the declaration, is in the quint sources, or nil if the input has no source map
+	Loc     *quintir.Loc
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	location := d.Module
+	if d.Loc != nil {
+		location = d.Loc.String() + ": " + location
+	}
+	if d.DeclName != "" {
+		location += "::" + d.DeclName
+	}
+	if d.DeclID != 0 {
+		location += " (id " + strconv.Itoa(d.DeclID) + ")"
+	}
+	if d.NodeID != 0 && d.NodeID != d.DeclID {
+		location += ", at id " + strconv.Itoa(d.NodeID)
+	}
+	return location + ": " + d.Message
+}
+
+// Diagnostics collects the problems of a whole translation
+type Diagnostics []Diagnostic
+
+// Report writes one line per diagnostic, followed by a summary
+func (ds Diagnostics) Report(w io.Writer, severity string) {
+	for _, d := range ds {
+		fmt.Fprintf(w, "%s: %s\n", severity, d)
+	}
+	if len(ds) > 0 {
+		fmt.Fprintf(w, "%d problem(s) found during translation\n", len(ds))
+	}
+}
+
+// Check reports the diagnostics, as errors unless allowTodo is set, and returns whether the output may be written
+func (ds Diagnostics) Check(w io.Writer, allowTodo bool) bool {
+	if len(ds) == 0 {
+		return true
+	}
+	if !allowTodo {
+		ds.Report(w, "error")
+		fmt.Fprintln(w, "Not writing output, run with --allow-todo to write it anyway")
+		return false
+	}
+	ds.Report(w, "warning")
+	return true
+}
+
+// declContext is the top-level declaration that is currently being translated
+type declContext struct {
+	module string
+	name   string
+	id     int
+}
+
+// enter sets the declaration that subsequent diagnostics are attributed to
+func (t *translator) enter(module string, decl quintir.Declaration) {
+	t.context = declContext{module: module, name: quintir.DeclarationName(decl), id: decl.QuintID()}
+}
+
+// errorf records a diagnostic about node, which may be nil if the problem is about the current declaration
+func (t *translator) errorf(node quintir.Node, format string, args ...interface{}) {
+	nodeID := 0
+	if node != nil {
+		nodeID = node.QuintID()
+	}
+	loc := t.ir.SourceMap[nodeID]
+	if loc == nil {
+		loc = t.ir.SourceMap[t.context.id]
+	}
+	t.diagnostics = append(t.diagnostics, Diagnostic{
+		Module:   t.context.module,
+		DeclName: t.context.name,
+		DeclID:   t.context.id,
+		NodeID:   nodeID,
+		Loc:      loc,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"math/big"
+
+	"piwasm/quintir"
+)
+
+// exprBuilder builds quint expressions for the tests, and records their types and the definitions their names
+// refer to like the typechecker does
+type exprBuilder struct {
+	ir   *quintir.Output
+	next int
+}
+
+func newExprBuilder(ir *quintir.Output) *exprBuilder {
+	if ir.Types == nil {
+		ir.Types = make(map[int]*quintir.TypeScheme)
+	}
+	if ir.Table == nil {
+		ir.Table = make(map[int]*quintir.LookupDef)
+	}
+	// the ids of the typechecker output stay below this
+	return &exprBuilder{ir: ir, next: 1000000}
+}
+
+// id returns a new id, with the given type if it is not nil
+func (b *exprBuilder) id(typ quintir.Type) int {
+	b.next++
+	if typ != nil {
+		b.ir.Types[b.next] = &quintir.TypeScheme{Type: typ}
+	}
+	return b.next
+}
+
+func (b *exprBuilder) name(name string, typ quintir.Type) *quintir.Name {
+	return &quintir.Name{ID: b.id(typ), Name: name}
+}
+
+func (b *exprBuilder) str(value string) *quintir.StrLit {
+	return &quintir.StrLit{ID: b.id(&quintir.StrType{}), Value: value}
+}
+
+func (b *exprBuilder) int(value int64) *quintir.IntLit {
+	return &quintir.IntLit{ID: b.id(&quintir.IntType{}), Value: big.NewInt(value)}
+}
+
+func (b *exprBuilder) app(opcode string, typ quintir.Type, args ...quintir.Expr) *quintir.App {
+	return &quintir.App{ID: b.id(typ), Opcode: opcode, Args: args}
+}
+
+// call builds the call of a definition
+func (b *exprBuilder) call(def *quintir.OpDef, typ quintir.Type, args ...quintir.Expr) *quintir.App {
+	call := b.app(def.Name, typ, args...)
+	b.ir.Table[call.ID] = &quintir.LookupDef{Def: def}
+	return call
+}
+
+// rust prints a node of the rust AST
+func rust(node AST) string {
+	code, _ := extractMappings(printNode(node, 0))
+	return code
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"piwasm/quintir"
+)
+
+// polymorphic defs like `pure def has(__map: a -> b, __key: a): bool` become generic functions,
+// `pub fn has<A: Clone + Eq + std::hash::Hash, B: Clone>(...)`. the bounds are inferred from how the type variables
+// are used: every value may be cloned, the elements of sets and keys of maps are hashed, and compared values need Eq.
+// with --monomorphize, they instead become one copy per type they are called with, like has_u64_String,
+// for the cases where the inferred bounds are not enough for the generic function to compile.
+
+// typeVarName returns the rust name of a type variable, which is capitalized like rust type parameters
+func typeVarName(name string) string {
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// typeVars appends the type variables of typ that are not in vars yet, in the order they appear
+func typeVars(typ quintir.Type, vars []string) []string {
+	switch tt := typ.(type) {
+	case *quintir.VarType:
+		if !contains(vars, tt.Name) {
+			vars = append(vars, tt.Name)
+		}
+	case *quintir.SetType:
+		vars = typeVars(tt.Elem, vars)
+	case *quintir.ListType:
+		vars = typeVars(tt.Elem, vars)
+	case *quintir.FunType:
+		vars = typeVars(tt.Res, typeVars(tt.Arg, vars))
+	case *quintir.OperType:
+		for _, arg := range tt.Args {
+			vars = typeVars(arg, vars)
+		}
+		vars = typeVars(tt.Res, vars)
+	case *quintir.AppType:
+		for _, arg := range tt.Args {
+			vars = typeVars(arg, vars)
+		}
+	case *quintir.TupType:
+		fields, _ := quintir.RowFields(tt.Fields)
+		for _, field := range fields {
+			vars = typeVars(field.FieldType, vars)
+		}
+	case *quintir.RecType:
+		fields, _ := quintir.RowFields(tt.Fields)
+		for _, field := range fields {
+			vars = typeVars(field.FieldType, vars)
+		}
+	}
+	return vars
+}
+
+// hashedVars adds the type variables that are elements of sets or keys of maps in typ, which rust hashes
+func hashedVars(typ quintir.Type, hashed map[string]bool) {
+	switch tt := typ.(type) {
+	case *quintir.SetType:
+		for _, name := range typeVars(tt.Elem, nil) {
+			hashed[name] = true
+		}
+		hashedVars(tt.Elem, hashed)
+	case *quintir.FunType:
+		for _, name := range typeVars(tt.Arg, nil) {
+			hashed[name] = true
+		}
+		hashedVars(tt.Arg, hashed)
+		hashedVars(tt.Res, hashed)
+	case *quintir.ListType:
+		hashedVars(tt.Elem, hashed)
+	case *quintir.OperType:
+		for _, arg := range tt.Args {
+			hashedVars(arg, hashed)
+		}
+		hashedVars(tt.Res, hashed)
+	case *quintir.AppType:
+		for _, arg := range tt.Args {
+			hashedVars(arg, hashed)
+		}
+	case *quintir.TupType:
+		fields, _ := quintir.RowFields(tt.Fields)
+		for _, field := range fields {
+			hashedVars(field.FieldType, hashed)
+		}
+	case *quintir.RecType:
+		fields, _ := quintir.RowFields(tt.Fields)
+		for _, field := range fields {
+			hashedVars(field.FieldType, hashed)
+		}
+	}
+}
+
+// isPolymorphic checks if the type of def has type variables
+func (t *translator) isPolymorphic(def *quintir.OpDef) bool {
+	return len(typeVars(t.defType(def), nil)) > 0
+}
+
+// typeParams infers the type parameters of a polymorphic def and their bounds
+func (t *translator) typeParams(def *quintir.OpDef) []TypeParam {
+	signature := t.defType(def)
+	vars := typeVars(signature, nil)
+	if len(vars) == 0 {
+		return nil
+	}
+
+	hashed := make(map[string]bool)
+	compared := make(map[string]bool)
+	hashedVars(signature, hashed)
+	quintir.Walk(def.Expr, func(expr quintir.Expr) {
+		if inferred := t.ir.TypeOf(expr.QuintID()); inferred != nil {
+			hashedVars(inferred, hashed)
+		}
+		if app, ok := expr.(*quintir.App); ok && (app.Opcode == "eq" || app.Opcode == "neq") {
+			for _, arg := range app.Args {
+				if v, ok := t.ir.TypeOf(arg.QuintID()).(*quintir.VarType); ok {
+					compared[v.Name] = true
+				}
+			}
+		}
+	})
+
+	params := make([]TypeParam, len(vars))
+	for i, name := range vars {
+		bounds := []string{"Clone"}
+		if hashed[name] {
+			bounds = append(bounds, "Eq", "std::hash::Hash")
+		} else if compared[name] {
+			bounds = append(bounds, "Eq")
+		}
+		params[i] = TypeParam{Name: typeVarName(name), Bounds: bounds}
+	}
+	return params
+}
+
+// instance is a copy of a polymorphic def for the types it is called with
+type instance struct {
+	def      *quintir.OpDef
+	name     string
+	typeArgs map[string]Type
+}
+
+// instantiate returns the name of the copy of the polymorphic def that call needs, which is translated later
+// by resolveInstances. the types are inferred by matching the parameters of def against the arguments of call.
+// it returns "" after reporting a problem.
+func (t *translator) instantiate(call *quintir.App, def *quintir.OpDef, exprType Type) string {
+	operType, ok := t.defType(def).(*quintir.OperType)
+	if !ok {
+		t.errorf(call, "%s has no operator type", def.Name)
+		return ""
+	}
+	typeArgs := make(map[string]Type)
+	for i, param := range operType.Args {
+		if i < len(call.Args) {
+			unifyType(param, t.typeOf(call.Args[i]), typeArgs)
+		}
+	}
+	unifyType(operType.Res, exprType, typeArgs)
+
+	name := def.Name
+	for _, v := range typeVars(operType, nil) {
+		typeArg, ok := typeArgs[v]
+		if !ok {
+			t.errorf(call, "cannot infer the type %s of this call of %s", v, def.Name)
+			return ""
+		}
+		name += "_" + typeSuffix(typeArg)
+	}
+
+	if !t.instanceNames[name] {
+		t.instanceNames[name] = true
+		t.instances = append(t.instances, &instance{def: def, name: name, typeArgs: typeArgs})
+	}
+	return name
+}
+
+// unifyType records the types that the type variables of the quint type stand for in the rust type
+func unifyType(typ quintir.Type, rust Type, typeArgs map[string]Type) {
+	if !isKnown(rust) {
+		return
+	}
+	switch tt := typ.(type) {
+	case *quintir.VarType:
+		if _, ok := typeArgs[tt.Name]; !ok {
+			typeArgs[tt.Name] = rust
+		}
+	case *quintir.SetType:
+		if set, ok := rust.(*SetType); ok {
+			unifyType(tt.Elem, set.ElementType, typeArgs)
+		}
+	case *quintir.ListType:
+		if list, ok := rust.(*ListType); ok {
+			unifyType(tt.Elem, list.ElementType, typeArgs)
+		}
+	case *quintir.FunType:
+		if m, ok := rust.(*MapType); ok {
+			unifyType(tt.Arg, m.Key, typeArgs)
+			unifyType(tt.Res, m.Value, typeArgs)
+		}
+	case *quintir.AppType:
+		if option, ok := rust.(*OptionType); ok && len(tt.Args) == 1 {
+			unifyType(tt.Args[0], option.ValueType, typeArgs)
+		}
+	case *quintir.TupType:
+		fields, _ := quintir.RowFields(tt.Fields)
+		if tuple, ok := rust.(*TupleType); ok && len(tuple.Types) == len(fields) {
+			for i, field := range fields {
+				unifyType(field.FieldType, tuple.Types[i], typeArgs)
+			}
+		}
+	}
+}
+
+var nonIdentifier = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// typeSuffix turns a type into a part of an identifier, e.g. HashSet::<u64> into HashSet_u64
+func typeSuffix(typ Type) string {
+	printed, _ := extractMappings(printNode(typ, 0))
+	return strings.Trim(nonIdentifier.ReplaceAllString(printed, "_"), "_")
+}
+
+// resolveInstances translates the copies of the polymorphic defs that were called, including the ones
+// called by the copies themselves
+func (t *translator) resolveInstances() []Decl {
+	var decls []Decl
+	for len(t.instances) > 0 {
+		inst := t.instances[0]
+		t.instances = t.instances[1:]
+
+		t.enter(t.defModules[inst.def.ID], inst.def)
+		t.typeArgs = inst.typeArgs
+		fn, ok := t.resolveDef(inst.def).(*FunctionDecl)
+		t.typeArgs = nil
+		if ok {
+			fn.Name = inst.name
+			decls = append(decls, fn)
+		}
+	}
+	return decls
+}
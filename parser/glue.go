@@ -0,0 +1,541 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"piwasm/quintir"
+)
+
+// the glue is the lib.rs of the contract. it defines the cosmwasm entry points, which load the contract storage,
+// call the translated entry point of the quint model, save the new storage and turn the result into a response.
+// which quint definition becomes which entry point is decided by naming conventions, see entryPointKinds.
+
+// the quint type of the state that is loaded before and saved after every entry point
+const storageTypeName = "ContractStorage"
+
+// entryPointKind describes a cosmwasm entry point that quint definitions are translated to
+type entryPointKind struct {
+	// the name of the cosmwasm entry point
+	name string
+	// whether the entry point gets the MessageInfo of the sender
+	info bool
+	// whether the storage starts out empty instead of being loaded
+	initial bool
+	// whether the storage is only read, and the value returned by the definition is the response, like for queries
+	readOnly bool
+	// for entry points that dispatch on a message enum, the prefix of the definitions that become its variants
+	// and the name of the enum, e.g. execute_send becomes ExecuteMsg::Send
+	prefix, enum string
+}
+
+var (
+	instantiateKind = entryPointKind{name: "instantiate", info: true, initial: true}
+	executeKind     = entryPointKind{name: "execute", info: true, prefix: "execute_", enum: "ExecuteMsg"}
+	queryKind       = entryPointKind{name: "query", readOnly: true, prefix: "query_", enum: "QueryMsg"}
+	replyKind       = entryPointKind{name: "reply"}
+	sudoKind        = entryPointKind{name: "sudo"}
+	migrateKind     = entryPointKind{name: "migrate"}
+)
+
+// entryPointKinds maps the names of quint definitions to the entry points they become.
+// definitions named `execute_<variant>` and `query_<variant>` are grouped into one entry point, see dispatchKinds.
+var entryPointKinds = map[string]entryPointKind{
+	"instantiate": instantiateKind,
+	"reply":       replyKind,
+	"sudo":        sudoKind,
+	"migrate":     migrateKind,
+}
+
+// the entry points that dispatch on a message enum, in the order they are generated
+var dispatchKinds = []entryPointKind{executeKind, queryKind}
+
+// entryArgs are the rust expressions passed for the parameters of a quint entry point, by the name of their type.
+// a parameter of any other type is the message of the entry point.
+var entryArgs = map[string]string{
+	storageTypeName: "storage",
+	"MsgInfo":       "info",
+	"Env":           "env",
+}
+
+// quint types whose rust counterpart is a conversion of the cosmwasm type the entry point gets
+var cosmwasmMsgTypes = map[string]string{
+	"Reply": "Reply",
+}
+
+// resultConversion says how the result returned by a quint entry point becomes a cosmwasm response
+type resultConversion struct {
+	// the rust type the result is converted into with `.into()`, a cosmwasm_std::StdResult
+	into string
+	// the type of the response of the entry point
+	response string
+	// the method called on `Response::new()` with the unwrapped result
+	method string
+	// the arguments of the method, where `result` is the unwrapped result
+	args []string
+}
+
+// resultConversions are keyed by the name of the quint result type
+var resultConversions = map[string]resultConversion{
+	"StdResult": {
+		into:     "cosmwasm_std::StdResult<contract::wasm_stdlib::Result>",
+		response: "Response",
+		method:   "add_attribute",
+		args:     []string{`"result"`, "result.data"},
+	},
+	"NeutronResult": {
+		into:     "cosmwasm_std::StdResult<Vec<SubMsg<NeutronMsg>>>",
+		response: "Response<NeutronMsg>",
+		method:   "add_submessages",
+		args:     []string{"result"},
+	},
+}
+
+// the rust code the glue needs besides the entry points, copied from the handwritten lib.rs
+const storageKey = `const STORAGE_KEY: &[u8] = b"storage";`
+
+const storageHelpers = `fn save<T: Serialize>(storage: &mut dyn Storage, key: &[u8], value: &T) -> StdResult<()> {
+    let bytes = postcard::to_allocvec(value)
+        .map_err(|e| StdError::generic_err(format!("Error serializing: {e}")))?;
+
+    storage.set(key, bytes.as_slice());
+
+    Ok(())
+}
+
+fn load<T: DeserializeOwned>(storage: &dyn Storage, key: &[u8]) -> StdResult<T> {
+    let bytes = &storage
+        .get(key)
+        .ok_or_else(|| StdError::not_found(std::any::type_name::<T>()))?;
+
+    postcard::from_bytes(bytes.as_slice())
+        .map_err(|e| StdError::generic_err(format!("Error deserializing: {e}")))
+}`
+
+// entryPoint is a quint definition together with what the glue needs to know to call it
+type entryPoint struct {
+	kind entryPointKind
+	// the name of the rust function that calls the translated definition
+	name string
+	def  *quintir.OpDef
+	// the rust type of the message, or nil if the definition does not take one
+	msgType Type
+	// the arguments passed to the translated definition
+	args []Expr
+	// where the new storage and the result are in the returned tuple, storage is -1 if it is not returned
+	storage, result int
+	conversion      resultConversion
+}
+
+// glue collects the entry points of a module and the types they need to import
+type glue struct {
+	t *translator
+	// the rust module the translated model is in, e.g. contract::ibc_transfer
+	contractModule string
+	// the quint module each typedef is declared in
+	typeModules map[string]string
+	// the types to import, by the rust module they are imported from
+	imports map[string]map[string]bool
+	// the names of the translated invariants, checked after every entry point that changes the storage
+	invariants []string
+}
+
+// generateGlue generates the lib.rs of the contract from the entrypoints module of the model.
+// invariants are the names of the predicates that are checked after every entry point, see invariantChecks.
+func (t *translator) generateGlue(module *quintir.Module, contractModule string, invariants []string) *Program {
+	g := &glue{
+		t:              t,
+		contractModule: contractModule,
+		typeModules:    make(map[string]string),
+		imports:        make(map[string]map[string]bool),
+		invariants:     invariants,
+	}
+	for _, m := range t.ir.Modules {
+		for _, decl := range m.Declarations {
+			if typeDef, ok := decl.(*quintir.TypeDef); ok {
+				g.typeModules[typeDef.Name] = m.Name
+			}
+		}
+	}
+
+	decls := []Decl{
+		&Verbatim{Code: "pub mod contract;"},
+		&Verbatim{Code: storageKey},
+	}
+
+	// the definitions grouped into each dispatching entry point, by its name
+	dispatched := make(map[string][]*entryPoint)
+	for _, decl := range module.Declarations {
+		def, ok := decl.(*quintir.OpDef)
+		if !ok {
+			continue
+		}
+		t.enter(module.Name, def)
+
+		kind, ok := entryPointKinds[def.Name]
+		for _, dispatchKind := range dispatchKinds {
+			if strings.HasPrefix(def.Name, dispatchKind.prefix) {
+				kind, ok = dispatchKind, true
+			}
+		}
+		if !ok {
+			// not an entry point, e.g. a helper of the entry points
+			continue
+		}
+		entry := g.entryPoint(kind, def)
+		if entry == nil {
+			continue
+		}
+		if kind.enum != "" {
+			dispatched[kind.name] = append(dispatched[kind.name], entry)
+			continue
+		}
+		decls = append(decls, g.entryFunction(entry, true))
+	}
+
+	for _, kind := range dispatchKinds {
+		if entries := dispatched[kind.name]; len(entries) > 0 {
+			decls = append(decls, g.dispatch(module, kind, entries)...)
+		}
+	}
+	if len(invariants) > 0 {
+		decls = append(decls, g.invariantChecks()...)
+	}
+	decls = append(decls, &Verbatim{Code: storageHelpers})
+
+	return &Program{
+		InnerAttrs: []string{"allow(unused_imports, unused_variables)"},
+		Imports:    g.importList(),
+		Decls:      decls,
+	}
+}
+
+// entryPoint works out how to call def, or returns nil after reporting why it cannot be called
+func (g *glue) entryPoint(kind entryPointKind, def *quintir.OpDef) *entryPoint {
+	t := g.t
+	operType, ok := t.defType(def).(*quintir.OperType)
+	if !ok {
+		t.errorf(def, "entry point %s must be an operator", def.Name)
+		return nil
+	}
+
+	entry := &entryPoint{kind: kind, name: def.Name, def: def, storage: -1}
+	for i, param := range operType.Args {
+		name := typeName(param)
+		if arg, ok := entryArgs[name]; ok {
+			if name == "MsgInfo" && !kind.info {
+				t.errorf(def, "the %s entry point does not get a MsgInfo", kind.name)
+			}
+			entry.args = append(entry.args, &Variable{VariableName: arg})
+			continue
+		}
+		if entry.msgType != nil {
+			t.errorf(def, "entry point %s takes more than one message, parameter %d has type %s", def.Name, i, name)
+			continue
+		}
+		if rustType, ok := cosmwasmMsgTypes[name]; ok {
+			entry.msgType = &ConstType{Name: rustType}
+			entry.args = append(entry.args, &MethodCall{Value: &Variable{VariableName: "msg"}, MethodName: "into"})
+			continue
+		}
+		entry.msgType = t.resolveType(param)
+		g.use(param)
+		entry.args = append(entry.args, &Variable{VariableName: "msg"})
+	}
+
+	for _, param := range operType.Args {
+		if typeName(param) == storageTypeName {
+			g.use(param)
+		}
+	}
+
+	// a query returns a value that is serialized as the response
+	if kind.readOnly {
+		if typeName(operType.Res) == storageTypeName {
+			t.errorf(def, "%s entry point %s must not return the %s, it cannot change it", kind.name, def.Name, storageTypeName)
+			return nil
+		}
+		return entry
+	}
+
+	// the definition returns a result, and usually the new storage: (Result, ContractStorage)
+	var results []quintir.Type
+	if tup, ok := operType.Res.(*quintir.TupType); ok {
+		fields, _ := quintir.RowFields(tup.Fields)
+		for _, field := range fields {
+			results = append(results, field.FieldType)
+		}
+	} else {
+		results = []quintir.Type{operType.Res}
+	}
+	entry.result = -1
+	for i, result := range results {
+		if typeName(result) == storageTypeName && entry.storage < 0 {
+			entry.storage = i
+		} else if entry.result < 0 {
+			entry.result = i
+		} else {
+			t.errorf(def, "entry point %s must return a result and the new %s", def.Name, storageTypeName)
+			return nil
+		}
+	}
+	if entry.result < 0 {
+		t.errorf(def, "entry point %s does not return a result", def.Name)
+		return nil
+	}
+
+	resultName := typeName(results[entry.result])
+	conversion, ok := resultConversions[resultName]
+	if !ok {
+		t.errorf(def, "no conversion of %s into a response is known, the result of %s must be one of %s", resultName, def.Name, strings.Join(conversionNames(), ", "))
+		return nil
+	}
+	entry.conversion = conversion
+	return entry
+}
+
+// response returns the type of the response of the entry point
+func (e *entryPoint) response() string {
+	if e.kind.readOnly {
+		return "Binary"
+	}
+	return e.conversion.response
+}
+
+// deps returns the type of the dependencies the entry point gets, which give access to the storage
+func (k entryPointKind) deps() string {
+	if k.readOnly {
+		return "Deps"
+	}
+	return "DepsMut"
+}
+
+// entryFunction generates the rust function that calls the translated entry point
+func (g *glue) entryFunction(entry *entryPoint, isEntryPoint bool) *FunctionDecl {
+	params := []Param{
+		{Name: "deps", Type: &ConstType{Name: entry.kind.deps()}},
+		{Name: "env", Type: &ConstType{Name: "Env"}},
+	}
+	if entry.kind.info {
+		params = append(params, Param{Name: "info", Type: &ConstType{Name: "MessageInfo"}})
+	}
+	if entry.msgType != nil {
+		params = append(params, Param{Name: "msg", Type: entry.msgType})
+	}
+
+	var body []Stmt
+	var initialStorage Expr = &StaticMethodCall{TypeName: &ConstType{Name: storageTypeName}, MethodName: "default"}
+	if !entry.kind.initial {
+		initialStorage = &Try{Value: &FunctionCall{
+			FunctionName: "load",
+			TypeArgs:     []Type{&ConstType{Name: storageTypeName}},
+			Arguments:    []Expr{&FieldAccess{Value: &Variable{VariableName: "deps"}, Field: "storage"}, &Variable{VariableName: "STORAGE_KEY"}},
+		}}
+	}
+	body = append(body, &LetStmt{VariableName: "storage", Value: initialStorage})
+
+	var call Expr = &FunctionCall{FunctionName: g.contractModule + "::" + entry.def.Name, Arguments: entry.args}
+	if g.t.fallible[entry.def.ID] {
+		// an overflow in the contract fails the entry point
+		call = &Try{Value: call}
+	}
+	if entry.kind.readOnly {
+		output := &Variable{VariableName: "output"}
+		body = append(body, &LetStmt{VariableName: "output", Value: call})
+		body = append(body, &Return{Value: &FunctionCall{FunctionName: "to_binary", Arguments: []Expr{&Borrow{Value: output}}}})
+		return g.function(entry, params, body, isEntryPoint)
+	}
+	if entry.storage < 0 {
+		body = append(body, &LetStmt{VariableName: "result", Value: call})
+	} else {
+		// the result and the new storage are destructured, `let (result, storage) = ...`
+		names := make([]string, 2)
+		names[entry.result], names[entry.storage] = "result", "storage"
+		body = append(body, &LetStmt{Names: names, Value: call})
+	}
+	body = append(body, &LetStmt{
+		VariableName: "result",
+		Type:         &ConstType{Name: entry.conversion.into},
+		Value:        &MethodCall{Value: &Variable{VariableName: "result"}, MethodName: "into"},
+	})
+	body = append(body, &LetStmt{
+		VariableName: "result",
+		Value:        &Try{Value: &Variable{VariableName: "result"}},
+	})
+	if entry.storage >= 0 {
+		// the new storage is only saved if the entry point succeeds, like cosmwasm reverts the state of failed messages
+		newStorage := &Variable{VariableName: "storage"}
+		if len(g.invariants) > 0 {
+			body = append(body, &ExprStmt{Value: &Try{Value: &FunctionCall{
+				FunctionName: "check_invariants",
+				Arguments:    []Expr{&Borrow{Value: newStorage}},
+			}}})
+		}
+		body = append(body, &ExprStmt{Value: &Try{Value: &FunctionCall{
+			FunctionName: "save",
+			Arguments: []Expr{
+				&FieldAccess{Value: &Variable{VariableName: "deps"}, Field: "storage"},
+				&Variable{VariableName: "STORAGE_KEY"},
+				&Borrow{Value: newStorage},
+			},
+		}}})
+	}
+
+	args := make([]Expr, len(entry.conversion.args))
+	for i, arg := range entry.conversion.args {
+		args[i] = &Variable{VariableName: arg}
+	}
+	response := &MethodCall{
+		Value:      &StaticMethodCall{TypeName: &ConstType{Name: "Response"}, MethodName: "new"},
+		MethodName: entry.conversion.method,
+		Arguments:  args,
+	}
+	body = append(body, &Return{Value: &FunctionCall{FunctionName: "Ok", Arguments: []Expr{response}}})
+	return g.function(entry, params, body, isEntryPoint)
+}
+
+func (g *glue) function(entry *entryPoint, params []Param, body []Stmt, isEntryPoint bool) *FunctionDecl {
+	var attrs []string
+	if isEntryPoint {
+		attrs = []string{"entry_point"}
+	}
+	decl := &FunctionDecl{
+		Name:       entry.name,
+		Params:     params,
+		ReturnType: &TypeCons{Name: "StdResult", Params: []Type{&ConstType{Name: entry.response()}}},
+		Body:       body,
+		Attrs:      attrs,
+	}
+	g.t.setOrigin(decl, entry.def)
+	return decl
+}
+
+// dispatch generates the message enum of kind, e.g. ExecuteMsg, with one variant per definition,
+// the entry point that dispatches on it, and one function per variant
+func (g *glue) dispatch(module *quintir.Module, kind entryPointKind, entries []*entryPoint) []Decl {
+	t := g.t
+	enum := &EnumDecl{
+		Name:  kind.enum,
+		Attrs: []string{"derive(Clone, Debug, PartialEq, Eq, Serialize, Deserialize)", `serde(rename_all = "snake_case")`},
+	}
+	dispatch := &Match{Value: &Variable{VariableName: "msg"}}
+	response := entries[0].response()
+
+	params := []Param{
+		{Name: "deps", Type: &ConstType{Name: kind.deps()}},
+		{Name: "env", Type: &ConstType{Name: "Env"}},
+	}
+	if kind.info {
+		params = append(params, Param{Name: "info", Type: &ConstType{Name: "MessageInfo"}})
+	}
+
+	var decls []Decl
+	for _, entry := range entries {
+		t.enter(module.Name, entry.def)
+		if entry.response() != response {
+			t.errorf(entry.def, "all %s entry points must have the same response, %s has %s but %s has %s",
+				kind.name, entries[0].name, response, entry.name, entry.response())
+		}
+
+		// variants without a message are empty structs, so that they are serialized as `{"variant": {}}` like in cosmwasm
+		variant := Variant{Name: camelCase(strings.TrimPrefix(entry.name, kind.prefix)), Empty: entry.msgType == nil}
+		args := make([]Expr, len(params))
+		for i, param := range params {
+			args[i] = &Variable{VariableName: param.Name}
+		}
+		pattern := &VariantPattern{EnumName: kind.enum, Variant: variant.Name, Struct: true}
+		if entry.msgType != nil {
+			variant.Types = []Type{entry.msgType}
+			pattern = &VariantPattern{EnumName: kind.enum, Variant: variant.Name, Bindings: []string{"msg"}}
+			args = append(args, &Variable{VariableName: "msg"})
+		}
+		enum.Variants = append(enum.Variants, variant)
+		dispatch.Arms = append(dispatch.Arms, MatchArm{
+			Pattern: pattern,
+			Body:    &FunctionCall{FunctionName: entry.name, Arguments: args},
+		})
+		decls = append(decls, g.entryFunction(entry, false))
+	}
+
+	entryPoint := &FunctionDecl{
+		Name:       kind.name,
+		Params:     append(params, Param{Name: "msg", Type: &ConstType{Name: kind.enum}}),
+		ReturnType: &TypeCons{Name: "StdResult", Params: []Type{&ConstType{Name: response}}},
+		Body:       []Stmt{&Return{Value: dispatch}},
+		Attrs:      []string{"entry_point"},
+	}
+	return append([]Decl{enum, entryPoint}, decls...)
+}
+
+// use imports the named types in typ from the module they are translated to
+func (g *glue) use(typ quintir.Type) {
+	name := typeName(typ)
+	module, ok := g.typeModules[name]
+	if !ok {
+		return
+	}
+	path := g.contractModule
+	if strings.HasSuffix(module, "_stdlib") {
+		path = "contract::" + module
+	}
+	if g.imports[path] == nil {
+		g.imports[path] = make(map[string]bool)
+	}
+	g.imports[path][name] = true
+}
+
+// importList returns the imports of the glue, the cosmwasm ones and those collected by use
+func (g *glue) importList() []Import {
+	imports := []Import{
+		{Path: "cosmwasm_std::{ensure, entry_point, to_binary, Binary, Deps, DepsMut, Env, MessageInfo, Reply, Response, StdError, StdResult, Storage, SubMsg}"},
+		{Path: "neutron_sdk::bindings::msg::NeutronMsg"},
+		{Path: "serde::{de::DeserializeOwned, Deserialize, Serialize}"},
+	}
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		names := make([]string, 0, len(g.imports[path]))
+		for name := range g.imports[path] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		imports = append(imports, Import{Path: path + "::{" + strings.Join(names, ", ") + "}"})
+	}
+	return imports
+}
+
+// typeName returns the name of a typedef reference, or the kind of any other type
+func typeName(typ quintir.Type) string {
+	if constType, ok := typ.(*quintir.ConstType); ok {
+		return constType.Name
+	}
+	if typ == nil {
+		return "<missing type>"
+	}
+	return typ.Kind()
+}
+
+func conversionNames() []string {
+	names := make([]string, 0, len(resultConversions))
+	for name := range resultConversions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// camelCase turns a snake_case name like transfer_funds into TransferFunds
+func camelCase(name string) string {
+	var sb strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+		sb.WriteString(strings.ToUpper(part[:1]))
+		sb.WriteString(part[1:])
+	}
+	return sb.String()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"piwasm/quintir"
+)
+
+// loadModel decodes the typechecker output of the example contract
+func loadModel(t *testing.T) *quintir.Output {
+	t.Helper()
+	ir, err := quintir.Load("../quint/ibc_transfer_types.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ir
+}
+
+func tuple(types ...quintir.Type) *quintir.TupType {
+	var fields []interface{}
+	for i, typ := range types {
+		fields = append(fields, string(rune('0'+i)), typ)
+	}
+	return &quintir.TupType{Fields: row(false, fields...)}
+}
+
+func TestGenerateGlue(t *testing.T) {
+	ir := loadModel(t)
+	tr := newTranslator(ir)
+	lib := tr.generateGlue(ir.Module("ibc_transfer_entrypoints"), "contract::ibc_transfer", nil)
+	if len(tr.diagnostics) > 0 {
+		t.Fatalf("got the problems %v", tr.diagnostics)
+	}
+	code, _ := lib.Render()
+
+	for _, want := range []string{
+		"use contract::ibc_transfer::{ContractStorage, ExecuteMsg_Send, InstantiateMsg};",
+		"pub fn instantiate(deps: DepsMut, env: Env, info: MessageInfo, msg: InstantiateMsg) -> StdResult<Response> {",
+		"let storage = ContractStorage::default();",
+		"pub fn reply(deps: DepsMut, env: Env, msg: Reply) -> StdResult<Response> {",
+		"let storage = load::<ContractStorage>(deps.storage, STORAGE_KEY)?;",
+		// the storage of a failed entry point is not saved
+		"let result = result?;\n    save(deps.storage, STORAGE_KEY, &storage)?;\n    Ok(Response::new().add_attribute(\"result\", result.data))",
+		"pub enum ExecuteMsg {\n    Send(ExecuteMsg_Send),\n}",
+		"ExecuteMsg::Send(msg) => execute_send(deps, env, info, msg),",
+		"pub fn execute_send(deps: DepsMut, env: Env, info: MessageInfo, msg: ExecuteMsg_Send) -> StdResult<Response<NeutronMsg>> {",
+		"Ok(Response::new().add_submessages(result))",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("the entry points do not contain\n%s\ngot\n%s", want, code)
+		}
+	}
+}
+
+func TestGenerateQueries(t *testing.T) {
+	storage := &quintir.ConstType{Name: storageTypeName}
+	module := &quintir.Module{Name: "bank_entrypoints", Declarations: []quintir.Declaration{
+		&quintir.OpDef{ID: 1, Name: "query_total", Qualifier: "puredef", TypeAnnotation: &quintir.OperType{
+			Args: []quintir.Type{storage},
+			Res:  &quintir.IntType{},
+		}},
+		&quintir.OpDef{ID: 2, Name: "query_balance", Qualifier: "puredef", TypeAnnotation: &quintir.OperType{
+			Args: []quintir.Type{storage, &quintir.ConstType{Name: "QueryMsg_Balance"}},
+			Res:  &quintir.IntType{},
+		}},
+	}}
+	tr := newTranslator(&quintir.Output{Modules: []*quintir.Module{module}})
+	lib := tr.generateGlue(module, "contract::bank", nil)
+	if len(tr.diagnostics) > 0 {
+		t.Fatalf("got the problems %v", tr.diagnostics)
+	}
+	code, _ := lib.Render()
+
+	for _, want := range []string{
+		"pub enum QueryMsg {\n    Total {},\n    Balance(QueryMsg_Balance),\n}",
+		"pub fn query(deps: Deps, env: Env, msg: QueryMsg) -> StdResult<Binary> {",
+		"QueryMsg::Total {} => query_total(deps, env),",
+		"QueryMsg::Balance(msg) => query_balance(deps, env, msg),",
+		"pub fn query_total(deps: Deps, env: Env) -> StdResult<Binary> {",
+		"let output = contract::bank::query_total(storage);",
+		"to_binary(&output)",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("the entry points do not contain\n%s\ngot\n%s", want, code)
+		}
+	}
+}
+
+func TestEntryPointErrors(t *testing.T) {
+	storage := &quintir.ConstType{Name: storageTypeName}
+	msg := &quintir.ConstType{Name: "InstantiateMsg"}
+	result := &quintir.ConstType{Name: "StdResult"}
+	tests := []struct {
+		name string
+		kind entryPointKind
+		typ  quintir.Type
+		err  string
+	}{
+		{
+			name: "not an operator",
+			kind: instantiateKind,
+			typ:  &quintir.IntType{},
+			err:  "entry point instantiate must be an operator",
+		},
+		{
+			name: "two messages",
+			kind: instantiateKind,
+			typ:  &quintir.OperType{Args: []quintir.Type{msg, &quintir.StrType{}}, Res: tuple(result, storage)},
+			err:  "entry point instantiate takes more than one message, parameter 1 has type str",
+		},
+		{
+			name: "info of a reply",
+			kind: replyKind,
+			typ:  &quintir.OperType{Args: []quintir.Type{&quintir.ConstType{Name: "MsgInfo"}, storage}, Res: tuple(result, storage)},
+			err:  "the reply entry point does not get a MsgInfo",
+		},
+		{
+			name: "no result",
+			kind: instantiateKind,
+			typ:  &quintir.OperType{Args: []quintir.Type{msg, storage}, Res: storage},
+			err:  "entry point instantiate does not return a result",
+		},
+		{
+			name: "two results",
+			kind: instantiateKind,
+			typ:  &quintir.OperType{Args: []quintir.Type{msg, storage}, Res: tuple(result, result, storage)},
+			err:  "entry point instantiate must return a result and the new ContractStorage",
+		},
+		{
+			name: "query that changes the storage",
+			kind: queryKind,
+			typ:  &quintir.OperType{Args: []quintir.Type{storage}, Res: storage},
+			err:  "query entry point query must not return the ContractStorage, it cannot change it",
+		},
+		{
+			name: "result without conversion",
+			kind: instantiateKind,
+			typ:  &quintir.OperType{Args: []quintir.Type{msg, storage}, Res: tuple(&quintir.StrType{}, storage)},
+			err:  "no conversion of str into a response is known, the result of instantiate must be one of NeutronResult, StdResult",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tr := newTranslator(&quintir.Output{})
+			g := &glue{t: tr, typeModules: make(map[string]string), imports: make(map[string]map[string]bool)}
+			def := &quintir.OpDef{ID: 1, Name: test.kind.name, Qualifier: "puredef", TypeAnnotation: test.typ}
+			g.entryPoint(test.kind, def)
+			if len(tr.diagnostics) != 1 || !strings.Contains(tr.diagnostics[0].Message, test.err) {
+				t.Errorf("got the problems %v, want one containing %q", tr.diagnostics, test.err)
+			}
+		})
+	}
+}
+
+func TestCamelCase(t *testing.T) {
+	tests := map[string]string{
+		"send":           "Send",
+		"transfer_funds": "TransferFunds",
+		"_private":       "Private",
+	}
+	for name, want := range tests {
+		if got := camelCase(name); got != want {
+			t.Errorf("%s: got %s, want %s", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"piwasm/quintir"
+)
+
+// the invariants of the model are vals of the _test module. those that only read the ContractStorage are
+// properties of the contract itself, and can be checked by it after every entry point.
+// the others also read variables that only exist in the tests, like transferSenders, and are left out.
+
+// storageVar returns the state variable of the module that holds the ContractStorage, or nil if there is none
+func storageVar(module *quintir.Module) *quintir.Var {
+	for _, decl := range module.Declarations {
+		if v, ok := decl.(*quintir.Var); ok && typeName(v.TypeAnnotation) == storageTypeName {
+			return v
+		}
+	}
+	return nil
+}
+
+// resolveInvariants translates the invariants of the _test module that only read the storage into predicates.
+// it also returns the names of the invariants that read other state variables, which cannot be translated.
+func (t *translator) resolveInvariants(module *quintir.Module) (predicates []*FunctionDecl, skipped []string) {
+	storage := storageVar(module)
+	if storage == nil {
+		t.context = declContext{module: module.Name}
+		t.errorf(nil, "the module has no state variable of type %s, so it has no invariants of the contract", storageTypeName)
+		return nil, nil
+	}
+
+	for _, decl := range module.Declarations {
+		def, ok := decl.(*quintir.OpDef)
+		if !ok || def.Qualifier != "val" {
+			continue
+		}
+		vars, ok := t.readVars(def)
+		if !ok {
+			continue
+		}
+		if len(vars) != 1 || vars[0] != storage.Name {
+			skipped = append(skipped, def.Name)
+			continue
+		}
+
+		t.enter(module.Name, def)
+		block := t.resolveBlock(def.Expr, &BoolType{})
+		predicate := &FunctionDecl{
+			Name:       def.Name,
+			Params:     []Param{{Name: storage.Name, Type: t.resolveType(storage.TypeAnnotation)}},
+			ReturnType: &BoolType{},
+			Body:       block.Statements,
+		}
+		t.setOrigin(predicate, def)
+		predicates = append(predicates, predicate)
+	}
+	return predicates, skipped
+}
+
+// readVars returns the state variables that def reads. it returns false if def does more than reading them,
+// like updating them or depending on them temporally, since then it is not an invariant.
+func (t *translator) readVars(def *quintir.OpDef) ([]string, bool) {
+	scheme, ok := t.ir.Effects[def.ID]
+	if !ok {
+		return nil, false
+	}
+	effect, ok := scheme.Effect.(*quintir.ConcreteEffect)
+	if !ok {
+		return nil, false
+	}
+
+	var vars []string
+	for _, component := range effect.Components {
+		if component.Kind != "read" {
+			return nil, false
+		}
+		names, ok := entityVars(component.Entity)
+		if !ok {
+			return nil, false
+		}
+		for _, name := range names {
+			if !contains(vars, name) {
+				vars = append(vars, name)
+			}
+		}
+	}
+	return vars, len(vars) > 0
+}
+
+// entityVars returns the state variables of an entity, or false if they are not known
+func entityVars(entity quintir.Entity) ([]string, bool) {
+	switch e := entity.(type) {
+	case *quintir.ConcreteEntity:
+		names := make([]string, len(e.StateVariables))
+		for i, v := range e.StateVariables {
+			names[i] = v.Name
+		}
+		return names, true
+	case *quintir.EntityUnion:
+		var names []string
+		for _, inner := range e.Entities {
+			innerNames, ok := entityVars(inner)
+			if !ok {
+				return nil, false
+			}
+			names = append(names, innerNames...)
+		}
+		return names, true
+	}
+	return nil, false
+}
+
+// invariantChecks generates check_invariants, which the entry points call with the new storage before saving it.
+// the invariants are only checked in debug builds, which include the tests, so they cost no gas when deployed.
+func (g *glue) invariantChecks() []Decl {
+	storageParam := Param{Name: "storage", Type: &TypeRef{OfType: &ConstType{Name: storageTypeName}}}
+	ok := &Return{Value: &FunctionCall{FunctionName: "Ok", Arguments: []Expr{&Tuple{}}}}
+	returnType := &TypeCons{Name: "StdResult", Params: []Type{&TupleType{}}}
+
+	var checks []Stmt
+	for _, invariant := range g.invariants {
+		holds := &FunctionCall{
+			FunctionName: g.contractModule + "::" + invariant,
+			Arguments:    []Expr{&MethodCall{Value: &Variable{VariableName: "storage"}, MethodName: "clone"}},
+		}
+		violated := &FunctionCall{
+			FunctionName: "StdError::generic_err",
+			Arguments:    []Expr{&StringLiteral{Value: "invariant " + invariant + " is violated"}},
+		}
+		checks = append(checks, &ExprStmt{Value: &Macro{Name: "ensure", Args: []Expr{holds, violated}}})
+	}
+
+	return []Decl{
+		&FunctionDecl{
+			Name:       "check_invariants",
+			Params:     []Param{storageParam},
+			ReturnType: returnType,
+			Body:       append(checks, ok),
+			Attrs:      []string{"cfg(debug_assertions)"},
+		},
+		&FunctionDecl{
+			Name:       "check_invariants",
+			Params:     []Param{{Name: "_storage", Type: storageParam.Type}},
+			ReturnType: returnType,
+			Body:       []Stmt{ok},
+			Attrs:      []string{"cfg(not(debug_assertions))"},
+		},
+	}
+}
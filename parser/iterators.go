@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+
+	"piwasm/quintir"
+)
+
+// the higher-order operators on collections, like `S.map(x => x + 1)`, become iterator chains,
+// `s.iter().cloned().map(|x| x + 1_u64).collect::<HashSet::<u64>>()`. the elements are cloned out of the
+// collection, so the closures get them by value like in quint. the collection that is collected into is the one
+// of the type of the expression. the closures that return the errors of checked arithmetic are mapped and
+// collected into a Result, or folded with try_fold, so that the first error is returned.
+
+// resolveIterator translates an application of a higher-order operator on a collection
+func (t *translator) resolveIterator(e *quintir.App, exprType Type) Expr {
+	args := e.Args
+	want := map[string]int{
+		"map": 2, "filter": 2, "select": 2, "exists": 2, "forall": 2, "mapBy": 2,
+		"fold": 3, "foldl": 3, "foldr": 3, "setToMap": 1,
+	}[e.Opcode]
+	if len(args) != want {
+		t.errorf(e, "%s expects %d arguments, got %d", e.Opcode, want, len(args))
+		return newTodo()
+	}
+
+	items := t.iterate(args[0])
+	switch e.Opcode {
+	case "map":
+		closure := t.iteratorClosure(args[1], 1)
+		if closure == nil {
+			return newTodo()
+		}
+		if closure.Fallible {
+			closure.Body = closureOk(closure.Body)
+			return t.tryCollect(e, exprType, &MethodCall{Value: items, MethodName: "map", Arguments: []Expr{closure}})
+		}
+		return t.collect(e, exprType, &MethodCall{Value: items, MethodName: "map", Arguments: []Expr{closure}})
+
+	case "filter", "select":
+		closure := t.iteratorClosure(args[1], 1)
+		if closure == nil {
+			return newTodo()
+		}
+		param := closure.Params[0]
+		if closure.Fallible {
+			// the elements are paired with whether they are kept, and the pairs are collected to return the
+			// first error before the elements are filtered
+			element := &MethodCall{Value: &Variable{VariableName: param}, MethodName: "clone"}
+			closure.Body = closureOk(&Tuple{Values: []Expr{element, closure.Body}})
+			pairs := &MethodCall{Value: items, MethodName: "map", Arguments: []Expr{closure}}
+			collected := &MethodCall{Value: pairs, MethodName: "collect", TypeArgs: []Type{resultType(&TypeCons{Name: "Vec", Params: []Type{WildcardType}})}}
+			kept := &Closure{Params: []string{"(__x, __keep)"}, Body: &MethodCall{Value: &Variable{VariableName: "__keep"}, MethodName: "then_some", Arguments: []Expr{&Variable{VariableName: "__x"}}}}
+			items = &MethodCall{Value: &MethodCall{Value: t.propagate(collected), MethodName: "into_iter"}, MethodName: "filter_map", Arguments: []Expr{kept}}
+			return t.collect(e, exprType, items)
+		}
+		// filter passes references to the elements, which the closure clones to get them by value
+		closure.Body = &Let{VariableName: param, Value: &MethodCall{Value: &Variable{VariableName: param}, MethodName: "clone"}, Body: closure.Body}
+		return t.collect(e, exprType, &MethodCall{Value: items, MethodName: "filter", Arguments: []Expr{closure}})
+
+	case "exists", "forall":
+		method := "any"
+		if e.Opcode == "forall" {
+			method = "all"
+		}
+		closure := t.iteratorClosure(args[1], 1)
+		if closure == nil {
+			return newTodo()
+		}
+		if closure.Fallible {
+			// the result so far is folded with the operator that any and all apply, which stops evaluating the
+			// closure once the result is known
+			op, initial := "||", false
+			if e.Opcode == "forall" {
+				op, initial = "&&", true
+			}
+			closure.Params = append([]string{"__result"}, closure.Params...)
+			closure.Body = closureOk(&BinaryOp{Op: op, Left: &Variable{VariableName: "__result", Copy: true}, Right: closure.Body})
+			return t.propagate(&MethodCall{Value: items, MethodName: "try_fold", Arguments: []Expr{&BoolLiteral{Value: initial}, closure}})
+		}
+		return &MethodCall{Value: items, MethodName: method, Arguments: []Expr{closure}}
+
+	case "fold", "foldl", "foldr":
+		closure := t.iteratorClosure(args[2], 2)
+		if closure == nil {
+			return newTodo()
+		}
+		if e.Opcode == "foldr" {
+			// foldr goes from the end, and passes the element before the accumulator
+			items = &MethodCall{Value: items, MethodName: "rev"}
+			closure.Params[0], closure.Params[1] = closure.Params[1], closure.Params[0]
+		}
+		initial := t.resolveExpr(args[1], exprType)
+		if closure.Fallible {
+			closure.Body = closureOk(closure.Body)
+			return t.propagate(&MethodCall{Value: items, MethodName: "try_fold", Arguments: []Expr{initial, closure}})
+		}
+		return &MethodCall{Value: items, MethodName: "fold", Arguments: []Expr{initial, closure}}
+
+	case "mapBy":
+		// the keys are the elements, and the values what the closure returns for them
+		closure := t.iteratorClosure(args[1], 1)
+		if closure == nil {
+			return newTodo()
+		}
+		key := &MethodCall{Value: &Variable{VariableName: closure.Params[0]}, MethodName: "clone"}
+		closure.Body = &Tuple{Values: []Expr{key, closure.Body}}
+		if closure.Fallible {
+			closure.Body = closureOk(closure.Body)
+			return t.tryCollect(e, exprType, &MethodCall{Value: items, MethodName: "map", Arguments: []Expr{closure}})
+		}
+		return t.collect(e, exprType, &MethodCall{Value: items, MethodName: "map", Arguments: []Expr{closure}})
+
+	case "setToMap":
+		// the elements are already the pairs of keys and values
+		return t.collect(e, exprType, items)
+	}
+	t.errorf(e, "app opcode not supported for resolving expr: %s", e.Opcode)
+	return newTodo()
+}
+
+// resolveSize translates the size of a set or the length of a list, which is a usize in rust
+func (t *translator) resolveSize(e *quintir.App) Expr {
+	if len(e.Args) != 1 {
+		t.errorf(e, "%s expects 1 argument, got %d", e.Opcode, len(e.Args))
+		return newTodo()
+	}
+	return t.fromUsize(&MethodCall{Value: t.resolveExpr(e.Args[0], nil), MethodName: "len"})
+}
+
+// iterate returns an iterator over the cloned elements of a collection
+func (t *translator) iterate(collection quintir.Expr) Expr {
+	value := t.resolveExpr(collection, nil)
+	return &MethodCall{Value: &MethodCall{Value: value, MethodName: "iter"}, MethodName: "cloned"}
+}
+
+// collect collects the items into the collection of the type of e
+func (t *translator) collect(e *quintir.App, exprType Type, items Expr) Expr {
+	if !isKnown(exprType) {
+		exprType = t.typeOf(e)
+	}
+	var collection Type
+	switch c := exprType.(type) {
+	case *SetType:
+		collection = &SetType{ElementType: orWildcard(c.ElementType)}
+	case *MapType:
+		collection = &MapType{Key: orWildcard(c.Key), Value: orWildcard(c.Value)}
+	case *ListType:
+		collection = &ListType{ElementType: orWildcard(c.ElementType)}
+	default:
+		t.errorf(e, "the collection that %s returns is not known", e.Opcode)
+		return newTodo()
+	}
+	return &MethodCall{Value: items, MethodName: "collect", TypeArgs: []Type{collection}}
+}
+
+// orWildcard returns typ if it is known, and otherwise _ for rust to infer it
+func orWildcard(typ Type) Type {
+	if isKnown(typ) {
+		return typ
+	}
+	return WildcardType
+}
+
+// tryCollect collects the results of a fallible closure into a Result of the collection of the type of e,
+// returning the first error
+func (t *translator) tryCollect(e *quintir.App, exprType Type, results Expr) Expr {
+	collected, ok := t.collect(e, exprType, results).(*MethodCall)
+	if !ok {
+		// collect already reported the problem
+		return newTodo()
+	}
+	collected.TypeArgs = []Type{resultType(collected.TypeArgs[0])}
+	return t.propagate(collected)
+}
+
+// iteratorClosure translates the operator passed to a higher-order operator into a closure with the given
+// number of parameters. an operator that is passed by name, like `S.map(double)`, is called by a closure.
+// the closure is fallible if the function around it returns the errors of checked arithmetic and the operator
+// can fail. it returns nil after reporting a problem.
+func (t *translator) iteratorClosure(operator quintir.Expr, params int) *Closure {
+	if lambda, ok := operator.(*quintir.Lambda); ok {
+		if len(lambda.Params) != params {
+			t.errorf(lambda, "expected an operator with %d parameters, got %d", params, len(lambda.Params))
+			return nil
+		}
+		return t.resolveClosure(lambda, false, t.propagates && t.canFail(lambda.Expr))
+	}
+	name, ok := operator.(*quintir.Name)
+	if !ok {
+		t.errorf(operator, "expected an operator, got %s", operator.Kind())
+		return nil
+	}
+	closure := &Closure{}
+	var arguments []Expr
+	for i := 0; i < params; i++ {
+		param := fmt.Sprintf("__x%d", i)
+		closure.Params = append(closure.Params, param)
+		arguments = append(arguments, &Variable{VariableName: param})
+	}
+	var call Expr = &FunctionCall{FunctionName: name.Name, Arguments: arguments}
+	if lookup := t.ir.Lookup(name.ID); lookup != nil {
+		if def, ok := lookup.Def.(*quintir.OpDef); ok {
+			propagates := t.propagates
+			closure.Fallible = propagates && t.fallible[def.ID]
+			t.propagates = closure.Fallible
+			call = t.fallibleCall(def, call)
+			t.propagates = propagates
+		}
+	}
+	closure.Body = call
+	return closure
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"piwasm/quintir"
+)
+
+func TestIterators(t *testing.T) {
+	integer, boolean := &quintir.IntType{}, &quintir.BoolType{}
+	set := &quintir.SetType{Elem: integer}
+	list := &quintir.ListType{Elem: integer}
+	// s is a set and l a list of integers
+	tests := []struct {
+		name string
+		expr func(b *exprBuilder, s, l *quintir.Param) quintir.Expr
+		want string
+		// a part of the problem that is reported, if any
+		err string
+	}{
+		{
+			name: "map",
+			expr: func(b *exprBuilder, s, l *quintir.Param) quintir.Expr {
+				x := b.param("x", integer)
+				return b.app("map", set, b.use(s, set), b.lambda([]*quintir.Param{x}, b.app("iadd", integer, b.use(x, integer), b.int(1))))
+			},
+			want: "s.iter().cloned().map(|x| x + 1_u64).collect::<HashSet::<u64>>()",
+		},
+		{
+			name: "filter",
+			expr: func(b *exprBuilder, s, l *quintir.Param) quintir.Expr {
+				x := b.param("x", integer)
+				return b.app("filter", list, b.use(l, list), b.lambda([]*quintir.Param{x}, b.app("igt", boolean, b.use(x, integer), b.int(1))))
+			},
+			want: "l.iter().cloned().filter(|x| {\n    let x = x.clone();\nx > 1_u64\n}).collect::<Vector::<u64>>()",
+		},
+		{
+			name: "exists",
+			expr: func(b *exprBuilder, s, l *quintir.Param) quintir.Expr {
+				x := b.param("x", integer)
+				return b.app("exists", boolean, b.use(s, set), b.lambda([]*quintir.Param{x}, b.app("igt", boolean, b.use(x, integer), b.int(1))))
+			},
+			want: "s.iter().cloned().any(|x| x > 1_u64)",
+		},
+		{
+			name: "foldr",
+			expr: func(b *exprBuilder, s, l *quintir.Param) quintir.Expr {
+				x, sum := b.param("x", integer), b.param("sum", integer)
+				add := b.app("iadd", integer, b.use(sum, integer), b.use(x, integer))
+				return b.app("foldr", integer, b.use(l, list), b.int(0), b.lambda([]*quintir.Param{x, sum}, add))
+			},
+			want: "l.iter().cloned().rev().fold(0_u64, |sum, x| sum + x)",
+		},
+		{
+			name: "mapBy",
+			expr: func(b *exprBuilder, s, l *quintir.Param) quintir.Expr {
+				x := b.param("x", integer)
+				return b.app("mapBy", &quintir.FunType{Arg: integer, Res: integer}, b.use(s, set), b.lambda([]*quintir.Param{x}, b.use(x, integer)))
+			},
+			want: "s.iter().cloned().map(|x| (x.clone(), x)).collect::<HashMap::<u64, u64>>()",
+		},
+		{
+			name: "operator passed by name",
+			expr: func(b *exprBuilder, s, l *quintir.Param) quintir.Expr {
+				return b.app("map", set, b.use(s, set), b.name("double", &quintir.OperType{Args: []quintir.Type{integer}, Res: integer}))
+			},
+			want: "s.iter().cloned().map(|__x0| double(__x0)).collect::<HashSet::<u64>>()",
+		},
+		{
+			name: "size",
+			expr: func(b *exprBuilder, s, l *quintir.Param) quintir.Expr { return b.app("size", integer, b.use(s, set)) },
+			want: "u64::try_from(s.len()).unwrap()",
+		},
+		{
+			name: "operator with the wrong number of parameters",
+			expr: func(b *exprBuilder, s, l *quintir.Param) quintir.Expr {
+				x, y := b.param("x", integer), b.param("y", integer)
+				return b.app("map", set, b.use(s, set), b.lambda([]*quintir.Param{x, y}, b.use(x, integer)))
+			},
+			err: "expected an operator with 1 parameters, got 2",
+		},
+		{
+			name: "unknown collection",
+			expr: func(b *exprBuilder, s, l *quintir.Param) quintir.Expr {
+				x := b.param("x", integer)
+				return b.app("map", nil, b.use(s, set), b.lambda([]*quintir.Param{x}, b.use(x, integer)))
+			},
+			err: "the collection that map returns is not known",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ir := &quintir.Output{}
+			b := newExprBuilder(ir)
+			s, l := b.param("s", set), b.param("l", list)
+			expr := test.expr(b, s, l)
+			tr := newTranslator(ir)
+			got := rust(tr.resolveExpr(expr, nil))
+			if test.err != "" {
+				if len(tr.diagnostics) != 1 || !strings.Contains(tr.diagnostics[0].Message, test.err) {
+					t.Errorf("got the problems %v, want one containing %q", tr.diagnostics, test.err)
+				}
+				return
+			}
+			if len(tr.diagnostics) > 0 {
+				t.Errorf("got the problems %v", tr.diagnostics)
+			}
+			if got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+// TestFallibleIterators checks that the overflows of checked arithmetic in the closures of the higher-order
+// operators are returned from the function around them, or panic where there is no result to return them with
+func TestFallibleIterators(t *testing.T) {
+	integer, boolean := &quintir.IntType{}, &quintir.BoolType{}
+	set := &quintir.SetType{Elem: integer}
+	overflow := ".ok_or(cosmwasm_std::StdError::overflow(cosmwasm_std::OverflowError::new(cosmwasm_std::OverflowOperation::Add)))"
+	tests := []struct {
+		name   string
+		opcode string
+		typ    quintir.Type
+		// if the function around the operator returns errors
+		propagates bool
+		want       string
+	}{
+		{
+			name:       "map",
+			opcode:     "map",
+			typ:        set,
+			propagates: true,
+			want:       "s.iter().cloned().map(|x| Ok::<_, cosmwasm_std::StdError>(x.checked_add(1_u64)OVERFLOW?)).collect::<Result<HashSet::<u64>, cosmwasm_std::StdError>>()?",
+		},
+		{
+			name:       "filter",
+			opcode:     "filter",
+			typ:        set,
+			propagates: true,
+			want:       "s.iter().cloned().map(|x| Ok::<_, cosmwasm_std::StdError>((x.clone(), x.checked_add(1_u64)OVERFLOW? > 2_u64))).collect::<Result<Vec<_>, cosmwasm_std::StdError>>()?.into_iter().filter_map(|(__x, __keep)| __keep.then_some(__x)).collect::<HashSet::<u64>>()",
+		},
+		{
+			name:       "exists",
+			opcode:     "exists",
+			typ:        boolean,
+			propagates: true,
+			want:       "s.iter().cloned().try_fold(false, |__result, x| Ok::<_, cosmwasm_std::StdError>(__result || x.checked_add(1_u64)OVERFLOW? > 2_u64))?",
+		},
+		{
+			name:       "fold",
+			opcode:     "fold",
+			typ:        integer,
+			propagates: true,
+			want:       "s.iter().cloned().try_fold(0_u64, |sum, x| Ok::<_, cosmwasm_std::StdError>(sum.checked_add(x)OVERFLOW?))?",
+		},
+		{
+			name:   "map without a result",
+			opcode: "map",
+			typ:    set,
+			want:   "s.iter().cloned().map(|x| x.checked_add(1_u64)OVERFLOW.unwrap()).collect::<HashSet::<u64>>()",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ir := &quintir.Output{}
+			b := newExprBuilder(ir)
+			s := b.param("s", set)
+			x := b.param("x", integer)
+			var expr quintir.Expr
+			switch test.opcode {
+			case "fold":
+				sum := b.param("sum", integer)
+				add := b.app("iadd", integer, b.use(sum, integer), b.use(x, integer))
+				expr = b.app("fold", integer, b.use(s, set), b.int(0), b.lambda([]*quintir.Param{sum, x}, add))
+			case "map":
+				expr = b.app("map", set, b.use(s, set), b.lambda([]*quintir.Param{x}, b.app("iadd", integer, b.use(x, integer), b.int(1))))
+			default:
+				sum := b.app("iadd", integer, b.use(x, integer), b.int(1))
+				expr = b.app(test.opcode, test.typ, b.use(s, set), b.lambda([]*quintir.Param{x}, b.app("igt", boolean, sum, b.int(2))))
+			}
+			tr := newTranslator(ir)
+			tr.arithmetic = "checked"
+			tr.propagates = test.propagates
+			// the indentation is left to rustfmt
+			got := strings.Join(strings.Fields(rust(tr.resolveExpr(expr, nil))), " ")
+			if len(tr.diagnostics) > 0 {
+				t.Errorf("got the problems %v", tr.diagnostics)
+			}
+			if want := strings.ReplaceAll(test.want, "OVERFLOW", overflow); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
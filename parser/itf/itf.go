@@ -0,0 +1,256 @@
+// Package itf decodes traces in the Informal Trace Format, as written by `quint run --out-itf`,
+// into typed Go values.
+//
+// ITF encodes the values of the model in JSON, using special objects for the values JSON cannot express:
+// `{"#bigint": "123"}`, `{"#set": [...]}`, `{"#map": [[k, v], ...]}`, `{"#tup": [...]}` and
+// `{"#unserializable": "..."}`. Any other object is a record, and arrays are lists.
+package itf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+)
+
+// Trace is a sequence of states of the model
+type Trace struct {
+	// the names of the state variables
+	Vars   []string
+	States []State
+}
+
+// State maps the state variables, and the mbt::* variables written by `quint run --mbt`, to their values
+type State map[string]Value
+
+// the variables written by `quint run --mbt`, with the action that led to a state and the nondeterministic
+// values it picked
+const (
+	ActionTaken = "mbt::actionTaken"
+	NondetPicks = "mbt::nondetPicks"
+)
+
+// Load reads and decodes the trace stored at path.
+func Load(path string) (*Trace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes a trace from its JSON representation.
+func Parse(data []byte) (*Trace, error) {
+	var raw struct {
+		Vars   []string                     `json:"vars"`
+		States []map[string]json.RawMessage `json:"states"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	trace := &Trace{Vars: raw.Vars}
+	for i, rawState := range raw.States {
+		state := make(State, len(rawState))
+		for name, rawValue := range rawState {
+			if name == "#meta" {
+				continue
+			}
+			value, err := decodeValue(rawValue)
+			if err != nil {
+				return nil, fmt.Errorf("state %d, variable %s: %w", i, name, err)
+			}
+			state[name] = value
+		}
+		trace.States = append(trace.States, state)
+	}
+	return trace, nil
+}
+
+// Action returns the name of the action that led to the state, or "" if the trace does not record it
+func (s State) Action() string {
+	if action, ok := s[ActionTaken].(Str); ok {
+		return string(action)
+	}
+	return ""
+}
+
+// Pick returns the value the action that led to the state picked for the nondeterministic val with the given name
+func (s State) Pick(name string) (Value, bool) {
+	picks, ok := s[NondetPicks].(Record)
+	if !ok {
+		return nil, false
+	}
+	value, ok := picks[name]
+	if !ok {
+		return nil, false
+	}
+	// newer quint versions wrap the picks into an option, the value is None if the action did not pick one
+	if variant, ok := value.(Record); ok && len(variant) == 2 && variant["tag"] != nil && variant["value"] != nil {
+		switch variant["tag"] {
+		case Str("Some"):
+			return variant["value"], true
+		case Str("None"):
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// Value is a value of the model
+type Value interface {
+	Kind() string
+}
+
+type (
+	Bool bool
+	Str  string
+	Int  struct {
+		Value *big.Int
+	}
+	List []Value
+	Tup  []Value
+	Set  []Value
+	Map  []MapEntry
+	// a record, or a variant of a sum type, which has the fields tag and value
+	Record map[string]Value
+	// a value that quint could not write, like an infinite set
+	Unserializable string
+)
+
+type MapEntry struct {
+	Key, Value Value
+}
+
+func (Bool) Kind() string           { return "bool" }
+func (Str) Kind() string            { return "str" }
+func (Int) Kind() string            { return "int" }
+func (List) Kind() string           { return "list" }
+func (Tup) Kind() string            { return "tup" }
+func (Set) Kind() string            { return "set" }
+func (Map) Kind() string            { return "map" }
+func (Record) Kind() string         { return "record" }
+func (Unserializable) Kind() string { return "unserializable" }
+
+// Fields returns the names of the fields of the record in sorted order
+func (r Record) Fields() []string {
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func decodeValue(data []byte) (Value, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+
+	switch data[0] {
+	case 't', 'f':
+		var b bool
+		err := json.Unmarshal(data, &b)
+		return Bool(b), err
+	case '"':
+		var s string
+		err := json.Unmarshal(data, &s)
+		return Str(s), err
+	case '[':
+		items, err := decodeValues(data)
+		return List(items), err
+	case '{':
+		return decodeObject(data)
+	default:
+		// small integers may be written as plain numbers
+		n, ok := new(big.Int).SetString(string(data), 10)
+		if !ok {
+			return nil, fmt.Errorf("not a value: %s", data)
+		}
+		return Int{Value: n}, nil
+	}
+}
+
+func decodeValues(data []byte) ([]Value, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	values := make([]Value, len(raw))
+	for i, item := range raw {
+		value, err := decodeValue(item)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func decodeObject(data []byte) (Value, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 1 {
+		for key, raw := range fields {
+			switch key {
+			case "#bigint":
+				var s string
+				if err := json.Unmarshal(raw, &s); err != nil {
+					return nil, err
+				}
+				n, ok := new(big.Int).SetString(s, 10)
+				if !ok {
+					return nil, fmt.Errorf("not an integer: %s", s)
+				}
+				return Int{Value: n}, nil
+			case "#tup":
+				items, err := decodeValues(raw)
+				return Tup(items), err
+			case "#set":
+				items, err := decodeValues(raw)
+				return Set(items), err
+			case "#map":
+				var entries [][2]json.RawMessage
+				if err := json.Unmarshal(raw, &entries); err != nil {
+					return nil, err
+				}
+				m := make(Map, len(entries))
+				for i, entry := range entries {
+					key, err := decodeValue(entry[0])
+					if err != nil {
+						return nil, err
+					}
+					value, err := decodeValue(entry[1])
+					if err != nil {
+						return nil, err
+					}
+					m[i] = MapEntry{Key: key, Value: value}
+				}
+				return m, nil
+			case "#unserializable":
+				var s string
+				err := json.Unmarshal(raw, &s)
+				return Unserializable(s), err
+			}
+		}
+	}
+
+	record := make(Record, len(fields))
+	for name, raw := range fields {
+		if name == "#meta" {
+			continue
+		}
+		value, err := decodeValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
+		}
+		record[name] = value
+	}
+	return record, nil
+}
@@ -0,0 +1,125 @@
+package itf
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func integer(n int64) Int {
+	return Int{Value: big.NewInt(n)}
+}
+
+func TestDecodeValue(t *testing.T) {
+	huge, _ := new(big.Int).SetString("340282366920938463463374607431768211456", 10)
+	tests := []struct {
+		name string
+		json string
+		want Value
+		// a part of the error, if decoding fails
+		err string
+	}{
+		{name: "bool", json: `true`, want: Bool(true)},
+		{name: "string", json: `"alice"`, want: Str("alice")},
+		{name: "plain integer", json: `42`, want: integer(42)},
+		{name: "big integer", json: `{"#bigint": "340282366920938463463374607431768211456"}`, want: Int{Value: huge}},
+		{name: "negative integer", json: `{"#bigint": "-3"}`, want: integer(-3)},
+		{name: "list", json: `[1, 2]`, want: List{integer(1), integer(2)}},
+		{name: "tuple", json: `{"#tup": ["a", true]}`, want: Tup{Str("a"), Bool(true)}},
+		{name: "set", json: `{"#set": []}`, want: Set{}},
+		{
+			name: "map",
+			json: `{"#map": [[{"#bigint": "1"}, "alice"]]}`,
+			want: Map{{Key: integer(1), Value: Str("alice")}},
+		},
+		{
+			name: "record",
+			json: `{"denom": "untrn", "amount": {"#bigint": "3"}}`,
+			want: Record{"denom": Str("untrn"), "amount": integer(3)},
+		},
+		{name: "record with one field", json: `{"id": 1}`, want: Record{"id": integer(1)}},
+		{name: "unserializable", json: `{"#unserializable": "Int"}`, want: Unserializable("Int")},
+		{name: "bad integer", json: `{"#bigint": "1e3"}`, err: "not an integer: 1e3"},
+		{name: "bad field", json: `{"a": {"#bigint": 3}}`, err: "field a:"},
+		{name: "empty", json: ``, err: "empty value"},
+		{name: "null", json: `null`, err: "not a value: null"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := decodeValue([]byte(test.json))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+const trace = `{
+	"#meta": {"format": "ITF"},
+	"vars": ["n", "mbt::actionTaken", "mbt::nondetPicks"],
+	"states": [
+		{"#meta": {"index": 0}, "n": {"#bigint": "0"}, "mbt::actionTaken": "init", "mbt::nondetPicks": {}},
+		{"#meta": {"index": 1}, "n": {"#bigint": "3"}, "mbt::actionTaken": "step",
+			"mbt::nondetPicks": {"by": {"tag": "Some", "value": {"#bigint": "3"}}, "other": {"tag": "None", "value": {"#tup": []}}}},
+		{"#meta": {"index": 2}, "n": {"#bigint": "4"}, "mbt::actionTaken": "step", "mbt::nondetPicks": {"by": 1}}
+	]
+}`
+
+func TestParse(t *testing.T) {
+	parsed, err := Parse([]byte(trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed.Vars, []string{"n", ActionTaken, NondetPicks}) {
+		t.Errorf("got the variables %v", parsed.Vars)
+	}
+	if len(parsed.States) != 3 {
+		t.Fatalf("got %d states, want 3", len(parsed.States))
+	}
+	if _, ok := parsed.States[0]["#meta"]; ok {
+		t.Errorf("the #meta of a state is a variable")
+	}
+
+	tests := []struct {
+		name  string
+		state State
+		pick  string
+		want  Value
+		found bool
+	}{
+		{name: "pick wrapped in Some", state: parsed.States[1], pick: "by", want: integer(3), found: true},
+		{name: "pick that is None", state: parsed.States[1], pick: "other"},
+		{name: "pick of an older quint version", state: parsed.States[2], pick: "by", want: integer(1), found: true},
+		{name: "no pick", state: parsed.States[2], pick: "other"},
+		{name: "no picks at all", state: State{}, pick: "by"},
+	}
+	for _, test := range tests {
+		got, found := test.state.Pick(test.pick)
+		if found != test.found || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %#v (found: %v), want %#v (found: %v)", test.name, got, found, test.want, test.found)
+		}
+	}
+	if action := parsed.States[1].Action(); action != "step" {
+		t.Errorf("got the action %q, want step", action)
+	}
+	if action := (State{}).Action(); action != "" {
+		t.Errorf("got the action %q of a state without one", action)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse([]byte(`{"vars": ["n"], "states": [{"n": {"#bigint": "x"}}]}`))
+	if err == nil || !strings.Contains(err.Error(), "state 0, variable n: not an integer: x") {
+		t.Errorf("got error %v", err)
+	}
+}
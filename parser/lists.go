@@ -0,0 +1,105 @@
+package main
+
+import (
+	"piwasm/quintir"
+)
+
+// lists are im::Vector, which shares its structure between copies like the other collections of im,
+// so the list operators that build new lists are cheap: append and concat add vectors, tail and slice
+// skip and take elements, and replaceAt updates a copy.
+
+// resolveList translates an operator on lists
+func (t *translator) resolveList(e *quintir.App, exprType Type) Expr {
+	args := e.Args
+	want := map[string]int{
+		"nth": 2, "append": 2, "concat": 2, "head": 1, "tail": 1, "slice": 3, "indices": 1, "replaceAt": 3, "range": 2,
+	}[e.Opcode]
+	if len(args) != want {
+		t.errorf(e, "%s expects %d arguments, got %d", e.Opcode, want, len(args))
+		return newTodo()
+	}
+
+	if e.Opcode == "range" {
+		// the list of the integers from the first up to the second, which is exclusive
+		if _, big := t.intType().(*BigUintType); big {
+			t.errorf(e, "ranges of %s are not supported, since rust cannot iterate over them", printNode(t.intType(), 0))
+			return newTodo()
+		}
+		from := t.resolveExpr(args[0], t.intType())
+		to := t.resolveExpr(args[1], t.intType())
+		return &MethodCall{Value: &BinaryOp{Op: "..", Left: from, Right: to}, MethodName: "collect", TypeArgs: []Type{&ListType{ElementType: WildcardType}}}
+	}
+
+	list := t.resolveExpr(args[0], listType(exprType))
+	switch e.Opcode {
+	case "nth":
+		element := &MethodCall{Value: list, MethodName: "get", Arguments: []Expr{t.index(args[1])}}
+		return &MethodCall{Value: &MethodCall{Value: element, MethodName: "unwrap"}, MethodName: "clone"}
+
+	case "append":
+		element := t.resolveExpr(args[1], elementType(exprType, 0))
+		return &BinaryOp{Op: "+", Left: list, Right: &Macro{Name: "im::vector", Args: []Expr{element}}}
+
+	case "concat":
+		return &BinaryOp{Op: "+", Left: list, Right: t.resolveExpr(args[1], listType(exprType))}
+
+	case "head":
+		head := &MethodCall{Value: list, MethodName: "head"}
+		return &MethodCall{Value: &MethodCall{Value: head, MethodName: "unwrap"}, MethodName: "clone"}
+
+	case "tail":
+		return &MethodCall{Value: list, MethodName: "skip", Arguments: []Expr{&UntypedLiteral{Value: "1"}}}
+
+	case "slice":
+		// the elements from the start up to the end, which is exclusive
+		start, end := t.index(args[1]), t.index(args[2])
+		skipped := &MethodCall{Value: list, MethodName: "skip", Arguments: []Expr{start}}
+		return &MethodCall{Value: skipped, MethodName: "take", Arguments: []Expr{&BinaryOp{Op: "-", Left: end, Right: t.index(args[1])}}}
+
+	case "indices":
+		// the set of the indices, as integers of the model
+		index := &Closure{Params: []string{"i"}, Body: t.fromUsize(&Variable{VariableName: "i"})}
+		length := &MethodCall{Value: list, MethodName: "len"}
+		indices := &MethodCall{Value: &BinaryOp{Op: "..", Left: &UntypedLiteral{Value: "0"}, Right: length}, MethodName: "map", Arguments: []Expr{index}}
+		return &MethodCall{Value: indices, MethodName: "collect", TypeArgs: []Type{&SetType{ElementType: WildcardType}}}
+
+	case "replaceAt":
+		element := t.resolveExpr(args[2], elementType(exprType, 0))
+		return &MethodCall{Value: list, MethodName: "update", Arguments: []Expr{t.index(args[1]), element}}
+	}
+	t.errorf(e, "app opcode not supported for resolving expr: %s", e.Opcode)
+	return newTodo()
+}
+
+// listType returns typ if it is a list, and a list of unknown elements otherwise
+func listType(typ Type) Type {
+	if list, ok := typ.(*ListType); ok {
+		return list
+	}
+	return &ListType{ElementType: WildcardType}
+}
+
+// index translates an integer of the model into the usize that rust indexes with, panicking if it does not fit
+func (t *translator) index(expr quintir.Expr) Expr {
+	value := t.resolveExpr(expr, t.intType())
+	switch intType := t.intType().(type) {
+	case *BigUintType:
+		// the cosmwasm integers only convert into u128, through Uint128
+		if intType.Name != "Uint128" {
+			value = &MethodCall{Value: &StaticMethodCall{TypeName: &BigUintType{Name: "Uint128"}, MethodName: "try_from", Arguments: []Expr{value}}, MethodName: "unwrap"}
+		}
+		value = &MethodCall{Value: value, MethodName: "u128"}
+	}
+	return &MethodCall{Value: &StaticMethodCall{TypeName: &ConstType{Name: "usize"}, MethodName: "try_from", Arguments: []Expr{value}}, MethodName: "unwrap"}
+}
+
+// fromUsize converts a usize, like a length or an index, into an integer of the model
+func (t *translator) fromUsize(value Expr) Expr {
+	intType := t.intType()
+	if _, big := intType.(*BigUintType); big {
+		// the cosmwasm integers only convert from the fixed-size integers
+		value = &MethodCall{Value: &StaticMethodCall{TypeName: &UInt64Type{}, MethodName: "try_from", Arguments: []Expr{value}}, MethodName: "unwrap"}
+		return &StaticMethodCall{TypeName: intType, MethodName: "from", Arguments: []Expr{value}}
+	}
+	return &MethodCall{Value: &StaticMethodCall{TypeName: intType, MethodName: "try_from", Arguments: []Expr{value}}, MethodName: "unwrap"}
+}
@@ -2,100 +2,229 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
+
+	"piwasm/quintir"
 )
 
-func resolveType(typeField map[string]interface{}) Type {
+func (t *translator) resolveType(typ quintir.Type) Type {
+	resolved := t.resolveTypeKind(typ)
+	if typ != nil {
+		t.setOrigin(resolved, typ)
+	}
+	return resolved
+}
+
+func (t *translator) resolveTypeKind(typ quintir.Type) Type {
 	// match the kind of the type
-	switch typeField["kind"].(string) {
-	case "rec": // records
+	switch qt := typ.(type) {
+	case *quintir.RecType: // records
 		var fields []Field
-		fieldsMap := typeField["fields"].(map[string]interface{})["fields"].([]interface{})
-		for _, field := range fieldsMap {
-			fieldMap := field.(map[string]interface{})
-			fieldType := resolveType(fieldMap["fieldType"].(map[string]interface{}))
-			fields = append(fields, Field{fieldMap["fieldName"].(string), fieldType})
+		rowFields, _ := quintir.RowFields(qt.Fields)
+		for _, field := range rowFields {
+			fieldType := t.resolveType(field.FieldType)
+			fields = append(fields, Field{field.FieldName, fieldType})
 		}
 		return &StructType{Fields: fields}
-	case "str":
+	case *quintir.StrType:
 		return &StrType{}
-	case "const":
+	case *quintir.ConstType:
 		// the type is just referenced here by an id and name.
-		typeName := typeField["name"].(string)
-		return &ConstType{Name: typeName}
-	case "list":
-		elementType := resolveType(typeField["elem"].(map[string]interface{}))
+		return &ConstType{Name: qt.Name}
+	case *quintir.ListType:
+		elementType := t.resolveType(qt.Elem)
 		return &ListType{ElementType: elementType}
-	case "int":
-		return &UInt64Type{}
-	case "set":
-		elementType := resolveType(typeField["elem"].(map[string]interface{}))
+	case *quintir.IntType:
+		return t.intType()
+	case *quintir.SetType:
+		elementType := t.resolveType(qt.Elem)
 		return &SetType{ElementType: elementType}
-	case "fun":
-		argType := resolveType(typeField["arg"].(map[string]interface{}))
-		returnType := resolveType(typeField["res"].(map[string]interface{}))
+	case *quintir.FunType:
+		argType := t.resolveType(qt.Arg)
+		returnType := t.resolveType(qt.Res)
 		return &MapType{Key: argType, Value: returnType}
-	case "bool":
+	case *quintir.BoolType:
 		return &BoolType{}
-	case "tup":
+	case *quintir.OperType:
+		// a parameter that takes an operator, like the f of `def apply(f: int => int, x: int): int = f(x)`
+		fn := &FnType{Result: t.resolveType(qt.Res)}
+		for _, arg := range qt.Args {
+			fn.Params = append(fn.Params, t.resolveType(arg))
+		}
+		return fn
+	case *quintir.TupType:
 		var types []Type
-		fieldsMap := typeField["fields"].(map[string]interface{})["fields"].([]interface{})
-		for _, field := range fieldsMap {
-			fieldMap := field.(map[string]interface{})
-			fieldType := resolveType(fieldMap["fieldType"].(map[string]interface{}))
+		rowFields, _ := quintir.RowFields(qt.Fields)
+		for _, field := range rowFields {
+			fieldType := t.resolveType(field.FieldType)
 			types = append(types, fieldType)
 		}
 		return &TupleType{Types: types}
+	case *quintir.SumType:
+		if payload, ok := t.optionPayload(qt); ok {
+			return &OptionType{ValueType: t.resolveType(payload)}
+		}
+		// sum types are declared by typedefs, whose enums they refer to
+		name, err := t.records.resolveSum(qt)
+		if err != nil {
+			t.errorf(typ, "could not name sum type: %s", err)
+			return TodoType
+		}
+		return &ConstType{Name: name}
+	case *quintir.AppType:
+		if payload, ok := t.optionPayload(qt); ok {
+			return &OptionType{ValueType: t.resolveType(payload)}
+		}
+		t.errorf(typ, "polymorphic types are only supported for options")
+		return TodoType
+	case *quintir.VarType:
+		if typeArg, ok := t.typeArgs[qt.Name]; ok {
+			// a copy of a polymorphic def for this type
+			return typeArg
+		}
+		return &TypeVar{Name: typeVarName(qt.Name)}
+	case nil:
+		t.errorf(nil, "missing type annotation")
+		return TodoType
 	default:
-		panic("kind not supported for resolving types: " + typeField["kind"].(string))
+		t.errorf(typ, "kind not supported for resolving types: %s", typ.Kind())
+		return TodoType
 	}
 }
 
-func resolveDef(defField map[string]interface{}) Decl {
+func (t *translator) resolveTypeDef(d *quintir.TypeDef) Decl {
+	if sum, ok := d.Type.(*quintir.SumType); ok {
+		if _, isOption := t.optionPayload(sum); !isOption {
+			return t.resolveSumDecl(d, sum)
+		} else if len(d.Params) > 0 {
+			// the polymorphic option of the stdlib is rust's Option itself
+			return nil
+		}
+	}
+	if record, ok := t.taggedRecords[d.Name]; ok {
+		// a record that emulates a sum type, see tagged.go
+		declaration := t.resolveTaggedDecl(record)
+		t.setOrigin(declaration, d)
+		return declaration
+	}
+
+	var declaration Decl
+	declType := t.resolveType(d.Type)
+
+	// if the type is a StructType, this should be a struct decl, otherwise a type decl
+	if _, ok := declType.(*StructType); ok {
+		structType := declType.(*StructType)
+
+		// this is a struct decl
+		// the integer fields have the widths inferred for them
+		if rec, ok := t.records.expand(d.Type).(*quintir.RecType); ok {
+			fields, _ := quintir.RowFields(rec.Fields)
+			for _, field := range fields {
+				if _, isInt := field.FieldType.(*quintir.IntType); !isInt {
+					continue
+				}
+				for i := range structType.Fields {
+					if structType.Fields[i].Name == field.FieldName {
+						structType.Fields[i].Type = t.fieldIntType(d.Name, field.FieldName)
+					}
+				}
+			}
+		}
+
+		attrs := []string{"derive(Clone, Debug, Default, PartialEq, Eq, Hash, Serialize, Deserialize)"}
+		if !t.hasDefault(d.Type) {
+			// a field has no default value, like an enum whose variants all have a payload
+			attrs[0] = "derive(Clone, Debug, PartialEq, Eq, Hash, Serialize, Deserialize)"
+		}
+		declaration = &StructDecl{Name: d.Name, Fields: structType.Fields, Attrs: attrs}
+	} else {
+		// this is a type decl
+		declaration = &TypeDecl{Name: d.Name, Type: declType}
+	}
+	t.setOrigin(declaration, d)
+	return declaration
+}
+
+func (t *translator) resolveDef(def *quintir.OpDef) Decl {
+	resolved := t.resolveDefKind(def)
+	if resolved != nil {
+		t.setOrigin(resolved, def)
+	}
+	return resolved
+}
+
+func (t *translator) resolveDefKind(def *quintir.OpDef) Decl {
+	if variantConstructor(def) != nil || t.optionHelper(def) != "" {
+		// the constructors of variants are not needed in rust, where the variants can be constructed directly,
+		// and the helpers for options are methods of Option
+		return nil
+	}
 	// match the kind of the type
-	switch defField["qualifier"].(string) {
+	switch def.Qualifier {
 	case "pureval":
-		name := defField["name"].(string)
-		valType := resolveType(defField["typeAnnotation"].(map[string]interface{}))
-		block := resolveExpr(defField["expr"].(map[string]interface{}), valType)
-		return &ConstDecl{Name: name, Type: valType, Value: block}
+		valType := t.intTypeAt(t.defType(def), def.ID)
+		if t.computed(def) {
+			statements := t.resolveBody(def, def.Expr, valType)
+			cloneReused(statements.Statements)
+			return &FunctionDecl{Name: def.Name, ReturnType: valType, Body: statements.Statements}
+		}
+		block := t.resolveExpr(def.Expr, valType)
+		return &ConstDecl{Name: def.Name, Type: valType, Value: block}
 	case "puredef":
+		if _, ok := t.constructors[def.ID]; ok {
+			// constructors of tagged records become enum variants, their calls construct the variant directly
+			return nil
+		}
+		if t.monomorphize && t.typeArgs == nil && t.isPolymorphic(def) {
+			// the copies for the types it is called with are translated by resolveInstances
+			return nil
+		}
+		// the body of a def that can fail returns the errors of its checked operators and calls
+		fallible := t.fallible[def.ID]
+		propagates := t.propagates
+		t.propagates = fallible
+		defer func() { t.propagates = propagates }()
+
 		// ====extract parameters====
 		var paramNames []string
 		var paramTypes []Type
 		var returnType Type
 		var statements Block
 		// if there are no parameters, the shape of the puredef is different.
-		if defField["expr"].(map[string]interface{})["params"] == nil {
+		if lambda, ok := def.Expr.(*quintir.Lambda); !ok {
 			// no params
 			paramNames = []string{}
 			paramTypes = []Type{}
 
 			// return type is the type in typeAnnotation
-			returnType = resolveType(defField["typeAnnotation"].(map[string]interface{}))
+			returnType = t.intTypeAt(t.defType(def), def.ID)
 
 			// ====extract the expression from expr=====
-			statements = resolveBlock(defField["expr"].(map[string]interface{}), returnType)
+			statements = t.resolveBody(def, def.Expr, returnType)
 		} else {
 			// parameter names are given in expr.params
-			for _, paramField := range defField["expr"].(map[string]interface{})["params"].([]interface{}) {
-				// param name is in paramField.name
-				paramName := paramField.(map[string]interface{})["name"]
-				paramNames = append(paramNames, paramName.(string))
+			for _, param := range lambda.Params {
+				paramNames = append(paramNames, param.Name)
 			}
 
 			// types are in typeAnnotation.args
-			for _, paramType := range defField["typeAnnotation"].(map[string]interface{})["args"].([]interface{}) {
-				paramTypes = append(paramTypes, resolveType(paramType.(map[string]interface{})))
+			operType, ok := t.defType(def).(*quintir.OperType)
+			if !ok || len(operType.Args) != len(paramNames) {
+				t.errorf(def, "expected an operator type with %d parameters for %s", len(paramNames), def.Name)
+				return nil
+			}
+			for i, paramType := range operType.Args {
+				paramTypes = append(paramTypes, t.intTypeAt(paramType, lambda.Params[i].ID))
 			}
 
 			// ====extract the return type from typeAnnotations.res=====
-			returnType = resolveType(defField["typeAnnotation"].(map[string]interface{})["res"].(map[string]interface{}))
+			returnType = t.intTypeAt(operType.Res, def.ID)
 			// ====extract the expression from expr.expr - the next layer will always be lambda =====
-			statements = resolveBlock(defField["expr"].(map[string]interface{})["expr"].(map[string]interface{}), returnType)
+			statements = t.resolveBody(def, lambda.Expr, returnType)
 		}
 
 		// construct the params list
@@ -105,258 +234,406 @@ func resolveDef(defField map[string]interface{}) Decl {
 			params = append(params, Param{Name: paramNames[i], Type: paramTypes[i], Mutable: true})
 		}
 
-		return &FunctionDecl{Name: defField["name"].(string), Params: params, ReturnType: returnType, Body: statements.Statements}
+		if fallible {
+			returnType = resultType(returnType)
+			if ret, ok := statements.Statements[len(statements.Statements)-1].(*Return); ok {
+				ret.Value = wrapOk(ret.Value)
+			}
+		}
+
+		cloneReused(statements.Statements)
+		fn := &FunctionDecl{Name: def.Name, Params: params, ReturnType: returnType, Body: statements.Statements}
+		if t.typeArgs == nil {
+			fn.TypeParams = t.typeParams(def)
+		}
+		return fn
+
+	case "run":
+		return t.resolveRun(def)
 
 	case "val":
-		name := defField["name"].(string)
-		expr := resolveExpr(defField["expr"].(map[string]interface{}), &ConstType{Name: "Todo"})
-		return &ValDecl{Name: name, Value: expr}
+		// the type of the val is only known if it was recorded where the val is used
+		expr := t.resolveExpr(def.Expr, t.letTypes[def.ID])
+		return &ValDecl{Name: def.Name, Value: expr}
 
 	default:
-		fmt.Println("qualifier not supported for resolving defs: " + defField["qualifier"].(string))
+		t.errorf(def, "qualifier not supported for resolving defs: %s", def.Qualifier)
 	}
 
 	return nil
 }
 
-func resolveExpr(exprField map[string]interface{}, exprType Type) Expr {
-	switch exprField["kind"].(string) {
-	case "str":
-		return &StringLiteral{Value: exprField["value"].(string)}
+// computed checks if a val at the top level is a function that computes its value. the constants of rust
+// are evaluated when compiling, which only literals like 3 and true can be, not sets or strings.
+func (t *translator) computed(def *quintir.OpDef) bool {
+	if _, topLevel := t.opDefs[def.ID]; !topLevel || def.Qualifier != "pureval" || variantConstructor(def) != nil || t.optionHelper(def) != "" {
+		return false
+	}
+	value := def.Expr
+	if negation, ok := value.(*quintir.App); ok && negation.Opcode == "iuminus" && len(negation.Args) == 1 {
+		value = negation.Args[0]
+	}
+	switch value.(type) {
+	case *quintir.IntLit, *quintir.BoolLit:
+		return false
+	}
+	return true
+}
+
+// resolveExpr resolves an expression that should have the given exprType.
+// exprType may be nil if the context does not determine it, in which case the type inferred by the typechecker is used.
+func (t *translator) resolveExpr(expr quintir.Expr, exprType Type) Expr {
+	resolved := t.resolveExprKind(expr, t.expectedType(expr, exprType))
+	t.setOrigin(resolved, expr)
+	return resolved
+}
 
-	case "int":
-		return &UInt64Literal{Value: uint64(exprField["value"].(float64))}
+func (t *translator) resolveExprKind(expr quintir.Expr, exprType Type) Expr {
+	switch e := expr.(type) {
+	case *quintir.StrLit:
+		return &StringLiteral{Value: e.Value}
 
-	case "app":
-		// this is an operator application
+	case *quintir.BoolLit:
+		return &BoolLiteral{Value: e.Value}
 
-		// find out the opcode
-		opcode := exprField["opcode"].(string)
-		switch opcode {
+	case *quintir.IntLit:
+		return t.widthLiteral(e)
+
+	case *quintir.App:
+		// this is an operator application
+		args := e.Args
+		switch e.Opcode {
 
 		case "Rec": // we are building a record
-			args := exprField["args"].([]interface{})
+			structName := t.structName(e, exprType)
+			if record, ok := t.taggedRecords[structName]; ok {
+				// a variant of a record that emulates a sum type
+				_, tag, values := t.taggedFields(e)
+				variant := record.variant(tag)
+				if variant == nil {
+					t.errorf(e, "the tag of a %s must be a string literal", structName)
+					return newTodo()
+				}
+				return t.resolveTaggedCons(e, record, variant, values)
+			}
 
+			// the fields have the types of the fields of the named record type, if we know it
 			// get the fields of the struct from the args
 			fields := make([]FieldValue, len(args)/2)
 			// they are in args in the form name, value, name, value, ...
 
 			for i := 0; i < len(args); i += 2 {
 				// get the name arg
-				nameArg := args[i].(map[string]interface{})
-				name := nameArg["value"].(string)
-
-				// get the value arg
-				valueArg := args[i+1].(map[string]interface{})
+				nameArg, ok := args[i].(*quintir.StrLit)
+				if !ok {
+					t.errorf(args[i], "record field names must be string literals")
+					return newTodo()
+				}
+				name := nameArg.Value
 
-				// TODO: get the type from the type list, since we know the name of the record
-				value := resolveExpr(valueArg, nil)
+				value := t.resolveExpr(args[i+1], t.fieldType(exprType, name))
 
 				fields[i/2] = FieldValue{Name: name, Value: value}
 			}
 
-			return &StructCons{StructName: exprType.PrettyPrint(0), Fields: fields}
+			return &StructCons{StructName: structName, Fields: fields}
 
 		case "Tup":
 			// this is a tuple
-			args := exprField["args"].([]interface{})
 			var values []Expr
-			for _, arg := range args {
-				values = append(values, resolveExpr(arg.(map[string]interface{}), &ConstType{Name: "Todo"}))
+			for i, arg := range args {
+				values = append(values, t.resolveExpr(arg, elementType(exprType, i)))
 			}
 			return &Tuple{Values: values}
 
 		case "Set":
 			// this is a set
-			args := exprField["args"].([]interface{})
+			if len(args) == 0 {
+				// rust cannot tell the type of the elements of an empty set from its use in all places, like assert_eq!
+				element := elementType(exprType, 0)
+				if !isKnown(element) {
+					element = elementType(t.typeOf(e), 0)
+				}
+				if isKnown(element) {
+					return &StaticMethodCall{TypeName: &SetType{ElementType: element}, MethodName: "new"}
+				}
+			}
 			var values []Expr
 			for _, arg := range args {
-				values = append(values, resolveExpr(arg.(map[string]interface{}), &ConstType{Name: "Todo"}))
+				values = append(values, t.resolveExpr(arg, elementType(exprType, 0)))
 			}
 			return &Macro{Name: "im::hashset", Args: values}
 
 		case "List":
 			// this is a list
-			args := exprField["args"].([]interface{})
 			var values []Expr
 			for _, arg := range args {
-				values = append(values, resolveExpr(arg.(map[string]interface{}), &ConstType{Name: "Todo"}))
+				values = append(values, t.resolveExpr(arg, elementType(exprType, 0)))
 			}
 			return &Macro{Name: "im::vector", Args: values}
 
-		case "iadd":
-			// addition
-			args := exprField["args"].([]interface{})
-			left := resolveExpr(args[0].(map[string]interface{}), &UInt64Type{})
-			right := resolveExpr(args[1].(map[string]interface{}), &UInt64Type{})
-			return &Add{Left: left, Right: right}
+		case "iadd", "isub", "imul", "idiv", "imod", "ipow":
+			// integer arithmetic, as --arithmetic chooses
+			return t.resolveArithmetic(e)
+
+		case "igt", "ilt", "igte", "ilte":
+			// integer comparisons
+			left := t.resolveExpr(args[0], t.intType())
+			right := t.resolveExpr(args[1], t.intType())
+			return &BinaryOp{Op: integerOperators[e.Opcode], Left: left, Right: right}
+
+		case "iuminus":
+			return &UnaryOp{Op: "-", Value: t.resolveExpr(args[0], t.intType())}
+
+		case "and", "or":
+			// these take any number of arguments
+			op := "&&"
+			if e.Opcode == "or" {
+				op = "||"
+			}
+			if len(args) == 0 {
+				return &BoolLiteral{Value: e.Opcode == "and"}
+			}
+			result := t.resolveExpr(args[0], &BoolType{})
+			for _, arg := range args[1:] {
+				result = &BinaryOp{Op: op, Left: result, Right: t.resolveExpr(arg, &BoolType{})}
+			}
+			return result
+
+		case "implies":
+			// a implies b is !a || b
+			left := t.resolveExpr(args[0], &BoolType{})
+			right := t.resolveExpr(args[1], &BoolType{})
+			return &BinaryOp{Op: "||", Left: &UnaryOp{Op: "!", Value: left}, Right: right}
+
+		case "iff":
+			left := t.resolveExpr(args[0], &BoolType{})
+			right := t.resolveExpr(args[1], &BoolType{})
+			return &BinaryOp{Op: "==", Left: left, Right: right}
 
 		case "ite":
+			if match := t.resolveTagMatch(e, exprType); match != nil {
+				// an if on the tag of a tagged record, which binds its payload in the then branch
+				return match
+			}
 			// this is an if-then-else expression
-			args := exprField["args"].([]interface{})
-			cond := resolveExpr(args[0].(map[string]interface{}), &BoolType{})
-			then := resolveExpr(args[1].(map[string]interface{}), exprType)
-			els := resolveExpr(args[2].(map[string]interface{}), exprType)
+			cond := t.resolveExpr(args[0], &BoolType{})
+			then := t.resolveExpr(args[1], exprType)
+			els := t.resolveExpr(args[2], exprType)
 			return &IfElse{Condition: cond, Then: then, Else: els}
 
+		case "variant":
+			// the construction of a variant of a sum type
+			return t.resolveVariant(e, args[0], args[1], exprType)
+
+		case "matchVariant":
+			return t.resolveMatchVariant(e, exprType)
+
+		case "map", "filter", "select", "exists", "forall", "mapBy", "fold", "foldl", "foldr", "setToMap":
+			// higher-order operators on collections, which become iterator chains
+			return t.resolveIterator(e, exprType)
+
+		case "size", "length":
+			return t.resolveSize(e)
+
+		case "nth", "append", "concat", "head", "tail", "slice", "indices", "replaceAt", "range":
+			return t.resolveList(e, exprType)
+
+		case "in", "contains", "to", "isFinite", "flatten", "Map", "setBy":
+			// operators on sets and maps that are more than a call of a method
+			return t.resolveCollection(e, exprType)
+
+		case "eq", "neq":
+			// comparisons of the tag of a tagged record, like x.tag == "ok"
+			if value, record, tag, ok := t.tagComparison(e); ok {
+				return t.resolveTagTest(e, value, record, tag)
+			}
+			// both sides have the same type, which one of them may tell
+			argType := t.typeOf(args[0])
+			if !isKnown(argType) {
+				argType = t.typeOf(args[1])
+			}
+			left := t.resolveExpr(args[0], argType)
+			right := t.resolveExpr(args[1], argType)
+			op := "=="
+			if e.Opcode == "neq" {
+				op = "!="
+			}
+			return &BinaryOp{Op: op, Left: left, Right: right}
+
 		case "not":
 			// this is a not expression
-			args := exprField["args"].([]interface{})
-			expr := resolveExpr(args[0].(map[string]interface{}), &BoolType{})
-			return &Not{Value: expr}
-
-		// TODO: Specialize map.keys().contains(key) to map.contains(&key)
-		case "contains":
-			// this maps to `setExpr.contains(&value)`
-			args := exprField["args"].([]interface{})
-			set := resolveExpr(args[0].(map[string]interface{}), &SetType{ElementType: WildcardType})
-			value := resolveExpr(args[1].(map[string]interface{}), nil)
-			return &MethodCall{
-				Value:      set,
-				MethodName: "contains",
-				Arguments:  []Expr{&Borrow{Value: value}},
-			}
-
-		case "union":
-			// this maps to `setExpr.union(otherSetExpr)`
-			args := exprField["args"].([]interface{})
-			set := resolveExpr(args[0].(map[string]interface{}), &SetType{ElementType: WildcardType})
-			otherSet := resolveExpr(args[1].(map[string]interface{}), &SetType{ElementType: WildcardType})
-			return &MethodCall{
-				Value:      set,
-				MethodName: "union",
-				Arguments:  []Expr{otherSet},
-				TypeArgs:   []Type{},
-			}
-
-		case "mapRemove":
-			// this maps to `setExpr.without(&key)`
-			args := exprField["args"].([]interface{})
-			set := resolveExpr(args[0].(map[string]interface{}), &SetType{ElementType: WildcardType})
-			key := resolveExpr(args[1].(map[string]interface{}), &SetType{ElementType: WildcardType})
-			return &MethodCall{
-				Value:      set,
-				MethodName: "without",
-				Arguments:  []Expr{&Borrow{Value: key}},
-				TypeArgs:   []Type{},
-			}
-
-		case "keys":
-			// this maps to `mapExpr.keys().collect::<HashSet<_>>`
-			args := exprField["args"].([]interface{})
-			mapExpr := resolveExpr(args[0].(map[string]interface{}), &MapType{Key: WildcardType, Value: WildcardType})
-			keysExpr := &MethodCall{
-				Value:      mapExpr,
-				MethodName: "keys",
-				TypeArgs:   []Type{},
-				Arguments:  []Expr{},
-			}
-			return &MethodCall{
-				Value:      keysExpr,
-				MethodName: "collect",
-				TypeArgs:   []Type{&SetType{ElementType: WildcardType}},
-				Arguments:  []Expr{},
-			}
-
-		case "get":
-			// this maps to `mapExpr.get(&key).unwrap()`
-			args := exprField["args"].([]interface{})
-			mapExpr := resolveExpr(args[0].(map[string]interface{}), &MapType{Key: WildcardType, Value: WildcardType})
-			keyExpr := resolveExpr(args[1].(map[string]interface{}), nil)
-			getExpr := &MethodCall{
-				Value:      mapExpr,
-				MethodName: "get",
-				TypeArgs:   []Type{},
-				Arguments:  []Expr{&Borrow{Value: keyExpr}},
-			}
-			return &MethodCall{
-				Value:      getExpr,
-				MethodName: "unwrap",
-				TypeArgs:   []Type{},
-				Arguments:  []Expr{},
-			}
-
-		case "put":
-			// this maps to `mapExpr.update(key, value)`
-			args := exprField["args"].([]interface{})
-			// mapType := exprType.(*MapType)
-			mapExpr := resolveExpr(args[0].(map[string]interface{}), &MapType{Key: WildcardType, Value: WildcardType})
-			keyExpr := resolveExpr(args[1].(map[string]interface{}), WildcardType)
-			valueExpr := resolveExpr(args[2].(map[string]interface{}), WildcardType)
-			return &MethodCall{
-				Value:      mapExpr,
-				MethodName: "update",
-				TypeArgs:   []Type{},
-				Arguments:  []Expr{keyExpr, valueExpr},
-			}
+			expr := t.resolveExpr(args[0], &BoolType{})
+			return &UnaryOp{Op: "!", Value: expr}
+
+		case "item":
+			// a projection of a tuple, like r._1
+			return t.resolveItem(e)
 
 		case "field":
 			// this is a field access
-			args := exprField["args"].([]interface{})
-			value := resolveExpr(args[0].(map[string]interface{}), nil)
-			fieldName := args[1].(map[string]interface{})["value"].(string)
-			return &FieldAccess{Value: value, Field: fieldName}
+			fieldName, ok := args[1].(*quintir.StrLit)
+			if !ok {
+				t.errorf(args[1], "field names must be string literals")
+				return newTodo()
+			}
+			if record := t.taggedRecordOf(args[0]); record != nil {
+				return t.resolveTaggedField(e, record, fieldName.Value)
+			}
+			value := t.resolveExpr(args[0], nil)
+			return &FieldAccess{Value: value, Field: fieldName.Value}
 
 		case "with":
 			// this is a record update: { rec.field = value; rec }
-			args := exprField["args"].([]interface{})
-			rec := resolveExpr(args[0].(map[string]interface{}), nil)
-			fieldName := resolveExpr(args[1].(map[string]interface{}), nil).(*StringLiteral)
-			value := resolveExpr(args[2].(map[string]interface{}), &ConstType{Name: "Todo"})
+			// the updated record has the same type as the result
+			rec := t.resolveExpr(args[0], exprType)
+			fieldName, ok := args[1].(*quintir.StrLit)
+			if !ok {
+				t.errorf(args[1], "field names must be string literals")
+				return newTodo()
+			}
+			value := t.resolveExpr(args[2], t.fieldType(exprType, fieldName.Value))
 			assignExpr := &Assign{
 				Dest:  &FieldAccess{Value: rec, Field: fieldName.Value},
 				Value: value,
 			}
 			return &Block{Statements: []Stmt{assignExpr, &Return{Value: rec}}}
 
-		case "Ok":
-			// this maps to `StdResult::Ok(value)`
-			args := exprField["args"].([]interface{})
-			value := resolveExpr(args[0].(map[string]interface{}), nil)
-			return &EnumCons{
-				EnumName: "StdResult",
-				Variant:  "Ok",
-				Params:   []Expr{value},
+		default:
+			if b := t.builtinOf(e); b != nil {
+				// a builtin or stdlib def with a mapping, like contains
+				return t.resolveBuiltin(e, b)
 			}
-
-		case "Err":
-			// this maps to `StdResult::Err(value)`
-			args := exprField["args"].([]interface{})
-			value := resolveExpr(args[0].(map[string]interface{}), nil)
-			return &EnumCons{
-				EnumName: "StdResult",
-				Variant:  "Ok",
-				Params:   []Expr{value},
+			if t.qualifiedName(e) == "quint_stdlib::mapRemoveAll" {
+				// removing the keys one after the other is more than a call
+				return t.resolveCollection(e, exprType)
 			}
-
-		default:
-			fmt.Println("app opcode not supported for resolving expr: " + opcode)
+			// a call of a definition of the model, like max(3, 4)
+			if lookup := t.ir.Lookup(e.ID); lookup != nil {
+				if _, ok := lookup.Def.(*quintir.Param); ok {
+					// a call of an operator parameter, which is a closure
+					arguments := make([]Expr, len(args))
+					for i, arg := range args {
+						arguments[i] = t.resolveExpr(arg, nil)
+					}
+					return &FunctionCall{FunctionName: e.Opcode, Arguments: arguments}
+				}
+				if def, ok := lookup.Def.(*quintir.OpDef); ok {
+					if method := t.optionHelper(def); method != "" {
+						return t.resolveOptionHelper(e, method)
+					}
+					if variant := variantConstructor(def); variant != nil && len(args) == 1 {
+						// a call of the constructor of a variant, like A(3)
+						return t.resolveVariant(e, variant.Args[0], args[0], exprType)
+					}
+					if constructor, ok := t.constructors[lookup.Def.QuintID()]; ok {
+						// a constructor of a tagged record, like Ok(result)
+						return t.resolveConstructorCall(e, constructor)
+					}
+					name := e.Opcode
+					if _, topLevel := t.opDefs[def.ID]; topLevel && t.monomorphize && t.isPolymorphic(def) && t.translates(t.defModules[def.ID]) {
+						// a call of the copy of a polymorphic def for the types of the arguments
+						if name = t.instantiate(e, def, exprType); name == "" {
+							return newTodo()
+						}
+					}
+					paramTypes := t.paramTypes(e)
+					arguments := make([]Expr, len(args))
+					for i, arg := range args {
+						arguments[i] = t.resolveExpr(arg, typeAt(paramTypes, i))
+					}
+					return t.fallibleCall(def, &FunctionCall{FunctionName: name, Arguments: arguments})
+				}
+			}
+			t.errorf(e, "app opcode not supported for resolving expr: %s", e.Opcode)
 		}
 
-	case "name":
+	case *quintir.Name:
+		// a definition without parameters, like get_min_fee, is a function in rust and has to be called
+		if lookup := t.ir.Lookup(e.ID); lookup != nil {
+			if def, ok := lookup.Def.(*quintir.OpDef); ok && def.Qualifier == "pureval" {
+				if variant := variantConstructor(def); variant != nil {
+					// a variant without payload, like B
+					return t.resolveVariant(e, variant.Args[0], variant.Args[1], exprType)
+				}
+			}
+			if def, ok := lookup.Def.(*quintir.OpDef); ok && t.computed(def) {
+				return &FunctionCall{FunctionName: e.Name}
+			}
+			if def, ok := lookup.Def.(*quintir.OpDef); ok && def.Qualifier == "puredef" {
+				if _, isLambda := def.Expr.(*quintir.Lambda); !isLambda {
+					return t.fallibleCall(def, &FunctionCall{FunctionName: e.Name})
+				}
+			}
+		}
 		// this is a variable
-		return &Variable{VariableName: exprField["name"].(string)}
-
-	case "let":
-		// this is a let expression
-		opdef := resolveDef(exprField["opdef"].(map[string]interface{})).(*ValDecl)
-		body := resolveExpr(exprField["expr"].(map[string]interface{}), exprType)
-		return &Let{VariableName: opdef.Name, Value: opdef.Value, Body: body}
+		t.recordLetType(e, exprType)
+		return t.capturedUse(e, &Variable{VariableName: e.Name, Copy: isCopy(t.ir.TypeOf(e.ID))})
+
+	case *quintir.Lambda:
+		// an operator passed to another one, like the (k) => m.get(k) of mapBy(keys, (k) => m.get(k))
+		return t.resolveClosure(e, false, false)
+
+	case *quintir.Let:
+		// this is a let expression.
+		// the body is resolved first, since the uses of the val in the body determine its type
+		names := t.destructure(e)
+		body := t.resolveExpr(e.Expr, exprType)
+		if lambda, ok := e.Opdef.Expr.(*quintir.Lambda); ok {
+			// a local def with parameters is a closure, which lives as long as the variable it is bound to
+			return &Let{VariableName: e.Opdef.Name, Value: t.resolveClosure(lambda, true, false), Body: body}
+		}
+		switch opdef := t.resolveDef(e.Opdef).(type) {
+		case *ValDecl:
+			return &Let{VariableName: opdef.Name, Names: names, Value: opdef.Value, Body: body}
+		case *ConstDecl:
+			return &Let{VariableName: opdef.Name, Names: names, Value: opdef.Value, Body: body}
+		case nil:
+			// resolveDef already reported the problem
+		default:
+			t.errorf(e.Opdef, "%s definitions are not supported in let expressions", e.Opdef.Qualifier)
+		}
 
 	default:
-		fmt.Println("kind not supported for resolving expr: " + exprField["kind"].(string))
+		t.errorf(expr, "kind not supported for resolving expr: %s", expr.Kind())
 	}
 
-	return &Todo
+	return newTodo()
 }
 
 // resolveBlock resolves an expression block
 // the block should return something with the given exprType
 // we need the exprType because otherwise it is impossible to tell what type a certain record that will be returned is, and
 // rust needs that explicitly
-func resolveBlock(exprField map[string]interface{}, exprType Type) Block {
-	expr := resolveExpr(exprField, exprType)
-	return Block{Statements: []Stmt{&Return{Value: expr}}}
+func (t *translator) resolveBlock(expr quintir.Expr, exprType Type) Block {
+	resolved := t.resolveExpr(expr, exprType)
+	return Block{Statements: []Stmt{&Return{Value: resolved}}}
+}
+
+// translates checks if the definitions of a module are translated. usually the modules ending in _stdlib are
+// written by hand, and the ones ending in _test only exist for the model checker.
+// with --stdlib, only the given stdlib module is translated instead.
+func (t *translator) translates(module string) bool {
+	if t.stdlib != "" {
+		return module == t.stdlib
+	}
+	return !strings.HasSuffix(module, "_stdlib") && !strings.HasSuffix(module, "_test")
+}
+
+// stdlibImports returns the imports of the rust modules of the stdlib modules that the module imports
+func stdlibImports(data *quintir.Output, module string) []Import {
+	var imports []Import
+	for _, m := range data.Modules {
+		if m.Name != module {
+			continue
+		}
+		for _, decl := range m.Declarations {
+			if imp, ok := decl.(*quintir.Import); ok && strings.HasSuffix(imp.ProtoName, "_stdlib") {
+				imports = append(imports, Import{Path: "super::" + imp.ProtoName + "::*"})
+			}
+		}
+	}
+	return imports
 }
 
 func prettyPrint(i interface{}) {
@@ -365,115 +642,206 @@ func prettyPrint(i interface{}) {
 }
 
 func main() {
-	if len(os.Args) < 3 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <input file path> <output file path>\n", os.Args[0])
-		os.Exit(1)
+	if len(os.Args) > 1 && os.Args[1] == "explain" {
+		os.Exit(explain(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(replay(os.Args[2:]))
 	}
 
-	// read the file from the first argument
-	filePath := os.Args[1]
-	file, err := os.ReadFile(filePath)
-	if err != nil {
-		fmt.Println("Error reading file:", err)
-		return
+	allowTodo := flag.Bool("allow-todo", false, "write the output even if parts of the model could not be translated, leaving todo!() in their place")
+	sourceMapPath := flag.String("source-map", "", "write a source map from the rust output back to the quint model to this path")
+	quintComments := flag.Bool("quint-comments", false, "add a `// quint: ...` comment with the origin before every declaration")
+	libPath := flag.String("lib", "", "also write the cosmwasm entry points, generated from the *_entrypoints module, to this path (usually src/lib.rs)")
+	checkInvariants := flag.Bool("invariants", false, "translate the invariants of the _test module that only read the ContractStorage, and check them after every entry point in debug builds (with --lib)")
+	schemaDir := flag.String("schema", "", "write the JSON schemas of the messages of the entry points into this directory")
+	stdlibModule := flag.String("stdlib", "", "translate the given stdlib module, like quint_stdlib, instead of the modules of the contract")
+	monomorphize := flag.Bool("monomorphize", false, "translate polymorphic definitions into a copy per type they are called with, instead of generic functions")
+	builtinsPath := flag.String("builtins", "", "add the builtin mappings of this JSON file to the default ones of builtins.json, replacing the ones with the same names")
+	arithmetic := flag.String("arithmetic", "plain", "how integer operators are translated: plain (u64 with + and so on), checked (u64, returning overflows as errors), saturating (u64), uint128 or uint256 (cosmwasm's types, returning overflows as errors)")
+	intDefault := flag.String("int-default", "u64", "the width of the integers whose width is not inferred: u64, i64, i128 or Uint128")
+	contractModule := flag.String("contract-module", "", "the rust module path of the output file in the crate, used by the entry points (default contract::<output file name>)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <input file path> <output file path>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s explain <source map path> [compiler output path]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s replay [flags] <input file path> <output file path> <trace path>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	outputFilePath := os.Args[2]
+	if *builtinsPath != "" {
+		if err := loadBuiltins(*builtinsPath); err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading builtin mappings:", err)
+			os.Exit(1)
+		}
+	}
 
-	// read the whole file into a map
-	var data map[string]interface{}
-	err = json.Unmarshal(file, &data)
+	// read and decode the typechecker output from the first argument
+	filePath := flag.Arg(0)
+	data, err := quintir.Load(filePath)
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, "Error reading file:", err)
+		os.Exit(1)
 	}
 
-	// get the map of types and preprocess it
-	namedTypeMap := make(map[int]string)
-	for key, value := range data["types"].(map[string]interface{}) {
-		// treat the value as another map
-		valueTypeMap := value.(map[string]interface{})["type"].(map[string]interface{})
-		name, ok := valueTypeMap["name"]
-		if !ok {
-			// type is probably anonymous, ignore
-			continue
-		}
+	outputFilePath := flag.Arg(1)
 
-		entryId, err := strconv.Atoi(key)
-		if err != nil {
-			fmt.Println("Error parsing type id for entry ", key)
-			panic(err)
-		}
-		namedTypeMap[entryId] = name.(string)
-		// if the
+	translator := newTranslator(data)
+	translator.monomorphize = *monomorphize
+	translator.stdlib = *stdlibModule
+	if err := validArithmetic(*arithmetic); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	translator.arithmetic = *arithmetic
+	translator.findFallible()
+	if err := validIntWidth(*intDefault); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	translator.intDefault = *intDefault
+	translator.inferWidths()
+	if *stdlibModule != "" && !strings.HasSuffix(*stdlibModule, "_stdlib") {
+		fmt.Fprintln(os.Stderr, "Error: --stdlib expects a module ending in _stdlib, like quint_stdlib")
+		os.Exit(1)
+	}
+	if *stdlibModule != "" && (*libPath != "" || *schemaDir != "") {
+		fmt.Fprintln(os.Stderr, "Error: --stdlib cannot be combined with --lib or --schema, which need the contract")
+		os.Exit(1)
 	}
-
-	// print the map of types
-	// for key, value := range namedTypeMap {
-	// 	fmt.Println(key, value)
-	// }
 
 	var declarations []Decl
 
 	// go through the modules
-	for _, module := range data["modules"].([]interface{}) {
-		// ignore modules ending in _stdlib or _test
-		moduleMap := module.(map[string]interface{})
-		if strings.HasSuffix(moduleMap["name"].(string), "_stdlib") || strings.HasSuffix(moduleMap["name"].(string), "_test") {
+	for _, module := range data.Modules {
+		if !translator.translates(module.Name) {
 			continue
 		}
 
 		// collect all declarations
-		for _, decl := range moduleMap["declarations"].([]interface{}) {
-			declMap := decl.(map[string]interface{})
-			switch declMap["kind"] {
-			case "typedef":
-				var declaration Decl
-				name := declMap["name"].(string)
-				declType := resolveType(declMap["type"].(map[string]interface{}))
-
-				// if the type is a StructType, this should be a struct decl, otherwise a type decl
-				if _, ok := declType.(*StructType); ok {
-					structType := declType.(*StructType)
-
-					// this is a struct decl
-					attrs := []string{"derive(Clone, Debug, Default, PartialEq, Eq, Hash, Serialize, Deserialize)"}
-					declaration = &StructDecl{Name: name, Fields: structType.Fields, Attrs: attrs}
-				} else {
-					// this is a type decl
-					declaration = &TypeDecl{Name: name, Type: declType}
+		for _, decl := range module.Declarations {
+			translator.enter(module.Name, decl)
+
+			switch d := decl.(type) {
+			case *quintir.TypeDef:
+				// resolveTypeDef returns nil for types that rust already has, like Option
+				if declaration := translator.resolveTypeDef(d); declaration != nil {
+					declarations = append(declarations, declaration)
 				}
-				declarations = append(declarations, declaration)
-				// fmt.Println(typeDef)
-			case "import":
+			case *quintir.Import:
 				// ignore imports
-			case "def":
-				declarations = append(declarations, resolveDef(declMap))
+			case *quintir.OpDef:
+				// resolveDef returns nil for definitions it could not translate, after reporting why
+				if declaration := translator.resolveDef(d); declaration != nil {
+					declarations = append(declarations, declaration)
+				}
 			default:
-				fmt.Println("kind not supported: " + declMap["kind"].(string))
+				translator.errorf(decl, "kind not supported: %s", decl.Kind())
+			}
+		}
+	}
+
+	// the copies of the polymorphic defs for the types they are called with
+	declarations = append(declarations, translator.resolveInstances()...)
+
+	var invariants []string
+	if *checkInvariants {
+		for _, module := range data.Modules {
+			if !strings.HasSuffix(module.Name, "_test") {
+				continue
+			}
+			predicates, skipped := translator.resolveInvariants(module)
+			for _, predicate := range predicates {
+				declarations = append(declarations, predicate)
+				invariants = append(invariants, predicate.Name)
+			}
+			for _, name := range skipped {
+				fmt.Fprintf(os.Stderr, "Not checking the invariant %s in the contract, it reads state variables that only exist in the tests\n", name)
 			}
 		}
 	}
 
+	// generate the entry points before reporting, so that their problems are reported too
+	var lib *Program
+	var schemas map[string]Schema
+	if *libPath != "" || *schemaDir != "" {
+		if *contractModule == "" {
+			*contractModule = "contract::" + strings.TrimSuffix(filepath.Base(outputFilePath), filepath.Ext(outputFilePath))
+		}
+		for _, module := range data.Modules {
+			if strings.HasSuffix(module.Name, "_entrypoints") {
+				lib = translator.generateGlue(module, *contractModule, invariants)
+				break
+			}
+		}
+		if lib == nil {
+			fmt.Fprintln(os.Stderr, "Error generating entry points: the model has no module ending in _entrypoints")
+			os.Exit(1)
+		}
+		if *schemaDir != "" {
+			schemas = translator.generateSchemas(lib, declarations)
+		}
+	}
+
+	if !translator.diagnostics.Check(os.Stderr, *allowTodo) {
+		os.Exit(1)
+	}
+
 	// hard code some dependencies we might need. rust can just ignore what we do not need
 	imports := []Import{
 		{Path: "im::HashMap"},
 		{Path: "im::HashSet"},
 		{Path: "im::Vector"},
 		{Path: "serde::{Serialize, Deserialize}"},
-		{Path: "super::neutron_stdlib::*"},
-		{Path: "super::wasm_stdlib::*"},
+	}
+	if *stdlibModule == "" {
+		imports = append(imports, Import{Path: "super::neutron_stdlib::*"}, Import{Path: "super::wasm_stdlib::*"})
+	} else {
+		// a stdlib module uses the stdlib modules it imports
+		imports = append(imports, stdlibImports(data, *stdlibModule)...)
 	}
 
 	program := Program{
-		Imports: imports,
-		Decls:   declarations,
+		Imports:       imports,
+		Decls:         declarations,
+		QuintComments: *quintComments,
 	}
 
-	err = os.WriteFile(outputFilePath, []byte(program.PrettyPrint(0)), 0o644)
+	code, mappings := program.Render()
+	err = os.WriteFile(outputFilePath, []byte(code), 0o644)
 	if err != nil {
-		fmt.Println("Error writing file:", err)
-		return
+		fmt.Fprintln(os.Stderr, "Error writing file:", err)
+		os.Exit(1)
 	}
 
 	fmt.Println("Wrote output to ", outputFilePath)
+
+	if *libPath != "" {
+		code, _ := lib.Render()
+		if err := os.WriteFile(*libPath, []byte(code), 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing file:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Wrote entry points to ", *libPath)
+	}
+
+	if *schemaDir != "" {
+		if err := writeSchemas(*schemaDir, schemas); err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing schemas:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Wrote schemas to ", *schemaDir)
+	}
+
+	if *sourceMapPath != "" {
+		if err := writeSourceMap(*sourceMapPath, outputFilePath, mappings); err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing source map:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Wrote source map to ", *sourceMapPath)
+	}
 }
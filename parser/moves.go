@@ -0,0 +1,192 @@
+package main
+
+import "strings"
+
+// the values of quint can be used any number of times, but rust moves a value that is passed by value, like
+// the m of `f(m)`, after which it cannot be used again. cloneReused clones the variables that are passed by
+// value and used again later in the function, in the order rust evaluates them. integers and booleans are Copy,
+// and the receivers of methods and borrowed values are not moved, so they are not cloned. the uses in the
+// other branch of an if or match do not count, since only one of the branches is evaluated.
+
+// variableUse is a use of a variable, or a let that binds it again, in the order of evaluation
+type variableUse struct {
+	name string
+	// the place of the variable in its parent, for uses that move it
+	slot *Expr
+	// the let binds the name to another value, so that the following uses are not uses of this one
+	binds bool
+	// the branches of the ifs and matches the use is in
+	branches []branch
+}
+
+// branch is a branch of an if or match, the arm of the conditional with the given id
+type branch struct {
+	conditional, arm int
+}
+
+// exclusive checks if the uses are in different branches of the same if or match
+func (u variableUse) exclusive(other variableUse) bool {
+	for _, a := range u.branches {
+		for _, b := range other.branches {
+			if a.conditional == b.conditional && a.arm != b.arm {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// moveAnalysis collects the uses of variables in the order of evaluation
+type moveAnalysis struct {
+	uses         []variableUse
+	branches     []branch
+	conditionals int
+}
+
+// cloneReused clones the variables of the statements that are moved before they are used again
+func cloneReused(stmts []Stmt) {
+	a := &moveAnalysis{}
+	for _, stmt := range stmts {
+		a.stmt(stmt)
+	}
+	a.cloneMoved()
+}
+
+// cloneMoved clones the uses that move a variable which is used again
+func (a *moveAnalysis) cloneMoved() {
+	for i, use := range a.uses {
+		if use.slot == nil {
+			continue
+		}
+		for _, later := range a.uses[i+1:] {
+			if later.name != use.name || use.exclusive(later) {
+				continue
+			}
+			if !later.binds {
+				*use.slot = &MethodCall{Value: *use.slot, MethodName: "clone"}
+			}
+			break
+		}
+	}
+}
+
+func (a *moveAnalysis) add(use variableUse) {
+	use.branches = append([]branch(nil), a.branches...)
+	a.uses = append(a.uses, use)
+}
+
+func (a *moveAnalysis) bind(variable string, names []string) {
+	if len(names) == 0 {
+		names = []string{variable}
+	}
+	for _, name := range names {
+		a.add(variableUse{name: name, binds: true})
+	}
+}
+
+func (a *moveAnalysis) stmt(stmt Stmt) {
+	switch s := stmt.(type) {
+	case *LetStmt:
+		a.expr(&s.Value, true)
+		a.bind(s.VariableName, s.Names)
+	case *Assign:
+		a.expr(&s.Value, true)
+		a.expr(&s.Dest, false)
+	case *Return:
+		a.expr(&s.Value, true)
+	case *ExprStmt:
+		a.expr(&s.Value, false)
+	}
+}
+
+// expr collects the uses of the expression in slot. moves tells if its value is moved where it is used.
+func (a *moveAnalysis) expr(slot *Expr, moves bool) {
+	switch e := (*slot).(type) {
+	case *Variable:
+		use := variableUse{name: e.VariableName}
+		if moves && !e.Copy {
+			use.slot = slot
+		}
+		a.add(use)
+	case *Block:
+		for _, stmt := range e.Statements {
+			a.stmt(stmt)
+		}
+	case *Let:
+		a.expr(&e.Value, true)
+		a.bind(e.VariableName, e.Names)
+		a.expr(&e.Body, moves)
+	case *FunctionCall:
+		a.exprs(e.Arguments, true)
+	case *StaticMethodCall:
+		a.exprs(e.Arguments, true)
+	case *MethodCall:
+		a.expr(&e.Value, false)
+		a.exprs(e.Arguments, true)
+	case *StructCons:
+		for i := range e.Fields {
+			a.expr(&e.Fields[i].Value, true)
+		}
+	case *EnumCons:
+		a.exprs(e.Params, true)
+	case *Tuple:
+		a.exprs(e.Values, true)
+	case *Macro:
+		// the assertions compare references to their arguments
+		a.exprs(e.Args, !strings.HasPrefix(e.Name, "assert") && e.Name != "matches")
+	case *Borrow:
+		a.expr(&e.Value, false)
+	case *FieldAccess:
+		a.expr(&e.Value, false)
+	case *Try:
+		a.expr(&e.Value, moves)
+	case *UnaryOp:
+		a.expr(&e.Value, false)
+	case *BinaryOp:
+		// comparisons take references, the other operators take their operands by value, like + on vectors
+		compares := map[string]bool{"==": true, "!=": true, "<": true, ">": true, "<=": true, ">=": true}[e.Op]
+		a.expr(&e.Left, !compares)
+		a.expr(&e.Right, !compares)
+	case *IfElse:
+		a.expr(&e.Condition, false)
+		id := a.conditional()
+		a.arm(id, 0, &e.Then, moves)
+		a.arm(id, 1, &e.Else, moves)
+	case *Match:
+		a.expr(&e.Value, true)
+		id := a.conditional()
+		for i := range e.Arms {
+			a.arm(id, i, &e.Arms[i].Body, moves)
+		}
+	case *Closure:
+		// the closure may be called many times, so its body is analyzed on its own. it borrows what it
+		// captures, so the captured variables are used but not moved where the closure is.
+		inner := &moveAnalysis{}
+		inner.expr(&e.Body, true)
+		inner.cloneMoved()
+		for _, use := range inner.uses {
+			if !use.binds {
+				a.add(variableUse{name: use.name})
+			}
+		}
+	}
+}
+
+func (a *moveAnalysis) exprs(exprs []Expr, moves bool) {
+	for i := range exprs {
+		a.expr(&exprs[i], moves)
+	}
+}
+
+// conditional returns the id of a new if or match
+func (a *moveAnalysis) conditional() int {
+	a.conditionals++
+	return a.conditionals
+}
+
+// arm collects the uses of a branch of the conditional
+func (a *moveAnalysis) arm(conditional, arm int, slot *Expr, moves bool) {
+	a.branches = append(a.branches, branch{conditional: conditional, arm: arm})
+	a.expr(slot, moves)
+	a.branches = a.branches[:len(a.branches)-1]
+}
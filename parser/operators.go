@@ -0,0 +1,21 @@
+package main
+
+// integerOperators maps the quint operators on integers to the rust operators
+var integerOperators = map[string]string{
+	"iadd": "+",
+	"isub": "-",
+	"imul": "*",
+	"idiv": "/",
+	"imod": "%",
+	"igt":  ">",
+	"ilt":  "<",
+	"igte": ">=",
+	"ilte": "<=",
+}
+
+// tryInto converts value into the integer type rust expects, like the u32 exponent of pow,
+// panicking if it does not fit
+func tryInto(value Expr) Expr {
+	converted := &MethodCall{Value: value, MethodName: "try_into"}
+	return &MethodCall{Value: converted, MethodName: "unwrap"}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"piwasm/quintir"
+)
+
+// without sum types, the model has to use sentinels for optional values, like 0 for a missing timeout.
+// with them, a sum type with exactly the variants Some(a) and None, like `type Option[a] = Some(a) | None`,
+// is an option and becomes rust's Option<T>: Some(x) and None construct it, a match on it matches Some and None,
+// and the helpers of the stdlib for options become the methods of Option.
+
+// optionHelpers maps the names of the stdlib helpers for options to the methods of Option they stand for.
+// the helpers take the option as their first parameter.
+var optionHelpers = map[string]string{
+	"isSome":    "is_some",
+	"is_some":   "is_some",
+	"isNone":    "is_none",
+	"is_none":   "is_none",
+	"unwrap":    "unwrap",
+	"unwrapOr":  "unwrap_or",
+	"unwrap_or": "unwrap_or",
+}
+
+// optionPayload returns the type of the value of typ if it is an option, like int for `Option[int]`
+func (t *translator) optionPayload(typ quintir.Type) (quintir.Type, bool) {
+	var args []quintir.Type
+	if app, ok := typ.(*quintir.AppType); ok {
+		typ, args = app.Ctor, app.Args
+	}
+	var params []string
+	if constType, ok := typ.(*quintir.ConstType); ok {
+		if typeDef := t.typeDefs[constType.Name]; typeDef != nil {
+			params = typeDef.Params
+		}
+	}
+
+	sum, ok := t.records.expand(typ).(*quintir.SumType)
+	if !ok {
+		return nil, false
+	}
+	fields, closed := quintir.RowFields(sum.Fields)
+	if !closed || len(fields) != 2 {
+		return nil, false
+	}
+	var payload quintir.Type
+	for _, field := range fields {
+		switch {
+		case field.FieldName == "Some":
+			payload = field.FieldType
+		case field.FieldName != "None" || !isUnitType(field.FieldType):
+			return nil, false
+		}
+	}
+	if payload == nil {
+		return nil, false
+	}
+
+	// the value of a polymorphic option is the type argument for its type variable
+	if v, ok := payload.(*quintir.VarType); ok {
+		for i, param := range params {
+			if param == v.Name && i < len(args) {
+				return args[i], true
+			}
+		}
+	}
+	return payload, true
+}
+
+// asOption returns typ as an option, following typedefs like `type MaybeHeight = Some(int) | None`,
+// or nil if it is no option
+func (t *translator) asOption(typ Type) *OptionType {
+	switch tt := typ.(type) {
+	case *OptionType:
+		return tt
+	case *ConstType:
+		typeDef := t.typeDefs[tt.Name]
+		if typeDef == nil || len(typeDef.Params) > 0 {
+			return nil
+		}
+		if payload, ok := t.optionPayload(typeDef.Type); ok {
+			return &OptionType{ValueType: t.resolveType(payload)}
+		}
+	}
+	return nil
+}
+
+// optionType returns the option type of expr, or nil if expr is no option
+func (t *translator) optionType(expr quintir.Expr, exprType Type) *OptionType {
+	if isKnown(exprType) {
+		return t.asOption(exprType)
+	}
+	return t.asOption(t.typeOf(expr))
+}
+
+// resolveOptionVariant translates the construction of an option, Some(x) or None
+func (t *translator) resolveOptionVariant(label *quintir.StrLit, value quintir.Expr, option *OptionType) Expr {
+	switch label.Value {
+	case "Some":
+		return &FunctionCall{FunctionName: "Some", Arguments: []Expr{t.resolveExpr(value, option.ValueType)}}
+	case "None":
+		return &Variable{VariableName: "None"}
+	}
+	t.errorf(label, "options have no variant %s", label.Value)
+	return newTodo()
+}
+
+// optionPattern returns the pattern of a case of a match on an option
+func optionPattern(label string, binding string) Expr {
+	if label == "Some" {
+		return &FunctionCall{FunctionName: "Some", Arguments: []Expr{&Variable{VariableName: binding}}}
+	}
+	return &Variable{VariableName: label}
+}
+
+// optionHelper returns the method of Option that a call of def stands for, or "" if def is no helper for options
+func (t *translator) optionHelper(def *quintir.OpDef) string {
+	method, ok := optionHelpers[def.Name]
+	if !ok {
+		return ""
+	}
+	operType, ok := t.defType(def).(*quintir.OperType)
+	if !ok || len(operType.Args) == 0 {
+		return ""
+	}
+	if _, ok := t.optionPayload(operType.Args[0]); !ok {
+		return ""
+	}
+	return method
+}
+
+// resolveOptionHelper translates a call of a stdlib helper for options, like `unwrapOr(timeout, 0)`,
+// into the method of Option, `timeout.unwrap_or(0)`
+func (t *translator) resolveOptionHelper(call *quintir.App, method string) Expr {
+	var optionType, valueType Type
+	if option := t.optionType(call.Args[0], nil); option != nil {
+		optionType, valueType = option, option.ValueType
+	}
+	value := t.resolveExpr(call.Args[0], optionType)
+	var arguments []Expr
+	for _, arg := range call.Args[1:] {
+		arguments = append(arguments, t.resolveExpr(arg, valueType))
+	}
+	return &MethodCall{Value: value, MethodName: method, Arguments: arguments}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"piwasm/quintir"
+)
+
+// overrides are hand-written rust bodies for the definitions whose translation is impossible or not usable,
+// keyed by the qualified quint name `module::def`. the signature is still translated from the model,
+// so the bodies use the parameter names of the model.
+var overrides = map[string]string{
+	// removing keys is a method of the map, instead of rebuilding the map from the remaining keys
+	"quint_stdlib::mapRemove":    "__map.without(&__key)",
+	"quint_stdlib::mapRemoveAll": "__keys.iter().fold(__map, |map, key| map.without(key))",
+}
+
+// resolveBody translates the body of the pure def, or returns its hand-written body if it has one
+func (t *translator) resolveBody(def *quintir.OpDef, body quintir.Expr, returnType Type) Block {
+	if code, ok := overrides[t.defModules[def.ID]+"::"+def.Name]; ok {
+		return Block{Statements: []Stmt{&Verbatim{Code: code}}}
+	}
+	return t.resolveBlock(body, returnType)
+}
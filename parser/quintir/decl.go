@@ -0,0 +1,290 @@
+package quintir
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Declaration is one of OpDef, Var, Const, Assume, TypeDef, Import, Export or Instance.
+type Declaration interface {
+	Node
+	isDeclaration()
+}
+
+type (
+	// an operator definition, e.g. `pure def`, `pure val`, `action` or `run`.
+	// for definitions with parameters, Expr is a Lambda and TypeAnnotation an OperType.
+	OpDef struct {
+		ID             int
+		Name           string
+		Qualifier      string
+		Expr           Expr
+		TypeAnnotation Type
+		Doc            string
+	}
+	// a state variable
+	Var struct {
+		ID             int
+		Name           string
+		TypeAnnotation Type
+	}
+	Const struct {
+		ID             int
+		Name           string
+		TypeAnnotation Type
+	}
+	Assume struct {
+		ID         int
+		Name       string
+		Assumption Expr
+	}
+	// a type alias; Type is nil for uninterpreted types
+	TypeDef struct {
+		ID   int
+		Name string
+		Type Type
+		// the type variables of a polymorphic typedef, like a in `type Option[a] = Some(a) | None`
+		Params []string
+	}
+	Import struct {
+		ID         int
+		DefName    string
+		ProtoName  string
+		FromSource string
+	}
+	Export struct {
+		ID            int
+		DefName       string
+		ProtoName     string
+		QualifiedName string
+	}
+	Instance struct {
+		ID               int
+		QualifiedName    string
+		ProtoName        string
+		Overrides        json.RawMessage
+		IdentityOverride bool
+		FromSource       string
+	}
+	// a parameter of a lambda, as it appears in the lookup table
+	Param struct {
+		ID             int
+		Name           string
+		TypeAnnotation Type
+	}
+)
+
+func (d *OpDef) QuintID() int    { return d.ID }
+func (d *Var) QuintID() int      { return d.ID }
+func (d *Const) QuintID() int    { return d.ID }
+func (d *Assume) QuintID() int   { return d.ID }
+func (d *TypeDef) QuintID() int  { return d.ID }
+func (d *Import) QuintID() int   { return d.ID }
+func (d *Export) QuintID() int   { return d.ID }
+func (d *Instance) QuintID() int { return d.ID }
+func (d *Param) QuintID() int    { return d.ID }
+
+func (d *OpDef) Kind() string    { return "def" }
+func (d *Var) Kind() string      { return "var" }
+func (d *Const) Kind() string    { return "const" }
+func (d *Assume) Kind() string   { return "assume" }
+func (d *TypeDef) Kind() string  { return "typedef" }
+func (d *Import) Kind() string   { return "import" }
+func (d *Export) Kind() string   { return "export" }
+func (d *Instance) Kind() string { return "instance" }
+func (d *Param) Kind() string    { return "param" }
+
+func (*OpDef) isDeclaration()    {}
+func (*Var) isDeclaration()      {}
+func (*Const) isDeclaration()    {}
+func (*Assume) isDeclaration()   {}
+func (*TypeDef) isDeclaration()  {}
+func (*Import) isDeclaration()   {}
+func (*Export) isDeclaration()   {}
+func (*Instance) isDeclaration() {}
+func (*Param) isDeclaration()    {}
+
+// LookupDef is an entry of the lookup table: the referenced definition,
+// plus where it was imported from.
+type LookupDef struct {
+	Def          Declaration
+	ImportedFrom Declaration
+	Hidden       bool
+	Depth        int
+}
+
+// Name returns the name of the referenced definition, or "" for imports and exports.
+func (l *LookupDef) Name() string {
+	return DeclarationName(l.Def)
+}
+
+// DeclarationName returns the name a declaration introduces, or "" if it does not introduce one.
+func DeclarationName(decl Declaration) string {
+	switch d := decl.(type) {
+	case *OpDef:
+		return d.Name
+	case *Var:
+		return d.Name
+	case *Const:
+		return d.Name
+	case *Assume:
+		return d.Name
+	case *TypeDef:
+		return d.Name
+	case *Param:
+		return d.Name
+	case *Instance:
+		return d.QualifiedName
+	}
+	return ""
+}
+
+func decodeLookupDef(data []byte) (*LookupDef, error) {
+	var raw struct {
+		ImportedFrom json.RawMessage `json:"importedFrom"`
+		Hidden       bool            `json:"hidden"`
+		Depth        int             `json:"depth"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	def, err := decodeDeclaration(data)
+	if err != nil {
+		return nil, err
+	}
+	importedFrom, err := decodeOptional(raw.ImportedFrom, decodeDeclaration)
+	if err != nil {
+		return nil, fmt.Errorf("importedFrom: %w", err)
+	}
+	return &LookupDef{Def: def, ImportedFrom: importedFrom, Hidden: raw.Hidden, Depth: raw.Depth}, nil
+}
+
+func decodeOpDef(data []byte) (*OpDef, error) {
+	decl, err := decodeDeclaration(data)
+	if err != nil {
+		return nil, err
+	}
+	def, ok := decl.(*OpDef)
+	if !ok {
+		return nil, fmt.Errorf("declaration %d: expected def, got %s", decl.QuintID(), decl.Kind())
+	}
+	return def, nil
+}
+
+func decodeDeclaration(data []byte) (Declaration, error) {
+	kind, id, err := kindOf(data)
+	if err != nil {
+		return nil, fmt.Errorf("declaration: %w", err)
+	}
+
+	var decl Declaration
+	switch kind {
+	case "def":
+		var raw struct {
+			ID             int             `json:"id"`
+			Name           string          `json:"name"`
+			Qualifier      string          `json:"qualifier"`
+			Expr           json.RawMessage `json:"expr"`
+			TypeAnnotation json.RawMessage `json:"typeAnnotation"`
+			Doc            string          `json:"doc"`
+		}
+		if err = json.Unmarshal(data, &raw); err != nil {
+			break
+		}
+		def := &OpDef{ID: raw.ID, Name: raw.Name, Qualifier: raw.Qualifier, Doc: raw.Doc}
+		if def.Expr, err = decodeExpr(raw.Expr); err != nil {
+			break
+		}
+		def.TypeAnnotation, err = decodeOptional(raw.TypeAnnotation, decodeType)
+		decl = def
+	case "var", "const", "param":
+		var raw struct {
+			ID             int             `json:"id"`
+			Name           string          `json:"name"`
+			TypeAnnotation json.RawMessage `json:"typeAnnotation"`
+		}
+		if err = json.Unmarshal(data, &raw); err != nil {
+			break
+		}
+		var typeAnnotation Type
+		if typeAnnotation, err = decodeOptional(raw.TypeAnnotation, decodeType); err != nil {
+			break
+		}
+		switch kind {
+		case "var":
+			decl = &Var{ID: raw.ID, Name: raw.Name, TypeAnnotation: typeAnnotation}
+		case "const":
+			decl = &Const{ID: raw.ID, Name: raw.Name, TypeAnnotation: typeAnnotation}
+		default:
+			decl = &Param{ID: raw.ID, Name: raw.Name, TypeAnnotation: typeAnnotation}
+		}
+	case "assume":
+		var raw struct {
+			ID         int             `json:"id"`
+			Name       string          `json:"name"`
+			Assumption json.RawMessage `json:"assumption"`
+		}
+		if err = json.Unmarshal(data, &raw); err != nil {
+			break
+		}
+		assume := &Assume{ID: raw.ID, Name: raw.Name}
+		assume.Assumption, err = decodeExpr(raw.Assumption)
+		decl = assume
+	case "typedef":
+		var raw struct {
+			ID     int             `json:"id"`
+			Name   string          `json:"name"`
+			Type   json.RawMessage `json:"type"`
+			Params []string        `json:"params"`
+		}
+		if err = json.Unmarshal(data, &raw); err != nil {
+			break
+		}
+		typeDef := &TypeDef{ID: raw.ID, Name: raw.Name, Params: raw.Params}
+		typeDef.Type, err = decodeOptional(raw.Type, decodeType)
+		decl = typeDef
+	case "import":
+		var raw struct {
+			ID         int    `json:"id"`
+			DefName    string `json:"defName"`
+			ProtoName  string `json:"protoName"`
+			FromSource string `json:"fromSource"`
+		}
+		err = json.Unmarshal(data, &raw)
+		decl = &Import{ID: raw.ID, DefName: raw.DefName, ProtoName: raw.ProtoName, FromSource: raw.FromSource}
+	case "export":
+		var raw struct {
+			ID            int    `json:"id"`
+			DefName       string `json:"defName"`
+			ProtoName     string `json:"protoName"`
+			QualifiedName string `json:"qualifiedName"`
+		}
+		err = json.Unmarshal(data, &raw)
+		decl = &Export{ID: raw.ID, DefName: raw.DefName, ProtoName: raw.ProtoName, QualifiedName: raw.QualifiedName}
+	case "instance":
+		var raw struct {
+			ID               int             `json:"id"`
+			QualifiedName    string          `json:"qualifiedName"`
+			ProtoName        string          `json:"protoName"`
+			Overrides        json.RawMessage `json:"overrides"`
+			IdentityOverride bool            `json:"identityOverride"`
+			FromSource       string          `json:"fromSource"`
+		}
+		err = json.Unmarshal(data, &raw)
+		decl = &Instance{
+			ID:               raw.ID,
+			QualifiedName:    raw.QualifiedName,
+			ProtoName:        raw.ProtoName,
+			Overrides:        raw.Overrides,
+			IdentityOverride: raw.IdentityOverride,
+			FromSource:       raw.FromSource,
+		}
+	default:
+		return nil, fmt.Errorf("declaration %d: unknown kind %q", id, kind)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s declaration %d: %w", kind, id, err)
+	}
+	return decl, nil
+}
@@ -0,0 +1,259 @@
+package quintir
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeType(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want Type
+		// a part of the error, if decoding fails
+		err string
+	}{
+		{name: "int", json: `{"id": 3, "kind": "int"}`, want: &IntType{ID: 3}},
+		{name: "const", json: `{"kind": "const", "name": "Addr"}`, want: &ConstType{Name: "Addr"}},
+		{name: "var", json: `{"kind": "var", "name": "a"}`, want: &VarType{Name: "a"}},
+		{
+			name: "set",
+			json: `{"kind": "set", "elem": {"kind": "str"}}`,
+			want: &SetType{Elem: &StrType{}},
+		},
+		{
+			name: "map",
+			json: `{"kind": "fun", "arg": {"kind": "str"}, "res": {"kind": "int"}}`,
+			want: &FunType{Arg: &StrType{}, Res: &IntType{}},
+		},
+		{
+			name: "operator",
+			json: `{"kind": "oper", "args": [{"kind": "int"}, {"kind": "bool"}], "res": {"kind": "int"}}`,
+			want: &OperType{Args: []Type{&IntType{}, &BoolType{}}, Res: &IntType{}},
+		},
+		{
+			name: "record",
+			json: `{"kind": "rec", "fields": {"kind": "row", "fields": [
+				{"fieldName": "a", "fieldType": {"kind": "int"}},
+				{"fieldName": "b", "fieldType": {"kind": "str"}}
+			], "other": {"kind": "empty"}}}`,
+			want: &RecType{Fields: &RowCons{
+				Fields: []RowField{{FieldName: "a", FieldType: &IntType{}}, {FieldName: "b", FieldType: &StrType{}}},
+				Other:  &EmptyRow{},
+			}},
+		},
+		{
+			name: "open record",
+			json: `{"kind": "rec", "fields": {"kind": "row", "fields": [
+				{"fieldName": "a", "fieldType": {"kind": "int"}}
+			], "other": {"kind": "var", "name": "r"}}}`,
+			want: &RecType{Fields: &RowCons{
+				Fields: []RowField{{FieldName: "a", FieldType: &IntType{}}},
+				Other:  &RowVar{Name: "r"},
+			}},
+		},
+		{
+			name: "sum",
+			json: `{"kind": "sum", "fields": {"kind": "row", "fields": [
+				{"fieldName": "A", "fieldType": {"kind": "int"}}
+			], "other": {"kind": "empty"}}}`,
+			want: &SumType{Fields: &RowCons{
+				Fields: []RowField{{FieldName: "A", FieldType: &IntType{}}},
+				Other:  &EmptyRow{},
+			}},
+		},
+		{
+			name: "application",
+			json: `{"kind": "app", "ctor": {"kind": "const", "name": "Option"}, "args": [{"kind": "int"}]}`,
+			want: &AppType{Ctor: &ConstType{Name: "Option"}, Args: []Type{&IntType{}}},
+		},
+		{name: "unknown kind", json: `{"id": 7, "kind": "float"}`, err: `type 7: unknown kind "float"`},
+		{name: "no kind", json: `{"id": 7}`, err: "object without kind"},
+		{name: "sum without fields", json: `{"kind": "sum", "fields": {"kind": "empty"}}`, err: "sum type with empty row"},
+		{name: "bad element", json: `{"kind": "list", "elem": {"kind": "float"}}`, err: `list type 0: type 0: unknown kind "float"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := decodeType([]byte(test.json))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeExpr(t *testing.T) {
+	huge, _ := new(big.Int).SetString("340282366920938463463374607431768211456", 10)
+	tests := []struct {
+		name string
+		json string
+		want Expr
+		err  string
+	}{
+		{name: "name", json: `{"id": 1, "kind": "name", "name": "x"}`, want: &Name{ID: 1, Name: "x"}},
+		{name: "bool", json: `{"id": 1, "kind": "bool", "value": true}`, want: &BoolLit{ID: 1, Value: true}},
+		{
+			name: "integer beyond 64 bits",
+			json: `{"id": 1, "kind": "int", "value": 340282366920938463463374607431768211456}`,
+			want: &IntLit{ID: 1, Value: huge},
+		},
+		{name: "string", json: `{"id": 1, "kind": "str", "value": "ok"}`, want: &StrLit{ID: 1, Value: "ok"}},
+		{
+			name: "application",
+			json: `{"id": 3, "kind": "app", "opcode": "iadd", "args": [
+				{"id": 1, "kind": "name", "name": "x"},
+				{"id": 2, "kind": "int", "value": 1}
+			]}`,
+			want: &App{ID: 3, Opcode: "iadd", Args: []Expr{&Name{ID: 1, Name: "x"}, &IntLit{ID: 2, Value: new(big.Int).SetInt64(1)}}},
+		},
+		{
+			name: "lambda",
+			json: `{"id": 3, "kind": "lambda", "qualifier": "puredef", "params": [{"id": 1, "name": "x"}],
+				"expr": {"id": 2, "kind": "name", "name": "x"}}`,
+			want: &Lambda{ID: 3, Qualifier: "puredef", Params: []LambdaParam{{ID: 1, Name: "x"}}, Expr: &Name{ID: 2, Name: "x"}},
+		},
+		{
+			name: "let",
+			json: `{"id": 4, "kind": "let",
+				"opdef": {"id": 1, "kind": "def", "name": "y", "qualifier": "pureval", "expr": {"id": 2, "kind": "bool", "value": false}},
+				"expr": {"id": 3, "kind": "name", "name": "y"}}`,
+			want: &Let{
+				ID:    4,
+				Opdef: &OpDef{ID: 1, Name: "y", Qualifier: "pureval", Expr: &BoolLit{ID: 2}},
+				Expr:  &Name{ID: 3, Name: "y"},
+			},
+		},
+		{name: "unknown kind", json: `{"id": 5, "kind": "goto"}`, err: `expression 5: unknown kind "goto"`},
+		{
+			name: "bad argument",
+			json: `{"id": 3, "kind": "app", "opcode": "not", "args": [{"id": 1}]}`,
+			err:  "app expression 3: expression: object without kind",
+		},
+		{
+			name: "let of a variable",
+			json: `{"id": 4, "kind": "let", "opdef": {"id": 1, "kind": "var", "name": "v", "typeAnnotation": {"kind": "int"}},
+				"expr": {"id": 3, "kind": "name", "name": "v"}}`,
+			err: "declaration 1: expected def, got var",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := decodeExpr([]byte(test.json))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+// output is the typechecker output of `module m { pure val one: int = 1  pure val two = one + one }`,
+// with its source map
+const output = `{
+	"stage": "typechecking",
+	"warnings": [],
+	"modules": [{"id": 10, "name": "m", "declarations": [
+		{"id": 2, "kind": "def", "name": "one", "qualifier": "pureval", "expr": {"id": 1, "kind": "int", "value": 1},
+			"typeAnnotation": {"id": 3, "kind": "int"}},
+		{"id": 7, "kind": "def", "name": "two", "qualifier": "pureval", "expr": {"id": 6, "kind": "app", "opcode": "iadd", "args": [
+			{"id": 4, "kind": "name", "name": "one"},
+			{"id": 5, "kind": "name", "name": "one"}
+		]}}
+	]}],
+	"table": {
+		"4": {"id": 2, "kind": "def", "name": "one", "qualifier": "pureval", "expr": {"id": 1, "kind": "int", "value": 1}, "depth": 0},
+		"5": {"id": 2, "kind": "def", "name": "one", "qualifier": "pureval", "expr": {"id": 1, "kind": "int", "value": 1}, "depth": 0}
+	},
+	"types": {
+		"6": {"type": {"kind": "int"}, "typeVariables": {}, "rowVariables": {}},
+		"7": {"type": {"kind": "int"}, "typeVariables": {}, "rowVariables": {}}
+	},
+	"effects": {},
+	"sourceMap": {
+		"6": {"source": "m.qnt", "start": {"line": 2, "col": 17, "index": 40}, "end": {"line": 2, "col": 26, "index": 49}}
+	}
+}`
+
+func TestParse(t *testing.T) {
+	ir, err := Parse([]byte(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	module := ir.Module("m")
+	if module == nil || len(module.Declarations) != 2 {
+		t.Fatalf("got module %#v, want m with 2 declarations", module)
+	}
+	if ir.Module("n") != nil {
+		t.Errorf("found a module n that does not exist")
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{name: "lookup", got: ir.Lookup(4).Name(), want: "one"},
+		{name: "lookup of a definition", got: ir.Lookup(7), want: (*LookupDef)(nil)},
+		{name: "type", got: ir.TypeOf(6), want: Type(&IntType{})},
+		{name: "missing type", got: ir.TypeOf(4), want: Type(nil)},
+		{name: "source location", got: ir.SourceMap[6].String(), want: "m.qnt:3:18"},
+		{name: "annotation", got: module.Declarations[0].(*OpDef).TypeAnnotation, want: Type(&IntType{ID: 3})},
+		{name: "no annotation", got: module.Declarations[1].(*OpDef).TypeAnnotation, want: Type(nil)},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s: got %#v, want %#v", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		err  string
+	}{
+		{
+			name: "bad declaration",
+			json: `{"modules": [{"id": 1, "name": "m", "declarations": [{"id": 2, "kind": "macro"}]}]}`,
+			err:  `module m: declaration 2: unknown kind "macro"`,
+		},
+		{
+			name: "bad table entry",
+			json: `{"modules": [], "table": {"4": {"id": 2}}}`,
+			err:  "table entry 4: declaration: object without kind",
+		},
+		{
+			name: "bad source map",
+			json: `{"modules": [], "sourceMap": {"4": "m.qnt"}}`,
+			err:  "sourceMap:",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse([]byte(test.json))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("got error %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+}
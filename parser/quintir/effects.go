@@ -0,0 +1,170 @@
+package quintir
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Effect is one of ConcreteEffect, EffectVar or ArrowEffect.
+type Effect interface {
+	Kind() string
+	isEffect()
+}
+
+type (
+	ConcreteEffect struct {
+		Components []EffectComponent
+	}
+	EffectVar struct {
+		Name string
+	}
+	// the effect of an operator with parameters
+	ArrowEffect struct {
+		Params []Effect
+		Result Effect
+	}
+)
+
+// EffectComponent says that an effect reads, updates or temporally depends on an entity.
+type EffectComponent struct {
+	// one of "read", "update" or "temporal"
+	Kind   string
+	Entity Entity
+}
+
+func (e *ConcreteEffect) Kind() string { return "concrete" }
+func (e *EffectVar) Kind() string      { return "variable" }
+func (e *ArrowEffect) Kind() string    { return "arrow" }
+
+func (*ConcreteEffect) isEffect() {}
+func (*EffectVar) isEffect()      {}
+func (*ArrowEffect) isEffect()    {}
+
+// Entity is one of ConcreteEntity, EntityVar or EntityUnion.
+type Entity interface {
+	Kind() string
+	isEntity()
+}
+
+type (
+	// a set of state variables
+	ConcreteEntity struct {
+		StateVariables []StateVariable
+	}
+	EntityVar struct {
+		Name string
+	}
+	EntityUnion struct {
+		Entities []Entity
+	}
+)
+
+type StateVariable struct {
+	Name string `json:"name"`
+	// the id of the var declaration
+	Reference int `json:"reference"`
+}
+
+func (e *ConcreteEntity) Kind() string { return "concrete" }
+func (e *EntityVar) Kind() string      { return "variable" }
+func (e *EntityUnion) Kind() string    { return "union" }
+
+func (*ConcreteEntity) isEntity() {}
+func (*EntityVar) isEntity()      {}
+func (*EntityUnion) isEntity()    {}
+
+func decodeEffect(data []byte) (Effect, error) {
+	kind, _, err := kindOf(data)
+	if err != nil {
+		return nil, fmt.Errorf("effect: %w", err)
+	}
+
+	switch kind {
+	case "concrete":
+		var raw struct {
+			Components []struct {
+				Kind   string          `json:"kind"`
+				Entity json.RawMessage `json:"entity"`
+			} `json:"components"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		effect := &ConcreteEffect{}
+		for _, component := range raw.Components {
+			entity, err := decodeEntity(component.Entity)
+			if err != nil {
+				return nil, fmt.Errorf("%s component: %w", component.Kind, err)
+			}
+			effect.Components = append(effect.Components, EffectComponent{Kind: component.Kind, Entity: entity})
+		}
+		return effect, nil
+	case "variable":
+		var raw struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		return &EffectVar{Name: raw.Name}, nil
+	case "arrow":
+		var raw struct {
+			Params []json.RawMessage `json:"params"`
+			Result json.RawMessage   `json:"result"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		params, err := decodeList(raw.Params, decodeEffect)
+		if err != nil {
+			return nil, err
+		}
+		result, err := decodeEffect(raw.Result)
+		if err != nil {
+			return nil, err
+		}
+		return &ArrowEffect{Params: params, Result: result}, nil
+	default:
+		return nil, fmt.Errorf("effect: unknown kind %q", kind)
+	}
+}
+
+func decodeEntity(data []byte) (Entity, error) {
+	kind, _, err := kindOf(data)
+	if err != nil {
+		return nil, fmt.Errorf("entity: %w", err)
+	}
+
+	switch kind {
+	case "concrete":
+		var raw struct {
+			StateVariables []StateVariable `json:"stateVariables"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		return &ConcreteEntity{StateVariables: raw.StateVariables}, nil
+	case "variable":
+		var raw struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		return &EntityVar{Name: raw.Name}, nil
+	case "union":
+		var raw struct {
+			Entities []json.RawMessage `json:"entities"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		entities, err := decodeList(raw.Entities, decodeEntity)
+		if err != nil {
+			return nil, err
+		}
+		return &EntityUnion{Entities: entities}, nil
+	default:
+		return nil, fmt.Errorf("entity: unknown kind %q", kind)
+	}
+}
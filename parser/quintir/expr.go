@@ -0,0 +1,192 @@
+package quintir
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// Node is implemented by everything in the IR that carries a Quint id.
+type Node interface {
+	QuintID() int
+	Kind() string
+}
+
+// Expr is one of Name, BoolLit, IntLit, StrLit, App, Lambda or Let.
+type Expr interface {
+	Node
+	isExpr()
+}
+
+type (
+	// a reference to a variable, parameter or definition
+	Name struct {
+		ID   int
+		Name string
+	}
+	BoolLit struct {
+		ID    int
+		Value bool
+	}
+	// Quint integers are unbounded, so they are kept as big integers here
+	IntLit struct {
+		ID    int
+		Value *big.Int
+	}
+	StrLit struct {
+		ID    int
+		Value string
+	}
+	// an application of a builtin operator or a user definition
+	App struct {
+		ID     int
+		Opcode string
+		Args   []Expr
+	}
+	Lambda struct {
+		ID        int
+		Params    []LambdaParam
+		Qualifier string
+		Expr      Expr
+	}
+	// let opdef in expr, which is what `val x = ...` inside a def turns into
+	Let struct {
+		ID    int
+		Opdef *OpDef
+		Expr  Expr
+	}
+)
+
+type LambdaParam struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func (e *Name) QuintID() int    { return e.ID }
+func (e *BoolLit) QuintID() int { return e.ID }
+func (e *IntLit) QuintID() int  { return e.ID }
+func (e *StrLit) QuintID() int  { return e.ID }
+func (e *App) QuintID() int     { return e.ID }
+func (e *Lambda) QuintID() int  { return e.ID }
+func (e *Let) QuintID() int     { return e.ID }
+
+func (e *Name) Kind() string    { return "name" }
+func (e *BoolLit) Kind() string { return "bool" }
+func (e *IntLit) Kind() string  { return "int" }
+func (e *StrLit) Kind() string  { return "str" }
+func (e *App) Kind() string     { return "app" }
+func (e *Lambda) Kind() string  { return "lambda" }
+func (e *Let) Kind() string     { return "let" }
+
+func (*Name) isExpr()    {}
+func (*BoolLit) isExpr() {}
+func (*IntLit) isExpr()  {}
+func (*StrLit) isExpr()  {}
+func (*App) isExpr()     {}
+func (*Lambda) isExpr()  {}
+func (*Let) isExpr()     {}
+
+func decodeExpr(data []byte) (Expr, error) {
+	kind, id, err := kindOf(data)
+	if err != nil {
+		return nil, fmt.Errorf("expression: %w", err)
+	}
+
+	var expr Expr
+	switch kind {
+	case "name":
+		var raw struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		}
+		err = json.Unmarshal(data, &raw)
+		expr = &Name{ID: raw.ID, Name: raw.Name}
+	case "bool":
+		var raw struct {
+			ID    int  `json:"id"`
+			Value bool `json:"value"`
+		}
+		err = json.Unmarshal(data, &raw)
+		expr = &BoolLit{ID: raw.ID, Value: raw.Value}
+	case "int":
+		var raw struct {
+			ID    int      `json:"id"`
+			Value *big.Int `json:"value"`
+		}
+		err = json.Unmarshal(data, &raw)
+		expr = &IntLit{ID: raw.ID, Value: raw.Value}
+	case "str":
+		var raw struct {
+			ID    int    `json:"id"`
+			Value string `json:"value"`
+		}
+		err = json.Unmarshal(data, &raw)
+		expr = &StrLit{ID: raw.ID, Value: raw.Value}
+	case "app":
+		var raw struct {
+			ID     int               `json:"id"`
+			Opcode string            `json:"opcode"`
+			Args   []json.RawMessage `json:"args"`
+		}
+		if err = json.Unmarshal(data, &raw); err != nil {
+			break
+		}
+		app := &App{ID: raw.ID, Opcode: raw.Opcode}
+		app.Args, err = decodeList(raw.Args, decodeExpr)
+		expr = app
+	case "lambda":
+		var raw struct {
+			ID        int             `json:"id"`
+			Params    []LambdaParam   `json:"params"`
+			Qualifier string          `json:"qualifier"`
+			Expr      json.RawMessage `json:"expr"`
+		}
+		if err = json.Unmarshal(data, &raw); err != nil {
+			break
+		}
+		lambda := &Lambda{ID: raw.ID, Params: raw.Params, Qualifier: raw.Qualifier}
+		lambda.Expr, err = decodeExpr(raw.Expr)
+		expr = lambda
+	case "let":
+		var raw struct {
+			ID    int             `json:"id"`
+			Opdef json.RawMessage `json:"opdef"`
+			Expr  json.RawMessage `json:"expr"`
+		}
+		if err = json.Unmarshal(data, &raw); err != nil {
+			break
+		}
+		let := &Let{ID: raw.ID}
+		if let.Opdef, err = decodeOpDef(raw.Opdef); err != nil {
+			break
+		}
+		let.Expr, err = decodeExpr(raw.Expr)
+		expr = let
+	default:
+		return nil, fmt.Errorf("expression %d: unknown kind %q", id, kind)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s expression %d: %w", kind, id, err)
+	}
+	return expr, nil
+}
+
+// Walk calls visit for expr and all of its subexpressions, including the definitions of lets, parents first.
+func Walk(expr Expr, visit func(Expr)) {
+	if expr == nil {
+		return
+	}
+	visit(expr)
+	switch e := expr.(type) {
+	case *App:
+		for _, arg := range e.Args {
+			Walk(arg, visit)
+		}
+	case *Lambda:
+		Walk(e.Expr, visit)
+	case *Let:
+		Walk(e.Opdef.Expr, visit)
+		Walk(e.Expr, visit)
+	}
+}
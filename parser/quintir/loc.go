@@ -0,0 +1,38 @@
+package quintir
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Loc is a range in a quint source file.
+// Lines and columns are zero-based, as written by quint.
+type Loc struct {
+	Source string `json:"source"`
+	Start  Pos    `json:"start"`
+	End    *Pos   `json:"end,omitempty"`
+}
+
+type Pos struct {
+	Line  int `json:"line"`
+	Col   int `json:"col"`
+	Index int `json:"index"`
+}
+
+// String prints the start of the location as file:line:col, with one-based line and column
+func (l *Loc) String() string {
+	return fmt.Sprintf("%s:%d:%d", l.Source, l.Start.Line+1, l.Start.Col+1)
+}
+
+// decodeSourceMap decodes the optional source map, which maps ids to the location of their node.
+// the typechecker does not always write one, in which case the result is empty.
+func decodeSourceMap(data json.RawMessage) (map[int]*Loc, error) {
+	sourceMap := make(map[int]*Loc)
+	if len(data) == 0 || string(data) == "null" {
+		return sourceMap, nil
+	}
+	if err := json.Unmarshal(data, &sourceMap); err != nil {
+		return nil, fmt.Errorf("sourceMap: %w", err)
+	}
+	return sourceMap, nil
+}
@@ -0,0 +1,231 @@
+// Package quintir decodes the JSON written by `quint typecheck --out` into typed Go structs.
+//
+// Every sum type of the Quint IR (expressions, declarations, types, rows, effects, entities)
+// is represented by a Go interface, and decoding dispatches on the `kind` field of the JSON
+// object. Unknown kinds and malformed objects are reported as errors instead of panicking.
+package quintir
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Output is the whole document produced by the typechecker.
+type Output struct {
+	Stage    string
+	Warnings []json.RawMessage
+	Modules  []*Module
+	// Table maps the id of every name (or operator application) to the definition it refers to.
+	Table map[int]*LookupDef
+	// Types maps the id of every expression and definition to its inferred type.
+	Types map[int]*TypeScheme
+	// Effects maps the id of every expression and definition to its inferred effect.
+	Effects map[int]*EffectScheme
+	// SourceMap maps ids to their location in the quint sources. It is empty if the output has no source map.
+	SourceMap map[int]*Loc
+}
+
+// Load reads and decodes the typechecker output stored at path.
+func Load(path string) (*Output, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	output, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return output, nil
+}
+
+// Parse decodes the typechecker output from its JSON representation.
+func Parse(data []byte) (*Output, error) {
+	var output Output
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, err
+	}
+	return &output, nil
+}
+
+func (o *Output) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Stage     string                  `json:"stage"`
+		Warnings  []json.RawMessage       `json:"warnings"`
+		Modules   []*Module               `json:"modules"`
+		Table     map[int]json.RawMessage `json:"table"`
+		Types     map[int]*TypeScheme     `json:"types"`
+		Effects   map[int]*EffectScheme   `json:"effects"`
+		SourceMap json.RawMessage         `json:"sourceMap"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	table := make(map[int]*LookupDef, len(raw.Table))
+	for id, entry := range raw.Table {
+		def, err := decodeLookupDef(entry)
+		if err != nil {
+			return fmt.Errorf("table entry %d: %w", id, err)
+		}
+		table[id] = def
+	}
+
+	sourceMap, err := decodeSourceMap(raw.SourceMap)
+	if err != nil {
+		return err
+	}
+
+	*o = Output{
+		Stage:     raw.Stage,
+		Warnings:  raw.Warnings,
+		Modules:   raw.Modules,
+		Table:     table,
+		Types:     raw.Types,
+		Effects:   raw.Effects,
+		SourceMap: sourceMap,
+	}
+	return nil
+}
+
+// Module returns the module with the given name, or nil if there is none.
+func (o *Output) Module(name string) *Module {
+	for _, module := range o.Modules {
+		if module.Name == name {
+			return module
+		}
+	}
+	return nil
+}
+
+// TypeOf returns the inferred type of the expression or definition with the given id,
+// or nil if the typechecker did not record one.
+func (o *Output) TypeOf(id int) Type {
+	scheme, ok := o.Types[id]
+	if !ok {
+		return nil
+	}
+	return scheme.Type
+}
+
+// Lookup returns the definition that the name with the given id refers to, or nil.
+func (o *Output) Lookup(id int) *LookupDef {
+	return o.Table[id]
+}
+
+type Module struct {
+	ID           int
+	Name         string
+	Declarations []Declaration
+}
+
+func (m *Module) QuintID() int { return m.ID }
+
+func (m *Module) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ID           int               `json:"id"`
+		Name         string            `json:"name"`
+		Declarations []json.RawMessage `json:"declarations"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	decls, err := decodeList(raw.Declarations, decodeDeclaration)
+	if err != nil {
+		return fmt.Errorf("module %s: %w", raw.Name, err)
+	}
+	*m = Module{ID: raw.ID, Name: raw.Name, Declarations: decls}
+	return nil
+}
+
+// TypeScheme is a type together with its quantified variables.
+type TypeScheme struct {
+	Type          Type
+	TypeVariables json.RawMessage
+	RowVariables  json.RawMessage
+}
+
+func (s *TypeScheme) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Type          json.RawMessage `json:"type"`
+		TypeVariables json.RawMessage `json:"typeVariables"`
+		RowVariables  json.RawMessage `json:"rowVariables"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	typ, err := decodeType(raw.Type)
+	if err != nil {
+		return err
+	}
+	*s = TypeScheme{Type: typ, TypeVariables: raw.TypeVariables, RowVariables: raw.RowVariables}
+	return nil
+}
+
+// EffectScheme is an effect together with its quantified variables.
+type EffectScheme struct {
+	Effect          Effect
+	EffectVariables json.RawMessage
+	EntityVariables json.RawMessage
+}
+
+func (s *EffectScheme) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Effect          json.RawMessage `json:"effect"`
+		EffectVariables json.RawMessage `json:"effectVariables"`
+		EntityVariables json.RawMessage `json:"entityVariables"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	effect, err := decodeEffect(raw.Effect)
+	if err != nil {
+		return err
+	}
+	*s = EffectScheme{Effect: effect, EffectVariables: raw.EffectVariables, EntityVariables: raw.EntityVariables}
+	return nil
+}
+
+// kindOf extracts the `kind` discriminator (and the id, if there is one) of a JSON object.
+func kindOf(data []byte) (string, int, error) {
+	var header struct {
+		ID   int    `json:"id"`
+		Kind string `json:"kind"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return "", 0, err
+	}
+	if header.Kind == "" {
+		return "", header.ID, fmt.Errorf("object without kind: %s", truncate(data))
+	}
+	return header.Kind, header.ID, nil
+}
+
+func decodeList[T any](items []json.RawMessage, decode func([]byte) (T, error)) ([]T, error) {
+	result := make([]T, len(items))
+	for i, item := range items {
+		value, err := decode(item)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = value
+	}
+	return result, nil
+}
+
+// decodeOptional decodes data unless it is absent, in which case the zero value is returned.
+func decodeOptional[T any](data json.RawMessage, decode func([]byte) (T, error)) (T, error) {
+	if len(data) == 0 || string(data) == "null" {
+		var zero T
+		return zero, nil
+	}
+	return decode(data)
+}
+
+func truncate(data []byte) string {
+	const max = 120
+	if len(data) > max {
+		return string(data[:max]) + "..."
+	}
+	return string(data)
+}
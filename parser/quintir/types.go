@@ -0,0 +1,357 @@
+package quintir
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Type is one of the Quint types below. Types inside the `types` section usually have no id,
+// in which case QuintID returns 0.
+type Type interface {
+	Node
+	isType()
+}
+
+type (
+	BoolType struct{ ID int }
+	IntType  struct{ ID int }
+	StrType  struct{ ID int }
+	// a reference to a type defined with `type Name = ...`
+	ConstType struct {
+		ID   int
+		Name string
+	}
+	// a type variable, e.g. `a` in `Set[a]`
+	VarType struct {
+		ID   int
+		Name string
+	}
+	SetType struct {
+		ID   int
+		Elem Type
+	}
+	ListType struct {
+		ID   int
+		Elem Type
+	}
+	// a map, written `Arg -> Res`
+	FunType struct {
+		ID  int
+		Arg Type
+		Res Type
+	}
+	// the type of an operator, written `(Args) => Res`
+	OperType struct {
+		ID   int
+		Args []Type
+		Res  Type
+	}
+	// a tuple; the row fields are named "0", "1", ...
+	TupType struct {
+		ID     int
+		Fields Row
+	}
+	RecType struct {
+		ID     int
+		Fields Row
+	}
+	// a disjoint union of records, discriminated by the field Tag
+	UnionType struct {
+		ID      int
+		Tag     string
+		Records []UnionRecord
+	}
+	// a sum type, where each row field is a variant with its payload as type
+	SumType struct {
+		ID     int
+		Fields *RowCons
+	}
+	// the application of a polymorphic typedef to type arguments, e.g. `Option[int]`
+	AppType struct {
+		ID   int
+		Ctor Type
+		Args []Type
+	}
+)
+
+type UnionRecord struct {
+	TagValue string
+	Fields   Row
+}
+
+func (t *BoolType) QuintID() int  { return t.ID }
+func (t *IntType) QuintID() int   { return t.ID }
+func (t *StrType) QuintID() int   { return t.ID }
+func (t *ConstType) QuintID() int { return t.ID }
+func (t *VarType) QuintID() int   { return t.ID }
+func (t *SetType) QuintID() int   { return t.ID }
+func (t *ListType) QuintID() int  { return t.ID }
+func (t *FunType) QuintID() int   { return t.ID }
+func (t *OperType) QuintID() int  { return t.ID }
+func (t *TupType) QuintID() int   { return t.ID }
+func (t *RecType) QuintID() int   { return t.ID }
+func (t *UnionType) QuintID() int { return t.ID }
+func (t *SumType) QuintID() int   { return t.ID }
+func (t *AppType) QuintID() int   { return t.ID }
+
+func (t *BoolType) Kind() string  { return "bool" }
+func (t *IntType) Kind() string   { return "int" }
+func (t *StrType) Kind() string   { return "str" }
+func (t *ConstType) Kind() string { return "const" }
+func (t *VarType) Kind() string   { return "var" }
+func (t *SetType) Kind() string   { return "set" }
+func (t *ListType) Kind() string  { return "list" }
+func (t *FunType) Kind() string   { return "fun" }
+func (t *OperType) Kind() string  { return "oper" }
+func (t *TupType) Kind() string   { return "tup" }
+func (t *RecType) Kind() string   { return "rec" }
+func (t *UnionType) Kind() string { return "union" }
+func (t *SumType) Kind() string   { return "sum" }
+func (t *AppType) Kind() string   { return "app" }
+
+func (*BoolType) isType()  {}
+func (*IntType) isType()   {}
+func (*StrType) isType()   {}
+func (*ConstType) isType() {}
+func (*VarType) isType()   {}
+func (*SetType) isType()   {}
+func (*ListType) isType()  {}
+func (*FunType) isType()   {}
+func (*OperType) isType()  {}
+func (*TupType) isType()   {}
+func (*RecType) isType()   {}
+func (*UnionType) isType() {}
+func (*SumType) isType()   {}
+func (*AppType) isType()   {}
+
+// Row is the field list of a record or tuple: RowCons, RowVar or EmptyRow.
+type Row interface {
+	Kind() string
+	isRow()
+}
+
+type (
+	// a list of fields, followed by the rest of the row
+	RowCons struct {
+		Fields []RowField
+		Other  Row
+	}
+	// an unknown rest of a row, e.g. in the type of an operator that accesses a single field
+	RowVar struct {
+		Name string
+	}
+	EmptyRow struct{}
+)
+
+type RowField struct {
+	FieldName string
+	FieldType Type
+}
+
+func (r *RowCons) Kind() string  { return "row" }
+func (r *RowVar) Kind() string   { return "var" }
+func (r *EmptyRow) Kind() string { return "empty" }
+
+func (*RowCons) isRow()  {}
+func (*RowVar) isRow()   {}
+func (*EmptyRow) isRow() {}
+
+// RowFields returns all fields of a row, following Other until the row ends.
+// The second result is false if the row ends in a row variable, i.e. it is open.
+func RowFields(row Row) ([]RowField, bool) {
+	var fields []RowField
+	for {
+		switch r := row.(type) {
+		case *RowCons:
+			fields = append(fields, r.Fields...)
+			row = r.Other
+		case *RowVar:
+			return fields, false
+		default:
+			return fields, true
+		}
+	}
+}
+
+func decodeType(data []byte) (Type, error) {
+	kind, id, err := kindOf(data)
+	if err != nil {
+		return nil, fmt.Errorf("type: %w", err)
+	}
+
+	var typ Type
+	switch kind {
+	case "bool":
+		typ = &BoolType{ID: id}
+	case "int":
+		typ = &IntType{ID: id}
+	case "str":
+		typ = &StrType{ID: id}
+	case "const", "var":
+		var raw struct {
+			Name string `json:"name"`
+		}
+		err = json.Unmarshal(data, &raw)
+		if kind == "const" {
+			typ = &ConstType{ID: id, Name: raw.Name}
+		} else {
+			typ = &VarType{ID: id, Name: raw.Name}
+		}
+	case "set", "list":
+		var raw struct {
+			Elem json.RawMessage `json:"elem"`
+		}
+		if err = json.Unmarshal(data, &raw); err != nil {
+			break
+		}
+		var elem Type
+		if elem, err = decodeType(raw.Elem); err != nil {
+			break
+		}
+		if kind == "set" {
+			typ = &SetType{ID: id, Elem: elem}
+		} else {
+			typ = &ListType{ID: id, Elem: elem}
+		}
+	case "fun":
+		var raw struct {
+			Arg json.RawMessage `json:"arg"`
+			Res json.RawMessage `json:"res"`
+		}
+		if err = json.Unmarshal(data, &raw); err != nil {
+			break
+		}
+		fun := &FunType{ID: id}
+		if fun.Arg, err = decodeType(raw.Arg); err != nil {
+			break
+		}
+		fun.Res, err = decodeType(raw.Res)
+		typ = fun
+	case "oper":
+		var raw struct {
+			Args []json.RawMessage `json:"args"`
+			Res  json.RawMessage   `json:"res"`
+		}
+		if err = json.Unmarshal(data, &raw); err != nil {
+			break
+		}
+		oper := &OperType{ID: id}
+		if oper.Args, err = decodeList(raw.Args, decodeType); err != nil {
+			break
+		}
+		oper.Res, err = decodeType(raw.Res)
+		typ = oper
+	case "tup", "rec", "sum":
+		var raw struct {
+			Fields json.RawMessage `json:"fields"`
+		}
+		if err = json.Unmarshal(data, &raw); err != nil {
+			break
+		}
+		var fields Row
+		if fields, err = decodeRow(raw.Fields); err != nil {
+			break
+		}
+		switch kind {
+		case "tup":
+			typ = &TupType{ID: id, Fields: fields}
+		case "rec":
+			typ = &RecType{ID: id, Fields: fields}
+		default:
+			cons, ok := fields.(*RowCons)
+			if !ok {
+				err = fmt.Errorf("sum type with %s row", fields.Kind())
+				break
+			}
+			typ = &SumType{ID: id, Fields: cons}
+		}
+	case "union":
+		var raw struct {
+			Tag     string `json:"tag"`
+			Records []struct {
+				TagValue string          `json:"tagValue"`
+				Fields   json.RawMessage `json:"fields"`
+			} `json:"records"`
+		}
+		if err = json.Unmarshal(data, &raw); err != nil {
+			break
+		}
+		union := &UnionType{ID: id, Tag: raw.Tag}
+		for _, record := range raw.Records {
+			var fields Row
+			if fields, err = decodeRow(record.Fields); err != nil {
+				break
+			}
+			union.Records = append(union.Records, UnionRecord{TagValue: record.TagValue, Fields: fields})
+		}
+		typ = union
+	case "app":
+		var raw struct {
+			Ctor json.RawMessage   `json:"ctor"`
+			Args []json.RawMessage `json:"args"`
+		}
+		if err = json.Unmarshal(data, &raw); err != nil {
+			break
+		}
+		app := &AppType{ID: id}
+		if app.Ctor, err = decodeType(raw.Ctor); err != nil {
+			break
+		}
+		app.Args, err = decodeList(raw.Args, decodeType)
+		typ = app
+	default:
+		return nil, fmt.Errorf("type %d: unknown kind %q", id, kind)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s type %d: %w", kind, id, err)
+	}
+	return typ, nil
+}
+
+func decodeRow(data []byte) (Row, error) {
+	kind, _, err := kindOf(data)
+	if err != nil {
+		return nil, fmt.Errorf("row: %w", err)
+	}
+
+	switch kind {
+	case "row":
+		var raw struct {
+			Fields []struct {
+				FieldName string          `json:"fieldName"`
+				FieldType json.RawMessage `json:"fieldType"`
+			} `json:"fields"`
+			Other json.RawMessage `json:"other"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		row := &RowCons{}
+		for _, field := range raw.Fields {
+			fieldType, err := decodeType(field.FieldType)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.FieldName, err)
+			}
+			row.Fields = append(row.Fields, RowField{FieldName: field.FieldName, FieldType: fieldType})
+		}
+		other, err := decodeRow(raw.Other)
+		if err != nil {
+			return nil, err
+		}
+		row.Other = other
+		return row, nil
+	case "var":
+		var raw struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		return &RowVar{Name: raw.Name}, nil
+	case "empty":
+		return &EmptyRow{}, nil
+	default:
+		return nil, fmt.Errorf("row: unknown kind %q", kind)
+	}
+}
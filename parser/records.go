@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"piwasm/quintir"
+)
+
+// recordResolver maps anonymous quint record types to the named typedefs they are structurally equal to.
+// quint records are structural, so `{msg: "..."}` only becomes an Error by matching its fields against the
+// declared typedefs, while rust needs the name of the struct.
+type recordResolver struct {
+	// all typedefs by name, used to expand aliases like Addr = str
+	typeDefs map[string]*quintir.TypeDef
+	// typedefs of record types, keyed by their sorted field names
+	byFields map[string][]*quintir.TypeDef
+	// names of the record typedefs in declaration order, for records with an open row
+	names []string
+	// names of the sum typedefs in declaration order
+	sums []string
+}
+
+func newRecordResolver(modules []*quintir.Module) *recordResolver {
+	r := &recordResolver{
+		typeDefs: make(map[string]*quintir.TypeDef),
+		byFields: make(map[string][]*quintir.TypeDef),
+	}
+	for _, module := range modules {
+		for _, decl := range module.Declarations {
+			typeDef, ok := decl.(*quintir.TypeDef)
+			if !ok {
+				continue
+			}
+			r.typeDefs[typeDef.Name] = typeDef
+			if _, ok := typeDef.Type.(*quintir.SumType); ok {
+				r.sums = append(r.sums, typeDef.Name)
+			}
+
+			rec, ok := typeDef.Type.(*quintir.RecType)
+			if !ok {
+				continue
+			}
+			fields, _ := quintir.RowFields(rec.Fields)
+			key := fieldsKey(fields)
+			r.byFields[key] = append(r.byFields[key], typeDef)
+			r.names = append(r.names, typeDef.Name)
+		}
+	}
+	return r
+}
+
+// fieldsKey returns the sorted, comma-separated field names of a record
+func fieldsKey(fields []quintir.RowField) string {
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.FieldName
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// resolve returns the name of the unique typedef that matches rec.
+// it returns an error if no typedef, or more than one, matches.
+func (r *recordResolver) resolve(rec *quintir.RecType) (string, error) {
+	fields, closed := quintir.RowFields(rec.Fields)
+
+	var candidates []*quintir.TypeDef
+	if closed {
+		candidates = r.byFields[fieldsKey(fields)]
+	} else {
+		// the record may have more fields than we know of, so every record typedef is a candidate
+		for _, name := range r.names {
+			candidates = append(candidates, r.typeDefs[name])
+		}
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if r.matches(rec, candidate.Type) {
+			matches = append(matches, candidate.Name)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no typedef matches the record %s", recordString(fields, closed))
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("the record %s is ambiguous, it matches %s", recordString(fields, closed), strings.Join(matches, ", "))
+	}
+}
+
+// resolveSum returns the name of the unique typedef that declares the sum type, like resolve does for records
+func (r *recordResolver) resolveSum(sum *quintir.SumType) (string, error) {
+	var matches []string
+	for _, name := range r.sums {
+		if r.matches(sum, r.typeDefs[name].Type) {
+			matches = append(matches, name)
+		}
+	}
+	fields, _ := quintir.RowFields(sum.Fields)
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no typedef declares the sum type with the variants %s", recordString(fields, true))
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("the sum type with the variants %s is ambiguous, it matches %s", recordString(fields, true), strings.Join(matches, ", "))
+	}
+}
+
+// expand replaces a reference to a typedef by the type it stands for
+func (r *recordResolver) expand(typ quintir.Type) quintir.Type {
+	for {
+		constType, ok := typ.(*quintir.ConstType)
+		if !ok {
+			return typ
+		}
+		typeDef, ok := r.typeDefs[constType.Name]
+		if !ok || typeDef.Type == nil {
+			return typ
+		}
+		typ = typeDef.Type
+	}
+}
+
+// matches checks whether the inferred type a can be the declared type b.
+// type variables and open rows in a match anything, and so do the type variables of b.
+func (r *recordResolver) matches(a, b quintir.Type) bool {
+	if _, ok := a.(*quintir.VarType); ok {
+		return true
+	}
+	if _, ok := b.(*quintir.VarType); ok {
+		// a parameter of a polymorphic typedef
+		return true
+	}
+	// compare named types by name first, so that distinct uninterpreted types do not match
+	if ca, ok := a.(*quintir.ConstType); ok {
+		if cb, ok := b.(*quintir.ConstType); ok && ca.Name == cb.Name {
+			return true
+		}
+	}
+
+	a, b = r.expand(a), r.expand(b)
+	switch ta := a.(type) {
+	case *quintir.BoolType, *quintir.IntType, *quintir.StrType:
+		return a.Kind() == b.Kind()
+	case *quintir.ConstType:
+		tb, ok := b.(*quintir.ConstType)
+		return ok && ta.Name == tb.Name
+	case *quintir.SetType:
+		tb, ok := b.(*quintir.SetType)
+		return ok && r.matches(ta.Elem, tb.Elem)
+	case *quintir.ListType:
+		tb, ok := b.(*quintir.ListType)
+		return ok && r.matches(ta.Elem, tb.Elem)
+	case *quintir.FunType:
+		tb, ok := b.(*quintir.FunType)
+		return ok && r.matches(ta.Arg, tb.Arg) && r.matches(ta.Res, tb.Res)
+	case *quintir.TupType:
+		tb, ok := b.(*quintir.TupType)
+		return ok && r.rowsMatch(ta.Fields, tb.Fields)
+	case *quintir.RecType:
+		tb, ok := b.(*quintir.RecType)
+		return ok && r.rowsMatch(ta.Fields, tb.Fields)
+	case *quintir.SumType:
+		tb, ok := b.(*quintir.SumType)
+		return ok && r.rowsMatch(ta.Fields, tb.Fields)
+	}
+	return false
+}
+
+// rowsMatch checks that every field of the inferred row a is a field of b with a matching type,
+// and, unless a is open, that b has no other fields
+func (r *recordResolver) rowsMatch(a, b quintir.Row) bool {
+	fieldsA, closedA := quintir.RowFields(a)
+	fieldsB, _ := quintir.RowFields(b)
+	if closedA && len(fieldsA) != len(fieldsB) {
+		return false
+	}
+
+	typesB := make(map[string]quintir.Type, len(fieldsB))
+	for _, field := range fieldsB {
+		typesB[field.FieldName] = field.FieldType
+	}
+	for _, field := range fieldsA {
+		typeB, ok := typesB[field.FieldName]
+		if !ok || !r.matches(field.FieldType, typeB) {
+			return false
+		}
+	}
+	return true
+}
+
+// recordString prints the field names of a record for diagnostics, e.g. `{ data, msg, ... }`
+func recordString(fields []quintir.RowField, closed bool) string {
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.FieldName
+	}
+	if !closed {
+		names = append(names, "...")
+	}
+	return "{ " + strings.Join(names, ", ") + " }"
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"piwasm/quintir"
+)
+
+// row builds the row of a record, tuple or sum type from pairs of field names and types. it is closed unless
+// open is set.
+func row(open bool, fields ...interface{}) *quintir.RowCons {
+	cons := &quintir.RowCons{Other: &quintir.EmptyRow{}}
+	if open {
+		cons.Other = &quintir.RowVar{Name: "r"}
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		cons.Fields = append(cons.Fields, quintir.RowField{FieldName: fields[i].(string), FieldType: fields[i+1].(quintir.Type)})
+	}
+	return cons
+}
+
+func record(fields ...interface{}) *quintir.RecType {
+	return &quintir.RecType{Fields: row(false, fields...)}
+}
+
+func openRecord(fields ...interface{}) *quintir.RecType {
+	return &quintir.RecType{Fields: row(true, fields...)}
+}
+
+// testResolver declares the typedefs of the tests in two modules, like the stdlib and the contract
+func testResolver() *recordResolver {
+	str, integer := &quintir.StrType{}, &quintir.IntType{}
+	addr := &quintir.ConstType{Name: "Addr"}
+	return newRecordResolver([]*quintir.Module{
+		{Name: "wasm_stdlib", Declarations: []quintir.Declaration{
+			&quintir.TypeDef{Name: "Addr", Type: str},
+			&quintir.TypeDef{Name: "Error", Type: record("msg", str)},
+			&quintir.TypeDef{Name: "Result", Type: record("data", str)},
+			&quintir.TypeDef{Name: "Coin", Type: record("denom", str, "amount", integer)},
+		}},
+		{Name: "contract", Declarations: []quintir.Declaration{
+			&quintir.TypeDef{Name: "Denom", Type: str},
+			&quintir.TypeDef{Name: "Owner", Type: record("owner", addr)},
+			&quintir.TypeDef{Name: "Reason", Type: record("reason", str)},
+			&quintir.TypeDef{Name: "Why", Type: record("reason", addr)},
+			&quintir.TypeDef{Name: "Balances", Type: record("balances", &quintir.FunType{Arg: addr, Res: integer})},
+			&quintir.TypeDef{Name: "Box", Type: record("value", &quintir.VarType{Name: "a"}), Params: []string{"a"}},
+			&quintir.TypeDef{Name: "Action", Type: &quintir.SumType{Fields: row(false, "Deposit", integer, "Reset", record())}},
+			&quintir.TypeDef{Name: "Token", Type: &quintir.SumType{Fields: row(false, "Native", str, "Cw20", addr)}},
+		}},
+	})
+}
+
+func TestResolveRecord(t *testing.T) {
+	str, integer := &quintir.StrType{}, &quintir.IntType{}
+	tests := []struct {
+		name   string
+		record *quintir.RecType
+		want   string
+		// a part of the error, if no unique typedef matches
+		err string
+	}{
+		{name: "same fields", record: record("msg", str), want: "Error"},
+		{name: "fields in another order", record: record("amount", integer, "denom", str), want: "Coin"},
+		{name: "alias for the field type", record: record("owner", str), want: "Owner"},
+		{name: "named field type", record: record("owner", &quintir.ConstType{Name: "Addr"}), want: "Owner"},
+		{name: "alias of the alias", record: record("denom", &quintir.ConstType{Name: "Denom"}, "amount", integer), want: "Coin"},
+		{name: "type variable", record: record("msg", &quintir.VarType{Name: "t"}), want: "Error"},
+		{name: "map field", record: record("balances", &quintir.FunType{Arg: str, Res: integer}), want: "Balances"},
+		{name: "parameter of a polymorphic typedef", record: record("value", integer), want: "Box"},
+		{name: "open row with some of the fields", record: openRecord("amount", integer), want: "Coin"},
+		{name: "missing field", record: record("denom", str), err: "no typedef matches the record { denom }"},
+		{name: "extra field", record: record("msg", str, "code", integer), err: "no typedef matches the record { msg, code }"},
+		{name: "field of another type", record: record("msg", integer), err: "no typedef matches"},
+		{name: "open row without a match", record: openRecord("code", integer), err: "no typedef matches the record { code, ... }"},
+		{name: "ambiguous", record: record("reason", str), err: "the record { reason } is ambiguous, it matches Reason, Why"},
+	}
+	r := testResolver()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := r.resolve(test.record)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got %q and error %v, want an error containing %q", got, err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveSum(t *testing.T) {
+	str, integer := &quintir.StrType{}, &quintir.IntType{}
+	tests := []struct {
+		name string
+		sum  *quintir.SumType
+		want string
+		err  string
+	}{
+		{name: "same variants", sum: &quintir.SumType{Fields: row(false, "Deposit", integer, "Reset", record())}, want: "Action"},
+		{name: "alias for the payload", sum: &quintir.SumType{Fields: row(false, "Native", str, "Cw20", str)}, want: "Token"},
+		{
+			name: "missing variant",
+			sum:  &quintir.SumType{Fields: row(false, "Deposit", integer)},
+			err:  "no typedef declares the sum type with the variants { Deposit }",
+		},
+		{
+			name: "payload of another type",
+			sum:  &quintir.SumType{Fields: row(false, "Deposit", str, "Reset", record())},
+			err:  "no typedef declares the sum type",
+		},
+	}
+	r := testResolver()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := r.resolveSum(test.sum)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got %q and error %v, want an error containing %q", got, err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  quintir.Type
+		want string
+	}{
+		{name: "alias", typ: &quintir.ConstType{Name: "Addr"}, want: "str"},
+		{name: "record typedef", typ: &quintir.ConstType{Name: "Error"}, want: "rec"},
+		{name: "uninterpreted type", typ: &quintir.ConstType{Name: "Unknown"}, want: "const"},
+		{name: "not a reference", typ: &quintir.IntType{}, want: "int"},
+	}
+	r := testResolver()
+	for _, test := range tests {
+		if got := r.expand(test.typ).Kind(); got != test.want {
+			t.Errorf("%s: got a %s type, want a %s type", test.name, got, test.want)
+		}
+	}
+}
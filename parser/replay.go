@@ -0,0 +1,577 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"piwasm/itf"
+	"piwasm/quintir"
+)
+
+// replaying a trace checks that the generated rust code behaves like the model: starting from the first state
+// of a trace written by `quint run --mbt --out-itf`, every step calls the action that was taken, translated
+// into rust, and compares the new ContractStorage with the state in the trace.
+//
+// the actions of the _test module become rust functions from the old ContractStorage to the new one.
+// actions that pick nondeterministic values and pass them to another action, like
+// `send = nondet sender = oneOf(addresses) ... send_deterministic(sender, ...)`, are replayed by calling
+// that action with the values the trace says were picked.
+
+// replayer translates the _test module and the traces
+type replayer struct {
+	t *translator
+	// the state variable that holds the ContractStorage, and its type
+	storageVar  string
+	storageType quintir.Type
+	// how each action of the _test module is replayed, by its name
+	actions map[string]*replayAction
+}
+
+// replayAction says which rust function replays an action
+type replayAction struct {
+	// the action that is translated into a rust function
+	def *quintir.OpDef
+	// for an action that calls def with nondeterministic values, the names of the values, one per parameter of def
+	picks []string
+}
+
+// namedTrace is a trace together with the name of its test
+type namedTrace struct {
+	name  string
+	trace *itf.Trace
+}
+
+// replay implements the `replay` subcommand and returns the exit code
+func replay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	allowTodo := flags.Bool("allow-todo", false, "write the output even if parts of the model or the traces could not be translated")
+	arithmetic := flags.String("arithmetic", "plain", "the --arithmetic the model was translated with")
+	intDefault := flags.String("int-default", "u64", "the --int-default the model was translated with")
+	contractModule := flags.String("contract-module", "", "the rust module of the translated model, as seen from the output file (default super::<name of the _test module without _test>)")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s replay [flags] <input file path> <output file path> <trace path>...\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Writes a rust test per ITF trace (written by `quint run --mbt --out-itf`) that replays it against the generated code")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() < 3 {
+		flags.Usage()
+		return 1
+	}
+
+	data, err := quintir.Load(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading file:", err)
+		return 1
+	}
+	var traces []namedTrace
+	for _, path := range flags.Args()[2:] {
+		trace, err := itf.Load(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading trace %s: %s\n", path, err)
+			return 1
+		}
+		traces = append(traces, namedTrace{name: testName(path), trace: trace})
+	}
+
+	var testModule *quintir.Module
+	for _, module := range data.Modules {
+		if strings.HasSuffix(module.Name, "_test") {
+			testModule = module
+			break
+		}
+	}
+	if testModule == nil {
+		fmt.Fprintln(os.Stderr, "Error replaying traces: the model has no module ending in _test")
+		return 1
+	}
+	if *contractModule == "" {
+		*contractModule = "super::" + strings.TrimSuffix(testModule.Name, "_test")
+	}
+
+	if err := validArithmetic(*arithmetic); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	if err := validIntWidth(*intDefault); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	translator := newTranslator(data)
+	translator.arithmetic = *arithmetic
+	translator.findFallible()
+	translator.intDefault = *intDefault
+	translator.inferWidths()
+	program := translator.generateReplay(testModule, *contractModule, traces)
+	if !translator.diagnostics.Check(os.Stderr, *allowTodo) {
+		return 1
+	}
+
+	outputFilePath := flags.Arg(1)
+	code, _ := program.Render()
+	if err := os.WriteFile(outputFilePath, []byte(code), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing file:", err)
+		return 1
+	}
+	fmt.Println("Wrote replay tests to ", outputFilePath)
+	return 0
+}
+
+// testName turns the file name of a trace, like out_0.itf.json, into the name of its test, like replay_out_0
+func testName(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), ".json")
+	name = strings.TrimSuffix(name, ".itf")
+	return "replay_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// generateReplay translates the _test module, and a test for every trace
+func (t *translator) generateReplay(module *quintir.Module, contractModule string, traces []namedTrace) *Program {
+	r := &replayer{t: t, actions: make(map[string]*replayAction)}
+	if storage := storageVar(module); storage != nil {
+		r.storageVar, r.storageType = storage.Name, storage.TypeAnnotation
+	}
+	if r.storageVar == "" {
+		t.context = declContext{module: module.Name}
+		t.errorf(nil, "the module has no state variable of type %s to replay", storageTypeName)
+		return &Program{}
+	}
+
+	var decls []Decl
+	for _, decl := range module.Declarations {
+		def, ok := decl.(*quintir.OpDef)
+		if !ok {
+			continue
+		}
+		t.enter(module.Name, def)
+		switch def.Qualifier {
+		case "pureval", "puredef":
+			if resolved := t.resolveDef(def); resolved != nil {
+				decls = append(decls, resolved)
+			}
+		case "action":
+			if resolved := r.resolveAction(def); resolved != nil {
+				decls = append(decls, resolved)
+			}
+		}
+	}
+
+	for _, trace := range traces {
+		decls = append(decls, r.replayTrace(trace))
+	}
+
+	return &Program{
+		InnerAttrs: []string{"cfg(test)"},
+		Imports: []Import{
+			{Path: "im::HashMap"},
+			{Path: "im::HashSet"},
+			{Path: "im::Vector"},
+			{Path: "super::neutron_stdlib::*"},
+			{Path: "super::wasm_stdlib::*"},
+			{Path: contractModule + "::*"},
+		},
+		Decls: decls,
+	}
+}
+
+// resolveAction translates an action into a function from the old storage to the new one,
+// or records which action it calls if it only picks the arguments of another action
+func (r *replayer) resolveAction(def *quintir.OpDef) Decl {
+	t := r.t
+
+	// strip the nondeterministic picks, and check if what is left is a call of another action
+	body := def.Expr
+	var nondets []string
+	for {
+		let, ok := body.(*quintir.Let)
+		if !ok || let.Opdef.Qualifier != "nondet" {
+			break
+		}
+		nondets = append(nondets, let.Opdef.Name)
+		body = let.Expr
+	}
+	if app, ok := body.(*quintir.App); ok {
+		if app.Opcode == "actionAny" {
+			// a step of the model, the trace says which of the actions was taken
+			return nil
+		}
+		if target := r.calledAction(app); target != nil && len(nondets) > 0 {
+			action := &replayAction{def: target}
+			for _, arg := range app.Args {
+				name, ok := arg.(*quintir.Name)
+				if !ok || !contains(nondets, name.Name) {
+					t.errorf(arg, "only nondeterministic values can be passed to %s to replay %s", target.Name, def.Name)
+					return nil
+				}
+				action.picks = append(action.picks, name.Name)
+			}
+			r.actions[def.Name] = action
+			return nil
+		}
+	}
+	if len(nondets) > 0 {
+		t.errorf(def, "cannot replay %s, it picks nondeterministic values without passing them to another action", def.Name)
+		return nil
+	}
+
+	storageType := t.resolveType(r.storageType)
+	params := []Param{{Name: r.storageVar, Type: storageType}}
+	if lambda, ok := def.Expr.(*quintir.Lambda); ok {
+		operType, ok := t.defType(def).(*quintir.OperType)
+		if !ok || len(operType.Args) != len(lambda.Params) {
+			t.errorf(def, "expected an operator type with %d parameters for %s", len(lambda.Params), def.Name)
+			return nil
+		}
+		for i, param := range lambda.Params {
+			params = append(params, Param{Name: param.Name, Type: t.resolveType(operType.Args[i])})
+		}
+		body = lambda.Expr
+	}
+
+	stmts, next := r.resolveActionBody(body)
+	if next == nil {
+		// the action does not change the storage
+		next = &Variable{VariableName: r.storageVar}
+	}
+	r.actions[def.Name] = &replayAction{def: def}
+	stmts = append(stmts, &Return{Value: next})
+	cloneReused(stmts)
+	return &FunctionDecl{
+		Name:       def.Name,
+		Params:     params,
+		ReturnType: storageType,
+		Body:       stmts,
+	}
+}
+
+// resolveActionBody translates the body of an action into statements, which panic if the action is not enabled,
+// and the new value of the storage, which is nil if the action does not assign it
+func (r *replayer) resolveActionBody(expr quintir.Expr) ([]Stmt, Expr) {
+	t := r.t
+	switch e := expr.(type) {
+	case *quintir.Let:
+		names := t.destructure(e)
+		body, next := r.resolveActionBody(e.Expr)
+		if let := t.resolveLetStmt(e, names); let != nil {
+			body = append([]Stmt{let}, body...)
+		}
+		return body, next
+
+	case *quintir.App:
+		switch e.Opcode {
+		case "actionAll":
+			var stmts []Stmt
+			var next Expr
+			for _, arg := range e.Args {
+				argStmts, argNext := r.resolveActionBody(arg)
+				stmts = append(stmts, argStmts...)
+				if argNext != nil {
+					next = argNext
+				}
+			}
+			return stmts, next
+
+		case "assign":
+			name, ok := e.Args[0].(*quintir.Name)
+			if !ok || name.Name != r.storageVar {
+				// the other state variables only exist for the model, e.g. for its invariants
+				return nil, nil
+			}
+			return nil, t.resolveExpr(e.Args[1], t.resolveType(r.storageType))
+		}
+
+		if target := r.calledAction(e); target != nil {
+			// the storage after the called action is the storage of this one
+			paramTypes := t.paramTypes(e)
+			args := []Expr{&Variable{VariableName: r.storageVar}}
+			for i, arg := range e.Args {
+				args = append(args, t.resolveExpr(arg, typeAt(paramTypes, i)))
+			}
+			call := t.fallibleCall(target, &FunctionCall{FunctionName: target.Name, Arguments: args})
+			t.setOrigin(call, e)
+			return []Stmt{&LetStmt{VariableName: r.storageVar, Value: call}}, &Variable{VariableName: r.storageVar}
+		}
+	}
+
+	// a boolean expression is the condition for the action to be enabled
+	return []Stmt{t.resolveAssert(expr, expr)}, nil
+}
+
+// calledAction returns the action that app calls, or nil if it does not call an action
+func (r *replayer) calledAction(app *quintir.App) *quintir.OpDef {
+	lookup := r.t.ir.Lookup(app.ID)
+	if lookup == nil {
+		return nil
+	}
+	def, ok := r.t.opDefs[lookup.Def.QuintID()]
+	if !ok || def.Qualifier != "action" {
+		return nil
+	}
+	return def
+}
+
+// replayTrace generates the test that replays a trace
+func (r *replayer) replayTrace(trace namedTrace) Decl {
+	t := r.t
+	t.context = declContext{module: trace.name}
+
+	storageType := t.resolveType(r.storageType)
+	storage := &Variable{VariableName: r.storageVar}
+	var body []Stmt
+	for i, state := range trace.trace.States {
+		value, ok := state[r.storageVar]
+		if !ok {
+			t.errorf(nil, "state %d has no %s", i, r.storageVar)
+			break
+		}
+		expected := r.valueExpr(value, r.storageType)
+		if i == 0 {
+			// the replay starts from the first state, however it was initialized
+			body = append(body, &LetStmt{VariableName: r.storageVar, Type: storageType, Value: expected})
+			continue
+		}
+
+		step := fmt.Sprintf("step %d: %s", i, state.Action())
+		call := r.replayStep(i, state)
+		if call == nil {
+			break
+		}
+		body = append(body,
+			&LetStmt{VariableName: r.storageVar, Value: call},
+			&ExprStmt{Value: &Macro{Name: "assert_eq", Args: []Expr{storage, expected, &Variable{VariableName: strconv.Quote(step)}}}},
+		)
+	}
+
+	return &FunctionDecl{Name: trace.name, Body: body, Attrs: []string{"test"}}
+}
+
+// replayStep returns the call of the action that led to the state, or nil after reporting why there is none
+func (r *replayer) replayStep(i int, state itf.State) Expr {
+	t := r.t
+	name := state.Action()
+	if name == "" {
+		t.errorf(nil, "state %d does not say which action was taken, write the trace with `quint run --mbt`", i)
+		return nil
+	}
+	action, ok := r.actions[name]
+	if !ok {
+		t.errorf(nil, "state %d: the action %s cannot be replayed", i, name)
+		return nil
+	}
+
+	args := []Expr{&Variable{VariableName: r.storageVar}}
+	if len(action.picks) > 0 {
+		operType, _ := t.defType(action.def).(*quintir.OperType)
+		for j, pick := range action.picks {
+			value, ok := state.Pick(pick)
+			if !ok {
+				t.errorf(nil, "state %d: the trace has no value for %s picked by %s", i, pick, name)
+				return nil
+			}
+			var paramType quintir.Type
+			if operType != nil && j < len(operType.Args) {
+				paramType = operType.Args[j]
+			}
+			args = append(args, r.valueExpr(value, paramType))
+		}
+	}
+	return r.t.fallibleCall(action.def, &FunctionCall{FunctionName: action.def.Name, Arguments: args})
+}
+
+// valueExpr translates a value of the trace into a rust expression of the given type
+func (r *replayer) valueExpr(value itf.Value, typ quintir.Type) Expr {
+	t := r.t
+	if payload, ok := t.optionPayload(typ); ok {
+		// options are variants too, but become rust's Option
+		if v, ok := value.(itf.Record); ok {
+			switch v["tag"] {
+			case itf.Str("Some"):
+				return &FunctionCall{FunctionName: "Some", Arguments: []Expr{r.valueExpr(v["value"], payload)}}
+			case itf.Str("None"):
+				return &Variable{VariableName: "None"}
+			}
+		}
+	}
+	switch qt := t.records.expand(typ).(type) {
+	case *quintir.IntType:
+		v, ok := value.(itf.Int)
+		if !ok {
+			break
+		}
+		if t.mixedWidths() {
+			// the width of the value is not known here, but rust infers it from where the value is used
+			return &UntypedLiteral{Value: v.Value.String()}
+		}
+		width := t.intDefault
+		if t.bigUint() != "" {
+			// the literals of the cosmwasm integers are constructed from u128
+			width = "Uint128"
+		}
+		if min, max := widthRange(width); v.Value.Cmp(min) < 0 || v.Value.Cmp(max) > 0 {
+			t.errorf(nil, "the integer %s in the trace does not fit into %s", v.Value, printNode(t.intType(), 0))
+			return newTodo()
+		}
+		return t.intLiteral(v.Value)
+	case *quintir.StrType:
+		if v, ok := value.(itf.Str); ok {
+			return &StringLiteral{Value: string(v)}
+		}
+	case *quintir.BoolType:
+		if v, ok := value.(itf.Bool); ok {
+			return &BoolLiteral{Value: bool(v)}
+		}
+	case *quintir.RecType:
+		v, ok := value.(itf.Record)
+		if !ok {
+			break
+		}
+		// records are named after the typedef they were declared with, or the one they match
+		name := typeName(typ)
+		if _, isConst := typ.(*quintir.ConstType); !isConst {
+			resolved, err := t.records.resolve(qt)
+			if err != nil {
+				t.errorf(nil, "could not name record: %s", err)
+				return newTodo()
+			}
+			name = resolved
+		}
+		if record, ok := t.taggedRecords[name]; ok {
+			return r.variantExpr(v, record, qt)
+		}
+		fields, _ := quintir.RowFields(qt.Fields)
+		cons := &StructCons{StructName: name}
+		for _, field := range fields {
+			fieldValue, ok := v[field.FieldName]
+			if !ok {
+				t.errorf(nil, "the %s in the trace has no field %s", name, field.FieldName)
+				return newTodo()
+			}
+			cons.Fields = append(cons.Fields, FieldValue{Name: field.FieldName, Value: r.valueExpr(fieldValue, field.FieldType)})
+		}
+		return cons
+	case *quintir.SumType:
+		// ITF writes variants as records with the label as tag and the payload as value
+		v, ok := value.(itf.Record)
+		label, isStr := v["tag"].(itf.Str)
+		if !ok || !isStr {
+			break
+		}
+		name := typeName(typ)
+		if _, isConst := typ.(*quintir.ConstType); !isConst {
+			resolved, err := t.records.resolveSum(qt)
+			if err != nil {
+				t.errorf(nil, "could not name sum type: %s", err)
+				return newTodo()
+			}
+			name = resolved
+		}
+		payload, ok := t.sumVariants(name)[string(label)]
+		if !ok {
+			t.errorf(nil, "the sum type %s has no variant %s", name, label)
+			return newTodo()
+		}
+		if isUnitType(payload) {
+			return &Variable{VariableName: name + "::" + string(label)}
+		}
+		return &EnumCons{EnumName: name, Variant: string(label), Params: []Expr{r.valueExpr(v["value"], payload)}}
+	case *quintir.SetType:
+		if v, ok := value.(itf.Set); ok {
+			return &Macro{Name: "im::hashset", Args: r.valueExprs(v, qt.Elem)}
+		}
+	case *quintir.ListType:
+		if v, ok := value.(itf.List); ok {
+			return &Macro{Name: "im::vector", Args: r.valueExprs(v, qt.Elem)}
+		}
+	case *quintir.TupType:
+		v, ok := value.(itf.Tup)
+		fields, _ := quintir.RowFields(qt.Fields)
+		if !ok || len(v) != len(fields) {
+			break
+		}
+		tuple := &Tuple{}
+		for i, field := range fields {
+			tuple.Values = append(tuple.Values, r.valueExpr(v[i], field.FieldType))
+		}
+		return tuple
+	case *quintir.FunType:
+		v, ok := value.(itf.Map)
+		if !ok {
+			break
+		}
+		if len(v) == 0 {
+			// an empty map has no entries that its types could be inferred from
+			if mapType := t.namedType(qt); mapType != nil {
+				return &StaticMethodCall{TypeName: mapType, MethodName: "new"}
+			}
+		}
+		// maps are built from a vector of their entries, since im::hashmap! takes `key => value` pairs
+		entries := make([]Expr, len(v))
+		for i, entry := range v {
+			entries[i] = &Tuple{Values: []Expr{r.valueExpr(entry.Key, qt.Arg), r.valueExpr(entry.Value, qt.Res)}}
+		}
+		return &StaticMethodCall{
+			TypeName:   &ConstType{Name: "HashMap"},
+			MethodName: "from",
+			Arguments:  []Expr{&Macro{Name: "vec", Args: entries}},
+		}
+	}
+
+	if value == nil {
+		t.errorf(nil, "missing value of type %s in the trace", typeName(typ))
+	} else {
+		t.errorf(nil, "cannot translate the %s %v in the trace to a %s", value.Kind(), value, typeName(typ))
+	}
+	return newTodo()
+}
+
+// variantExpr constructs the variant of a tagged record from its value in the trace, which is still a record
+func (r *replayer) variantExpr(value itf.Record, record *taggedRecord, typ *quintir.RecType) Expr {
+	t := r.t
+	tag, _ := value["tag"].(itf.Str)
+	variant := record.variant(string(tag))
+	if variant == nil {
+		t.errorf(nil, "the %s in the trace has the tag %q, which the model never constructs", record.name, tag)
+		return newTodo()
+	}
+
+	fields, _ := quintir.RowFields(typ.Fields)
+	payload := make([]Expr, len(variant.fields))
+	for i, name := range variant.fields {
+		for _, field := range fields {
+			if field.FieldName == name && value[name] != nil {
+				payload[i] = r.valueExpr(value[name], field.FieldType)
+			}
+		}
+		if payload[i] == nil {
+			t.errorf(nil, "the %s in the trace has no field %s", record.name, name)
+			return newTodo()
+		}
+	}
+
+	return variantCons(record, variant, payload)
+}
+
+func (r *replayer) valueExprs(values []itf.Value, typ quintir.Type) []Expr {
+	exprs := make([]Expr, len(values))
+	for i, value := range values {
+		exprs[i] = r.valueExpr(value, typ)
+	}
+	return exprs
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
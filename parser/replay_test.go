@@ -0,0 +1,204 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"piwasm/itf"
+	"piwasm/quintir"
+)
+
+// trace is a trace of the example contract, written by `quint run --mbt`, in which alice sends 3 untrn that
+// arrive with the reply
+const trace = `{"vars":["storage","transferSenders","mbt::actionTaken","mbt::nondetPicks"],
+"states":[
+{"#meta":{"index":0},"storage":{"contractVersion":{"contract":"ibc_transfer","version":"0.1.0"},"replyQueue":{"#map":[]},"runningId":{"#bigint":"0"},"successfulTransfers":{"#set":[]}},"transferSenders":{"#set":[]},"mbt::actionTaken":"init","mbt::nondetPicks":{}},
+{"#meta":{"index":1},"storage":{"contractVersion":{"contract":"ibc_transfer","version":"0.1.0"},"replyQueue":{"#map":[[{"#bigint":"1"},"alice"]]},"runningId":{"#bigint":"1"},"successfulTransfers":{"#set":[]}},"transferSenders":{"#set":["alice"]},"mbt::actionTaken":"send","mbt::nondetPicks":{"sender":{"tag":"Some","value":"alice"},"receiver":{"tag":"Some","value":"bob"},"amount":{"tag":"Some","value":{"#bigint":"3"}},"denom":{"tag":"Some","value":"untrn"},"channel":{"tag":"Some","value":"channel-0"},"timeout_height":{"tag":"Some","value":{"#bigint":"0"}}}},
+{"#meta":{"index":2},"storage":{"contractVersion":{"contract":"ibc_transfer","version":"0.1.0"},"replyQueue":{"#map":[]},"runningId":{"#bigint":"1"},"successfulTransfers":{"#set":["alice"]}},"transferSenders":{"#set":["alice"]},"mbt::actionTaken":"reply_action","mbt::nondetPicks":{"id":{"tag":"Some","value":{"#bigint":"1"}}}}
+]}`
+
+// replayTest translates the test module of the example contract and the replay of the trace, changed by edit,
+// and returns the code of the replay together with the problems found in the trace
+func replayTest(t *testing.T, edit func(*itf.Trace)) (string, Diagnostics) {
+	t.Helper()
+	parsed, err := itf.Parse([]byte(trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit(parsed)
+	ir := loadModel(t)
+	tr := newTranslator(ir)
+	program := tr.generateReplay(ir.Module("ibc_transfer_test"), "super::ibc_transfer", []namedTrace{{name: "replay_t0", trace: parsed}})
+
+	var traceProblems Diagnostics
+	for _, d := range tr.diagnostics {
+		if d.Module == "replay_t0" {
+			traceProblems = append(traceProblems, d)
+		}
+	}
+	code, _ := (&Program{Decls: program.Decls[len(program.Decls)-1:]}).Render()
+	return code, traceProblems
+}
+
+func TestReplayTrace(t *testing.T) {
+	code, problems := replayTest(t, func(*itf.Trace) {})
+	if len(problems) > 0 {
+		t.Fatalf("got the problems %v", problems)
+	}
+	for _, want := range []string{
+		"#[test]\npub fn replay_t0() {\n    let storage: ContractStorage = ContractStorage {",
+		`replyQueue: HashMap::<u64, String>::new(),`,
+		`let storage = send_deterministic(storage, "alice".to_string(), "bob".to_string(), 3_u64, "untrn".to_string(), "channel-0".to_string(), 0_u64);`,
+		`replyQueue: HashMap::from(vec!((1_u64, "alice".to_string()))),`,
+		`}, "step 1: send");`,
+		"let storage = reply_deterministic(storage, 1_u64);",
+		`successfulTransfers: im::hashset!("alice".to_string()),`,
+		`}, "step 2: reply_action");`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("the replay does not contain\n%s\ngot\n%s", want, code)
+		}
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*itf.Trace)
+		err  string
+	}{
+		{
+			name: "no action",
+			edit: func(trace *itf.Trace) { delete(trace.States[1], itf.ActionTaken) },
+			err:  "state 1 does not say which action was taken, write the trace with `quint run --mbt`",
+		},
+		{
+			name: "unknown action",
+			edit: func(trace *itf.Trace) { trace.States[1][itf.ActionTaken] = itf.Str("withdraw") },
+			err:  "state 1: the action withdraw cannot be replayed",
+		},
+		{
+			name: "missing pick",
+			edit: func(trace *itf.Trace) { delete(trace.States[2][itf.NondetPicks].(itf.Record), "id") },
+			err:  "state 2: the trace has no value for id picked by reply_action",
+		},
+		{
+			name: "missing storage",
+			edit: func(trace *itf.Trace) { delete(trace.States[2], "storage") },
+			err:  "state 2 has no storage",
+		},
+		{
+			name: "value of another type",
+			edit: func(trace *itf.Trace) {
+				trace.States[0]["storage"].(itf.Record)["runningId"] = itf.Str("0")
+			},
+			err: `cannot translate the str 0 in the trace to a int`,
+		},
+		{
+			name: "missing field",
+			edit: func(trace *itf.Trace) { delete(trace.States[0]["storage"].(itf.Record), "runningId") },
+			err:  "the ContractStorage in the trace has no field runningId",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, problems := replayTest(t, test.edit)
+			if len(problems) != 1 || !strings.Contains(problems[0].Message, test.err) {
+				t.Errorf("got the problems %v, want one containing %q", problems, test.err)
+			}
+		})
+	}
+}
+
+func TestValueExpr(t *testing.T) {
+	integer := &quintir.IntType{}
+	tests := []struct {
+		name  string
+		value itf.Value
+		typ   quintir.Type
+		// the --int-default or --arithmetic of the model, if not the defaults
+		intDefault, arithmetic string
+		want                   string
+		// a part of the problem that is reported, if any
+		err string
+	}{
+		{name: "int", value: itf.Int{Value: big.NewInt(7)}, typ: integer, want: "7_u64"},
+		{name: "negative int", value: itf.Int{Value: big.NewInt(-7)}, typ: integer, intDefault: "i64", want: "-7_i64"},
+		{
+			name:       "int beyond 64 bits",
+			value:      itf.Int{Value: new(big.Int).Lsh(big.NewInt(1), 100)},
+			typ:        integer,
+			intDefault: "i128",
+			want:       "1267650600228229401496703205376_i128",
+		},
+		{name: "int of cosmwasm", value: itf.Int{Value: big.NewInt(7)}, typ: integer, arithmetic: "uint256", want: "cosmwasm_std::Uint256::from_u128(7)"},
+		{
+			name:  "negative int of an unsigned width",
+			value: itf.Int{Value: big.NewInt(-7)},
+			typ:   integer,
+			err:   "the integer -7 in the trace does not fit into u64",
+		},
+		{
+			name:  "int too big for the width",
+			value: itf.Int{Value: new(big.Int).Lsh(big.NewInt(1), 64)},
+			typ:   integer,
+			err:   "the integer 18446744073709551616 in the trace does not fit into u64",
+		},
+		{name: "string", value: itf.Str("alice"), typ: &quintir.StrType{}, want: `"alice".to_string()`},
+		{name: "bool", value: itf.Bool(true), typ: &quintir.BoolType{}, want: "true"},
+		{name: "set", value: itf.Set{itf.Bool(false)}, typ: &quintir.SetType{Elem: &quintir.BoolType{}}, want: "im::hashset!(false)"},
+		{name: "list", value: itf.List{itf.Str("a")}, typ: &quintir.ListType{Elem: &quintir.StrType{}}, want: `im::vector!("a".to_string())`},
+		{name: "tuple", value: itf.Tup{itf.Bool(true), itf.Str("a")}, typ: tuple(&quintir.BoolType{}, &quintir.StrType{}), want: `(true, "a".to_string())`},
+		{
+			name:  "map",
+			value: itf.Map{{Key: itf.Int{Value: big.NewInt(1)}, Value: itf.Bool(true)}},
+			typ:   &quintir.FunType{Arg: integer, Res: &quintir.BoolType{}},
+			want:  "HashMap::from(vec!((1_u64, true)))",
+		},
+		{
+			name:  "empty map",
+			value: itf.Map{},
+			typ:   &quintir.FunType{Arg: &quintir.StrType{}, Res: integer},
+			want:  "HashMap::<String, u64>::new()",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tr := newTranslator(&quintir.Output{})
+			if test.intDefault != "" {
+				tr.intDefault = test.intDefault
+			}
+			if test.arithmetic != "" {
+				tr.arithmetic = test.arithmetic
+			}
+			r := &replayer{t: tr, actions: make(map[string]*replayAction)}
+			got, _ := extractMappings(printNode(r.valueExpr(test.value, test.typ), 0))
+			if test.err != "" {
+				if len(tr.diagnostics) != 1 || !strings.Contains(tr.diagnostics[0].Message, test.err) {
+					t.Errorf("got the problems %v, want one containing %q", tr.diagnostics, test.err)
+				}
+				return
+			}
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+			if len(tr.diagnostics) > 0 {
+				t.Errorf("got the problems %v", tr.diagnostics)
+			}
+		})
+	}
+}
+
+func TestTestName(t *testing.T) {
+	tests := map[string]string{
+		"trace_0.itf.json":        "replay_trace_0",
+		"../quint/out-1.itf.json": "replay_out_1",
+		"t.json":                  "replay_t",
+	}
+	for path, want := range tests {
+		if got := testName(path); got != want {
+			t.Errorf("%s: got %s, want %s", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"piwasm/quintir"
+)
+
+// resolveRun translates a `run` definition into a rust test module, like the handwritten tests in
+// rust/src/contract/quint_stdlib.rs. runs are limited to what is meaningful without a state space:
+// `all { ... }` of assertions and boolean expressions, and vals used by them.
+func (t *translator) resolveRun(def *quintir.OpDef) Decl {
+	t.inRun = true
+	body := t.resolveRunBody(def.Expr)
+	t.inRun = false
+	cloneReused(body)
+	test := &FunctionDecl{Name: "test", Body: body, Attrs: []string{"test"}}
+	return &ModDecl{
+		Name:    def.Name,
+		Attrs:   []string{"cfg(test)"},
+		Imports: []Import{{Path: "super::*"}},
+		Decls:   []Decl{test},
+	}
+}
+
+// resolveRunBody translates the body of a run into statements that panic if the run fails
+func (t *translator) resolveRunBody(expr quintir.Expr) []Stmt {
+	switch e := expr.(type) {
+	case *quintir.Let:
+		// as for let expressions, the body is resolved first, since it determines the type of the val
+		names := t.destructure(e)
+		body := t.resolveRunBody(e.Expr)
+		if let := t.resolveLetStmt(e, names); let != nil {
+			return append([]Stmt{let}, body...)
+		}
+		return body
+
+	case *quintir.App:
+		switch e.Opcode {
+		case "actionAll":
+			// all { a, b } runs a and b one after the other, and fails if any of them fails
+			var stmts []Stmt
+			for _, arg := range e.Args {
+				stmts = append(stmts, t.resolveRunBody(arg)...)
+			}
+			return stmts
+
+		case "assert":
+			return []Stmt{t.resolveAssert(e, e.Args[0])}
+
+		case "assign", "actionAny", "then", "reps", "fail", "expect":
+			t.errorf(e, "%s is not supported in runs, only assertions are", e.Opcode)
+			return nil
+		}
+	}
+
+	// a boolean expression makes the run fail if it is false, like an assertion
+	return []Stmt{t.resolveAssert(expr, expr)}
+}
+
+// resolveLetStmt translates the val of a let into a statement, for lets whose body is a sequence of statements.
+// the body must be resolved before, since the uses of the val in the body determine its type, and names are
+// the variables the val is destructured into, from destructure before the body.
+// it returns nil after reporting a problem.
+func (t *translator) resolveLetStmt(e *quintir.Let, names []string) Stmt {
+	var let *LetStmt
+	switch opdef := t.resolveDef(e.Opdef).(type) {
+	case *ValDecl:
+		let = &LetStmt{VariableName: opdef.Name, Names: names, Value: opdef.Value}
+	case *ConstDecl:
+		let = &LetStmt{VariableName: opdef.Name, Names: names, Type: opdef.Type, Value: opdef.Value}
+	case nil:
+		// resolveDef already reported the problem
+		return nil
+	default:
+		t.errorf(e.Opdef, "%s definitions are not supported here", e.Opdef.Qualifier)
+		return nil
+	}
+	t.setOrigin(let, e.Opdef)
+	return let
+}
+
+// resolveAssert translates the assertion that cond holds. comparisons become assert_eq!,
+// so that a failing test shows both sides.
+func (t *translator) resolveAssert(assert quintir.Expr, cond quintir.Expr) Stmt {
+	var check *Macro
+	if eq, ok := cond.(*quintir.App); ok && eq.Opcode == "eq" && !t.isTagComparison(eq) {
+		// the sides have the same type, so the type of one side tells what the records of the other are
+		left := t.resolveExpr(eq.Args[0], t.typeOf(eq.Args[1]))
+		right := t.resolveExpr(eq.Args[1], t.typeOf(eq.Args[0]))
+		check = &Macro{Name: "assert_eq", Args: []Expr{left, right}}
+	} else {
+		check = &Macro{Name: "assert", Args: []Expr{t.resolveExpr(cond, &BoolType{})}}
+	}
+	t.setOrigin(check, assert)
+	return &ExprStmt{Value: check}
+}
+
+// isTagComparison checks if eq compares the tag of a tagged record, which has no tag to show in rust
+func (t *translator) isTagComparison(eq *quintir.App) bool {
+	_, _, _, ok := t.tagComparison(eq)
+	return ok
+}
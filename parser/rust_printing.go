@@ -5,10 +5,19 @@ import (
 	"strings"
 )
 
+// printNode prints a child node. nodes with an origin are wrapped in markers,
+// which Program.Render removes again to compute the source map.
+func printNode(node AST, level int) string {
+	if n, ok := node.(interface{ origin() *Origin }); ok && n.origin().QuintID != 0 {
+		return openMarker(*n.origin()) + node.PrettyPrint(level) + closeMarker
+	}
+	return node.PrettyPrint(level)
+}
+
 func (t *TypeCons) PrettyPrint(level int) string {
 	types := make([]string, len(t.Params))
 	for i, typ := range t.Params {
-		types[i] = typ.PrettyPrint(level)
+		types[i] = printNode(typ, level)
 	}
 	return fmt.Sprintf("%s<%s>", t.Name, strings.Join(types, ", "))
 }
@@ -29,6 +38,22 @@ func (t *StructType) PrettyPrint(level int) string {
 	return sb.String()
 }
 
+func (t *FnType) PrettyPrint(level int) string {
+	params := make([]string, len(t.Params))
+	for i, param := range t.Params {
+		params[i] = printNode(param, 0)
+	}
+	return fmt.Sprintf("impl Fn(%s) -> %s", strings.Join(params, ", "), printNode(t.Result, 0))
+}
+
+func (t *SignedType) PrettyPrint(level int) string {
+	return t.Name
+}
+
+func (t *BigUintType) PrettyPrint(level int) string {
+	return "cosmwasm_std::" + t.Name
+}
+
 func (t *UInt64Type) PrettyPrint(level int) string {
 	return "u64"
 }
@@ -38,15 +63,15 @@ func (t *BoolType) PrettyPrint(level int) string {
 }
 
 func (t *SetType) PrettyPrint(level int) string {
-	return "HashSet::<" + t.ElementType.PrettyPrint(level) + ">"
+	return "HashSet::<" + printNode(t.ElementType, level) + ">"
 }
 
 func (t *MapType) PrettyPrint(level int) string {
 	sb := strings.Builder{}
 	sb.WriteString("HashMap::<")
-	sb.WriteString(t.Key.PrettyPrint(level))
+	sb.WriteString(printNode(t.Key, level))
 	sb.WriteString(", ")
-	sb.WriteString(t.Value.PrettyPrint(level))
+	sb.WriteString(printNode(t.Value, level))
 	sb.WriteString(">")
 	return sb.String()
 }
@@ -54,7 +79,7 @@ func (t *MapType) PrettyPrint(level int) string {
 func (t *TupleType) PrettyPrint(level int) string {
 	types := make([]string, len(t.Types))
 	for i, typ := range t.Types {
-		types[i] = typ.PrettyPrint(level)
+		types[i] = printNode(typ, level)
 	}
 	return fmt.Sprintf("(%s)", strings.Join(types, ", "))
 }
@@ -64,7 +89,22 @@ func (t *StrType) PrettyPrint(level int) string {
 }
 
 func (t *ListType) PrettyPrint(level int) string {
-	return "[" + t.ElementType.PrettyPrint(level) + "]"
+	return "Vector::<" + printNode(t.ElementType, level) + ">"
+}
+
+func (t *TypeVar) PrettyPrint(level int) string {
+	return t.Name
+}
+
+func (p *TypeParam) PrettyPrint(level int) string {
+	if len(p.Bounds) == 0 {
+		return p.Name
+	}
+	return p.Name + ": " + strings.Join(p.Bounds, " + ")
+}
+
+func (t *OptionType) PrettyPrint(level int) string {
+	return "Option<" + printNode(t.ValueType, level) + ">"
 }
 
 func (t *ConstType) PrettyPrint(level int) string {
@@ -76,27 +116,47 @@ func (t *TypeRef) PrettyPrint(level int) string {
 	if t.Mutable {
 		mut = "mut "
 	}
-	return fmt.Sprintf("&%s %s", mut, t.OfType.PrettyPrint(level))
+	return fmt.Sprintf("&%s%s", mut, printNode(t.OfType, level))
 }
 
 func (i Import) PrettyPrint(level int) string {
 	return fmt.Sprintf("use %s;", i.Path)
 }
 
+// PrettyPrint prints the program. use Render to also get the source map.
 func (p *Program) PrettyPrint(level int) string {
+	code, _ := p.Render()
+	return code
+}
+
+// Render prints the program and returns where the nodes that came from the quint model ended up in the output
+func (p *Program) Render() (string, []Mapping) {
 	var sb strings.Builder
 
+	for _, attr := range p.InnerAttrs {
+		sb.WriteString("#![")
+		sb.WriteString(attr)
+		sb.WriteString("]\n")
+	}
+	if len(p.InnerAttrs) > 0 {
+		sb.WriteString("\n")
+	}
 	for _, imp := range p.Imports {
-		sb.WriteString(imp.PrettyPrint(level))
+		sb.WriteString(imp.PrettyPrint(0))
 		sb.WriteString("\n")
 	}
 	sb.WriteString("\n")
 	for _, decl := range p.Decls {
-		sb.WriteString(decl.PrettyPrint(level))
+		if n, ok := decl.(interface{ origin() *Origin }); ok && p.QuintComments && n.origin().QuintID != 0 {
+			sb.WriteString("// quint: ")
+			sb.WriteString(n.origin().Describe())
+			sb.WriteString("\n")
+		}
+		sb.WriteString(printNode(decl, 0))
 		sb.WriteString("\n\n")
 	}
 
-	return sb.String()
+	return extractMappings(sb.String())
 }
 
 func (s *StructDecl) PrettyPrint(level int) string {
@@ -123,20 +183,79 @@ func (s *StructDecl) PrettyPrint(level int) string {
 }
 
 func (f *Field) PrettyPrint(level int) string {
-	return fmt.Sprintf("pub %s: %s", f.Name, f.Type.PrettyPrint(level))
+	return fmt.Sprintf("pub %s: %s", f.Name, printNode(f.Type, level))
 }
 
 func (t *TypeDecl) PrettyPrint(level int) string {
 	var sb strings.Builder
 
-	sb.WriteString("type ")
+	sb.WriteString("pub type ")
 	sb.WriteString(t.Name)
 	sb.WriteString(" = ")
-	sb.WriteString(t.Type.PrettyPrint(level))
+	sb.WriteString(printNode(t.Type, level))
 	sb.WriteString(";")
 	return sb.String()
 }
 
+func (e *EnumDecl) PrettyPrint(level int) string {
+	var sb strings.Builder
+
+	for _, attr := range e.Attrs {
+		sb.WriteString("#[")
+		sb.WriteString(attr)
+		sb.WriteString("]\n")
+	}
+	sb.WriteString("pub enum ")
+	sb.WriteString(e.Name)
+	sb.WriteString(" {\n")
+
+	for _, variant := range e.Variants {
+		sb.WriteString("    ")
+		sb.WriteString(variant.PrettyPrint(level))
+		sb.WriteString(",\n")
+	}
+
+	sb.WriteString("}")
+
+	return sb.String()
+}
+
+func (v *Variant) PrettyPrint(level int) string {
+	if len(v.Fields) > 0 {
+		// fields of enum variants are public anyway, so they have no pub
+		fields := make([]string, len(v.Fields))
+		for i, field := range v.Fields {
+			fields[i] = fmt.Sprintf("%s: %s", field.Name, printNode(field.Type, level))
+		}
+		return fmt.Sprintf("%s { %s }", v.Name, strings.Join(fields, ", "))
+	}
+	if len(v.Types) == 0 {
+		if v.Empty {
+			return v.Name + " {}"
+		}
+		if v.Default {
+			return "#[default] " + v.Name
+		}
+		return v.Name
+	}
+	types := make([]string, len(v.Types))
+	for i, typ := range v.Types {
+		types[i] = printNode(typ, level)
+	}
+	return fmt.Sprintf("%s(%s)", v.Name, strings.Join(types, ", "))
+}
+
+func (v *Verbatim) PrettyPrint(level int) string {
+	indent := strings.Repeat("    ", level)
+	lines := strings.Split(strings.TrimSpace(v.Code), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (f *FunctionDecl) PrettyPrint(level int) string {
 	var sb strings.Builder
 
@@ -148,6 +267,15 @@ func (f *FunctionDecl) PrettyPrint(level int) string {
 
 	sb.WriteString("pub fn ")
 	sb.WriteString(f.Name)
+	if len(f.TypeParams) > 0 {
+		typeParams := make([]string, len(f.TypeParams))
+		for i, param := range f.TypeParams {
+			typeParams[i] = param.PrettyPrint(level)
+		}
+		sb.WriteString("<")
+		sb.WriteString(strings.Join(typeParams, ", "))
+		sb.WriteString(">")
+	}
 	sb.WriteString("(")
 
 	params := make([]string, len(f.Params))
@@ -156,13 +284,16 @@ func (f *FunctionDecl) PrettyPrint(level int) string {
 	}
 	sb.WriteString(strings.Join(params, ", "))
 
-	sb.WriteString(") -> ")
-	sb.WriteString(f.ReturnType.PrettyPrint(level))
+	sb.WriteString(")")
+	if f.ReturnType != nil {
+		sb.WriteString(" -> ")
+		sb.WriteString(printNode(f.ReturnType, level))
+	}
 	sb.WriteString(" {\n")
 
 	for _, stmt := range f.Body {
 		if f.Body != nil {
-			sb.WriteString(stmt.PrettyPrint(level + 1))
+			sb.WriteString(printNode(stmt, level+1))
 			sb.WriteString("\n")
 		}
 	}
@@ -172,12 +303,47 @@ func (f *FunctionDecl) PrettyPrint(level int) string {
 	return sb.String()
 }
 
+func (m *ModDecl) PrettyPrint(level int) string {
+	var sb strings.Builder
+
+	for _, attr := range m.Attrs {
+		sb.WriteString("#[")
+		sb.WriteString(attr)
+		sb.WriteString("]\n")
+	}
+	sb.WriteString("mod ")
+	sb.WriteString(m.Name)
+	sb.WriteString(" {\n")
+
+	// the contents are printed like a file and then indented
+	var inner strings.Builder
+	for _, imp := range m.Imports {
+		inner.WriteString(imp.PrettyPrint(0))
+		inner.WriteString("\n")
+	}
+	for _, decl := range m.Decls {
+		inner.WriteString("\n")
+		inner.WriteString(printNode(decl, 0))
+		inner.WriteString("\n")
+	}
+	for _, line := range strings.SplitAfter(inner.String(), "\n") {
+		if strings.TrimSpace(line) != "" {
+			sb.WriteString("    ")
+		}
+		sb.WriteString(line)
+	}
+
+	sb.WriteString("}")
+
+	return sb.String()
+}
+
 func (f *ConstDecl) PrettyPrint(level int) string {
-	return fmt.Sprintf("pub const %s: %s = %s;", f.Name, f.Type.PrettyPrint(level), f.Value.PrettyPrint(level))
+	return fmt.Sprintf("pub const %s: %s = %s;", f.Name, printNode(f.Type, level), printNode(f.Value, level))
 }
 
 func (f *ValDecl) PrettyPrint(level int) string {
-	return fmt.Sprintf("val %s = %s;", f.Name, f.Value.PrettyPrint(level))
+	return fmt.Sprintf("val %s = %s;", f.Name, printNode(f.Value, level))
 }
 
 func (p *Param) PrettyPrint(level int) string {
@@ -185,22 +351,44 @@ func (p *Param) PrettyPrint(level int) string {
 	if p.Mutable {
 		mut = "mut "
 	}
-	return fmt.Sprintf("%s%s: %s", mut, p.Name, p.Type.PrettyPrint(level))
+	return fmt.Sprintf("%s%s: %s", mut, p.Name, printNode(p.Type, level))
 }
 
 func (l *Let) PrettyPrint(level int) string {
 	indent := strings.Repeat("    ", level)
-	return fmt.Sprintf("%slet %s = %s;\n%s", indent, l.VariableName, l.Value.PrettyPrint(0), l.Body.PrettyPrint(level))
+	return fmt.Sprintf("%slet %s = %s;\n%s", indent, letPattern(l.VariableName, l.Names), printNode(l.Value, 0), printNode(l.Body, level))
+}
+
+// letPattern returns what a let binds: the variable, or the tuple of the variables the value is destructured into
+func letPattern(variable string, names []string) string {
+	if len(names) > 0 {
+		return fmt.Sprintf("(%s)", strings.Join(names, ", "))
+	}
+	return variable
 }
 
 func (a *Assign) PrettyPrint(level int) string {
 	indent := strings.Repeat("    ", level)
-	return fmt.Sprintf("%s%s = %s", indent, a.Dest.PrettyPrint(0), a.Value.PrettyPrint(0))
+	return fmt.Sprintf("%s%s = %s", indent, printNode(a.Dest, 0), printNode(a.Value, 0))
+}
+
+func (l *LetStmt) PrettyPrint(level int) string {
+	indent := strings.Repeat("    ", level)
+	typ := ""
+	if l.Type != nil {
+		typ = ": " + printNode(l.Type, 0)
+	}
+	return fmt.Sprintf("%slet %s%s = %s;", indent, letPattern(l.VariableName, l.Names), typ, printNode(l.Value, level))
+}
+
+func (e *ExprStmt) PrettyPrint(level int) string {
+	indent := strings.Repeat("    ", level)
+	return fmt.Sprintf("%s%s;", indent, printNode(e.Value, level))
 }
 
 func (r *Return) PrettyPrint(level int) string {
 	indent := strings.Repeat("    ", level)
-	return fmt.Sprintf("%s%s", indent, r.Value.PrettyPrint(level))
+	return fmt.Sprintf("%s%s", indent, printNode(r.Value, level))
 }
 
 func (b *Block) PrettyPrint(level int) string {
@@ -211,7 +399,7 @@ func (b *Block) PrettyPrint(level int) string {
 	sb.WriteString(indent)
 	sb.WriteString("{\n")
 	for i, stmt := range b.Statements {
-		sb.WriteString(stmt.PrettyPrint(level + 1))
+		sb.WriteString(printNode(stmt, level+1))
 		if i < len(b.Statements)-1 {
 			sb.WriteString(";")
 		}
@@ -225,7 +413,7 @@ func (b *Block) PrettyPrint(level int) string {
 
 func (f *FieldValue) PrettyPrint(level int) string {
 	indent := strings.Repeat("    ", level)
-	return fmt.Sprintf("%s%s: %s", indent, f.Name, f.Value.PrettyPrint(level))
+	return fmt.Sprintf("%s%s: %s", indent, f.Name, printNode(f.Value, level))
 }
 
 func (s *StructCons) PrettyPrint(level int) string {
@@ -257,7 +445,7 @@ func (e *EnumCons) PrettyPrint(level int) string {
 
 	params := make([]string, len(e.Params))
 	for i, param := range e.Params {
-		params[i] = param.PrettyPrint(0)
+		params[i] = printNode(param, 0)
 	}
 	sb.WriteString(strings.Join(params, ", "))
 
@@ -267,13 +455,13 @@ func (e *EnumCons) PrettyPrint(level int) string {
 }
 
 func (b *Borrow) PrettyPrint(level int) string {
-	return fmt.Sprintf("&%s", b.Value.PrettyPrint(0))
+	return fmt.Sprintf("&%s", printNode(b.Value, 0))
 }
 
 func (t *Tuple) PrettyPrint(level int) string {
 	values := make([]string, len(t.Values))
 	for i, value := range t.Values {
-		values[i] = value.PrettyPrint(0)
+		values[i] = printNode(value, 0)
 	}
 	return fmt.Sprintf("(%s)", strings.Join(values, ", "))
 }
@@ -285,7 +473,7 @@ func typeArgs(types []Type) string {
 
 	args := make([]string, len(types))
 	for i, typ := range types {
-		args[i] = typ.PrettyPrint(0)
+		args[i] = printNode(typ, 0)
 	}
 	return fmt.Sprintf("::<%s>", strings.Join(args, ", "))
 }
@@ -293,7 +481,7 @@ func typeArgs(types []Type) string {
 func (f *FunctionCall) PrettyPrint(level int) string {
 	args := make([]string, len(f.Arguments))
 	for i, arg := range f.Arguments {
-		args[i] = arg.PrettyPrint(0)
+		args[i] = printNode(arg, 0)
 	}
 	return fmt.Sprintf("%s%s(%s)", f.FunctionName, typeArgs(f.TypeArgs), strings.Join(args, ", "))
 }
@@ -301,17 +489,17 @@ func (f *FunctionCall) PrettyPrint(level int) string {
 func (s *StaticMethodCall) PrettyPrint(level int) string {
 	args := make([]string, len(s.Arguments))
 	for i, arg := range s.Arguments {
-		args[i] = arg.PrettyPrint(0)
+		args[i] = printNode(arg, 0)
 	}
-	return fmt.Sprintf("%s::%s%s(%s)", s.TypeName.PrettyPrint(level), s.MethodName, typeArgs(s.TypeArgs), strings.Join(args, ", "))
+	return fmt.Sprintf("%s::%s%s(%s)", printNode(s.TypeName, level), s.MethodName, typeArgs(s.TypeArgs), strings.Join(args, ", "))
 }
 
 func (m *MethodCall) PrettyPrint(level int) string {
 	args := make([]string, len(m.Arguments))
 	for i, arg := range m.Arguments {
-		args[i] = arg.PrettyPrint(0)
+		args[i] = printNode(arg, 0)
 	}
-	return fmt.Sprintf("%s.%s%s(%s)", m.Value.PrettyPrint(level), m.MethodName, typeArgs(m.TypeArgs), strings.Join(args, ", "))
+	return fmt.Sprintf("%s.%s%s(%s)", printOperand(m.Value, precPostfix), m.MethodName, typeArgs(m.TypeArgs), strings.Join(args, ", "))
 }
 
 func (v *Variable) PrettyPrint(level int) string {
@@ -319,7 +507,7 @@ func (v *Variable) PrettyPrint(level int) string {
 }
 
 func (f *FieldAccess) PrettyPrint(level int) string {
-	return fmt.Sprintf("%s.%s", f.Value.PrettyPrint(0), f.Field)
+	return fmt.Sprintf("%s.%s", printOperand(f.Value, precPostfix), f.Field)
 }
 
 func (i *IfElse) PrettyPrint(level int) string {
@@ -329,30 +517,163 @@ func (i *IfElse) PrettyPrint(level int) string {
 
 	sb.WriteString(indent)
 	sb.WriteString("if ")
-	sb.WriteString(i.Condition.PrettyPrint(0))
+	sb.WriteString(printNode(i.Condition, 0))
 	sb.WriteString(" {\n")
-	sb.WriteString(i.Then.PrettyPrint(level + 1))
+	sb.WriteString(printNode(i.Then, level+1))
 	sb.WriteString(indent)
 	sb.WriteString("\n} else {\n")
-	sb.WriteString(i.Else.PrettyPrint(level + 1))
+	sb.WriteString(printNode(i.Else, level+1))
 	sb.WriteString(indent)
 	sb.WriteString("\n}")
 
 	return sb.String()
 }
 
-func (n *Not) PrettyPrint(level int) string {
-	return fmt.Sprintf("!%s", n.Value.PrettyPrint(0))
+func (m *Match) PrettyPrint(level int) string {
+	var sb strings.Builder
+
+	indent := strings.Repeat("    ", level)
+
+	sb.WriteString("match ")
+	sb.WriteString(printNode(m.Value, 0))
+	sb.WriteString(" {\n")
+	for _, arm := range m.Arms {
+		sb.WriteString(indent)
+		sb.WriteString("    ")
+		sb.WriteString(printNode(arm.Pattern, 0))
+		sb.WriteString(" => ")
+		sb.WriteString(printNode(arm.Body, level+1))
+		sb.WriteString(",\n")
+	}
+	sb.WriteString(indent)
+	sb.WriteString("}")
+
+	return sb.String()
+}
+
+func (p *VariantPattern) PrettyPrint(level int) string {
+	path := p.EnumName + "::" + p.Variant
+	var parts []string
+	if p.Struct {
+		for i, field := range p.Fields {
+			parts = append(parts, fmt.Sprintf("%s: %s", field, p.Bindings[i]))
+		}
+	} else {
+		parts = append(parts, p.Bindings...)
+	}
+	if p.Rest {
+		parts = append(parts, "..")
+	}
+	switch {
+	case p.Struct && len(parts) == 0:
+		return path + " {}"
+	case p.Struct:
+		return fmt.Sprintf("%s { %s }", path, strings.Join(parts, ", "))
+	case len(parts) == 0:
+		return path
+	}
+	return fmt.Sprintf("%s(%s)", path, strings.Join(parts, ", "))
+}
+
+func (t *Try) PrettyPrint(level int) string {
+	return fmt.Sprintf("%s?", printOperand(t.Value, precPostfix))
+}
+
+// the precedence of the rust operators, higher binds tighter
+const (
+	precLowest     = iota // if, match, blocks and closures
+	precRange             // .. ..=
+	precOr                // ||
+	precAnd               // &&
+	precComparison        // == != < > <= >=, which do not chain
+	precSum               // + -
+	precProduct           // * / %
+	precPrefix            // ! -
+	precPostfix           // method calls, field accesses and ?
+	precAtom              // literals, variables, calls and macros
+)
+
+var binaryPrecedence = map[string]int{
+	"..": precRange, "..=": precRange,
+	"||": precOr,
+	"&&": precAnd,
+	"==": precComparison, "!=": precComparison, "<": precComparison, ">": precComparison, "<=": precComparison, ">=": precComparison,
+	"+": precSum, "-": precSum,
+	"*": precProduct, "/": precProduct, "%": precProduct,
+}
+
+// precedence returns how tightly expr binds when it is the operand of an operator
+func precedence(expr AST) int {
+	switch e := expr.(type) {
+	case *BinaryOp:
+		return binaryPrecedence[e.Op]
+	case *UnaryOp:
+		return precPrefix
+	case *MethodCall, *FieldAccess, *Try:
+		return precPostfix
+	case *IfElse, *Match, *Block, *Let, *Closure:
+		return precLowest
+	}
+	return precAtom
+}
+
+// printOperand prints expr, in parentheses if it binds less tightly than prec
+func printOperand(expr Expr, prec int) string {
+	if precedence(expr) < prec {
+		return "(" + printNode(expr, 0) + ")"
+	}
+	return printNode(expr, 0)
+}
+
+func (c *Closure) PrettyPrint(level int) string {
+	move := ""
+	if c.Move {
+		move = "move "
+	}
+	body := printNode(c.Body, 0)
+	if _, isLet := c.Body.(*Let); isLet {
+		// let expressions are printed as statements, which need a block
+		indent := strings.Repeat("    ", level)
+		body = "{\n" + printNode(c.Body, level+1) + "\n" + indent + "}"
+	}
+	return fmt.Sprintf("%s|%s| %s", move, strings.Join(c.Params, ", "), body)
+}
+
+func (u *UnaryOp) PrettyPrint(level int) string {
+	return u.Op + printOperand(u.Value, precPrefix)
 }
 
-func (a *Add) PrettyPrint(level int) string {
-	return fmt.Sprintf("%s + %s", a.Left.PrettyPrint(0), a.Right.PrettyPrint(0))
+func (b *BinaryOp) PrettyPrint(level int) string {
+	prec := binaryPrecedence[b.Op]
+	// the operators are left associative, so an operand on the right with the same precedence needs parentheses,
+	// and comparisons do not chain at all
+	left := prec
+	if prec == precComparison {
+		left = prec + 1
+	}
+	return fmt.Sprintf("%s %s %s", printOperand(b.Left, left), b.Op, printOperand(b.Right, prec+1))
 }
 
 func (u *UInt64Literal) PrettyPrint(level int) string {
 	return fmt.Sprintf("%d_u64", u.Value)
 }
 
+func (s *SignedLiteral) PrettyPrint(level int) string {
+	return fmt.Sprintf("%s_%s", s.Value, s.TypeName)
+}
+
+func (u *BigUintLiteral) PrettyPrint(level int) string {
+	if u.TypeName == "Uint256" {
+		// Uint256 has no constructor for its full range, but u128 covers the literals of models
+		return fmt.Sprintf("cosmwasm_std::Uint256::from_u128(%s)", u.Value)
+	}
+	return fmt.Sprintf("cosmwasm_std::%s::new(%s)", u.TypeName, u.Value)
+}
+
+func (u *UntypedLiteral) PrettyPrint(level int) string {
+	return u.Value
+}
+
 func (s *StringLiteral) PrettyPrint(level int) string {
 	str := fmt.Sprintf("\"%s\"", strings.ReplaceAll(s.Value, "\"", "\\\""))
 	return str + ".to_string()"
@@ -366,10 +687,9 @@ func (b *BoolLiteral) PrettyPrint(level int) string {
 }
 
 func (m *Macro) PrettyPrint(level int) string {
-	indent := strings.Repeat("    ", level)
 	args := make([]string, len(m.Args))
 	for i, arg := range m.Args {
-		args[i] = arg.PrettyPrint(0)
+		args[i] = printNode(arg, 0)
 	}
-	return fmt.Sprintf("%s%s!(%s)", m.Name, indent, strings.Join(args, ", "))
+	return fmt.Sprintf("%s!(%s)", m.Name, strings.Join(args, ", "))
 }
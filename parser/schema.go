@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Schema is a JSON Schema, in the draft 07 format that cosmwasm tooling expects
+type Schema map[string]interface{}
+
+const schemaVersion = "http://json-schema.org/draft-07/schema#"
+
+// schemaBuilder builds the schemas of the messages of the contract from the declarations of the rust AST,
+// so that they are always in sync with the model. nested types are put into the definitions and referenced.
+type schemaBuilder struct {
+	t *translator
+	// the struct, type and enum declarations by name
+	decls map[string]Decl
+	// the definitions of the schema that is currently built
+	definitions map[string]Schema
+}
+
+// generateSchemas returns the schema of the message of every entry point of the glue, by file name,
+// e.g. instantiate_msg.json for the InstantiateMsg of the instantiate entry point
+func (t *translator) generateSchemas(lib *Program, declarations []Decl) map[string]Schema {
+	b := &schemaBuilder{t: t, decls: make(map[string]Decl)}
+	for _, decl := range append(declarations, lib.Decls...) {
+		switch d := decl.(type) {
+		case *StructDecl:
+			b.decls[d.Name] = d
+		case *TypeDecl:
+			b.decls[d.Name] = d
+		case *EnumDecl:
+			b.decls[d.Name] = d
+		}
+	}
+
+	schemas := make(map[string]Schema)
+	for _, decl := range lib.Decls {
+		fn, ok := decl.(*FunctionDecl)
+		if !ok || !isEntryPoint(fn) || fn.Name == replyKind.name {
+			// replies come from the chain, not from users, so they need no schema
+			continue
+		}
+		t.context = declContext{module: fn.Origin.Module, name: fn.Origin.Decl, id: fn.Origin.QuintID}
+
+		var msgType Type
+		for _, param := range fn.Params {
+			if param.Name == "msg" {
+				msgType = param.Type
+			}
+		}
+		name, ok := msgType.(*ConstType)
+		if !ok {
+			t.errorf(nil, "the message of the %s entry point must be a named type to have a schema", fn.Name)
+			continue
+		}
+
+		b.definitions = make(map[string]Schema)
+		schema := b.declSchema(name.Name)
+		if schema == nil {
+			continue
+		}
+		schema["$schema"] = schemaVersion
+		schema["title"] = name.Name
+		if len(b.definitions) > 0 {
+			schema["definitions"] = b.definitions
+		}
+		schemas[fn.Name+"_msg.json"] = schema
+	}
+	return schemas
+}
+
+func isEntryPoint(fn *FunctionDecl) bool {
+	for _, attr := range fn.Attrs {
+		if attr == "entry_point" {
+			return true
+		}
+	}
+	return false
+}
+
+// declSchema returns the schema of the declaration with the given name, or nil after reporting that there is none
+func (b *schemaBuilder) declSchema(name string) Schema {
+	decl, ok := b.decls[name]
+	if typeDef := b.t.typeDefs[name]; !ok && typeDef != nil && typeDef.Type != nil {
+		// a type of a module that is not translated, like the stdlib ones
+		decl = b.t.resolveTypeDef(typeDef)
+		b.decls[name] = decl
+	}
+	switch d := decl.(type) {
+	case *StructDecl:
+		return b.structSchema(d.Fields)
+	case *TypeDecl:
+		return b.typeSchema(d.Type)
+	case *EnumDecl:
+		return b.enumSchema(d)
+	}
+	b.t.errorf(nil, "no declaration of %s to generate a schema from", name)
+	return nil
+}
+
+// structSchema returns the schema of a struct. the fields are required, except for options, which serde
+// reads as None if they are missing.
+func (b *schemaBuilder) structSchema(fields []Field) Schema {
+	required := make([]string, 0, len(fields))
+	properties := make(map[string]Schema, len(fields))
+	for _, field := range fields {
+		if b.t.asOption(field.Type) == nil {
+			required = append(required, field.Name)
+		}
+		properties[field.Name] = b.typeSchema(field.Type)
+	}
+	sort.Strings(required)
+
+	schema := Schema{"type": "object"}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	if len(fields) > 0 {
+		schema["properties"] = properties
+	}
+	return schema
+}
+
+// enumSchema returns the schema of a message enum or tagged record. serde writes each variant as an object with
+// a single property, the snake_case name of the variant, see the serde attributes of the enums in glue.go and tagged.go.
+func (b *schemaBuilder) enumSchema(enum *EnumDecl) Schema {
+	variants := make([]Schema, 0, len(enum.Variants))
+	for _, variant := range enum.Variants {
+		name := snakeCase(variant.Name)
+		var value Schema
+		switch {
+		case len(variant.Fields) > 0:
+			value = b.structSchema(variant.Fields)
+		case len(variant.Types) == 1:
+			value = b.typeSchema(variant.Types[0])
+		case len(variant.Types) > 1:
+			b.t.errorf(nil, "variant %s of %s has more than one field, which has no schema", variant.Name, enum.Name)
+			continue
+		case variant.Empty:
+			value = Schema{"type": "object"}
+		default:
+			// serde writes variants without fields as just their name
+			variants = append(variants, Schema{"type": "string", "enum": []string{name}})
+			continue
+		}
+		variants = append(variants, Schema{
+			"type":                 "object",
+			"required":             []string{name},
+			"properties":           map[string]Schema{name: value},
+			"additionalProperties": false,
+		})
+	}
+	return Schema{"oneOf": variants}
+}
+
+// typeSchema returns the schema of a type, as it is serialized by serde
+func (b *schemaBuilder) typeSchema(typ Type) Schema {
+	switch tt := typ.(type) {
+	case *StrType, *StringType:
+		return Schema{"type": "string"}
+	case *BoolType:
+		return Schema{"type": "boolean"}
+	case *UInt64Type:
+		return Schema{"type": "integer", "format": "uint64", "minimum": 0.0}
+	case *SignedType:
+		return Schema{"type": "integer", "format": "int" + tt.Name[1:]}
+	case *BigUintType:
+		// cosmwasm writes its big integers as strings of digits
+		return Schema{"type": "string", "pattern": "^[0-9]+$"}
+	case *ListType:
+		return Schema{"type": "array", "items": b.typeSchema(tt.ElementType)}
+	case *SetType:
+		return Schema{"type": "array", "items": b.typeSchema(tt.ElementType), "uniqueItems": true}
+	case *MapType:
+		// serde writes maps as objects, with keys that are not strings turned into strings
+		return Schema{"type": "object", "additionalProperties": b.typeSchema(tt.Value)}
+	case *OptionType:
+		// serde writes None as null
+		return Schema{"anyOf": []Schema{b.typeSchema(tt.ValueType), {"type": "null"}}}
+	case *TupleType:
+		items := make([]Schema, len(tt.Types))
+		for i, elem := range tt.Types {
+			items[i] = b.typeSchema(elem)
+		}
+		return Schema{"type": "array", "items": items, "minItems": len(items), "maxItems": len(items)}
+	case *ConstType:
+		if tt == TodoType || tt == WildcardType {
+			break
+		}
+		if _, ok := b.definitions[tt.Name]; !ok {
+			// add a placeholder first, so that recursive types terminate
+			b.definitions[tt.Name] = Schema{}
+			if schema := b.declSchema(tt.Name); schema != nil {
+				b.definitions[tt.Name] = schema
+			}
+		}
+		return Schema{"$ref": "#/definitions/" + tt.Name}
+	}
+	printed, _ := extractMappings(printNode(typ, 0))
+	b.t.errorf(nil, "no schema for the type %s", printed)
+	return Schema{}
+}
+
+// snakeCase turns a CamelCase name like TransferFunds into transfer_funds, like serde's rename_all = "snake_case"
+func snakeCase(name string) string {
+	var out []byte
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c >= 'A' && c <= 'Z' {
+			if i > 0 {
+				out = append(out, '_')
+			}
+			c += 'a' - 'A'
+		}
+		out = append(out, c)
+	}
+	return string(out)
+}
+
+// writeSchemas writes the schemas into dir, creating it if needed
+func writeSchemas(dir string, schemas map[string]Schema) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for name, schema := range schemas {
+		data, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"piwasm/quintir"
+)
+
+// schemaJSON writes a schema the way writeSchemas does, without the indentation
+func schemaJSON(t *testing.T, schema Schema) string {
+	t.Helper()
+	data, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestGenerateSchemas(t *testing.T) {
+	ir := loadModel(t)
+	tr := newTranslator(ir)
+	lib := tr.generateGlue(ir.Module("ibc_transfer_entrypoints"), "contract::ibc_transfer", nil)
+	schemas := tr.generateSchemas(lib, nil)
+	if len(tr.diagnostics) > 0 {
+		t.Fatalf("got the problems %v", tr.diagnostics)
+	}
+	if len(schemas) != 2 {
+		t.Errorf("got the schemas %v, want the ones of instantiate and execute", schemas)
+	}
+
+	tests := map[string]string{
+		"instantiate_msg.json": `{"$schema":"http://json-schema.org/draft-07/schema#","properties":{"data":{"type":"string"}},` +
+			`"required":["data"],"title":"InstantiateMsg","type":"object"}`,
+		"execute_msg.json": `{"$schema":"http://json-schema.org/draft-07/schema#","definitions":{"ExecuteMsg_Send":{"properties":{` +
+			`"amount":{"format":"uint64","minimum":0,"type":"integer"},"channel":{"type":"string"},"denom":{"type":"string"},` +
+			`"timeout_height":{"format":"uint64","minimum":0,"type":"integer"},"to":{"type":"string"}},` +
+			`"required":["amount","channel","denom","timeout_height","to"],"type":"object"}},` +
+			`"oneOf":[{"additionalProperties":false,"properties":{"send":{"$ref":"#/definitions/ExecuteMsg_Send"}},"required":["send"],"type":"object"}],` +
+			`"title":"ExecuteMsg"}`,
+	}
+	for name, want := range tests {
+		if got := schemaJSON(t, schemas[name]); got != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", name, got, want)
+		}
+	}
+}
+
+func TestTypeSchema(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  Type
+		want string
+	}{
+		{name: "string", typ: &StringType{}, want: `{"type":"string"}`},
+		{name: "bool", typ: &BoolType{}, want: `{"type":"boolean"}`},
+		{name: "list", typ: &ListType{ElementType: &BoolType{}}, want: `{"items":{"type":"boolean"},"type":"array"}`},
+		{name: "set", typ: &SetType{ElementType: &StrType{}}, want: `{"items":{"type":"string"},"type":"array","uniqueItems":true}`},
+		{name: "map", typ: &MapType{Key: &UInt64Type{}, Value: &BoolType{}}, want: `{"additionalProperties":{"type":"boolean"},"type":"object"}`},
+		{
+			name: "tuple",
+			typ:  &TupleType{Types: []Type{&StrType{}, &BoolType{}}},
+			want: `{"items":[{"type":"string"},{"type":"boolean"}],"maxItems":2,"minItems":2,"type":"array"}`,
+		},
+		{name: "named type", typ: &ConstType{Name: "Coin"}, want: `{"$ref":"#/definitions/Coin"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tr := newTranslator(&quintir.Output{})
+			coin := &StructDecl{Name: "Coin", Fields: []Field{{Name: "denom", Type: &StrType{}}}}
+			b := &schemaBuilder{t: tr, decls: map[string]Decl{"Coin": coin}, definitions: make(map[string]Schema)}
+			if got := schemaJSON(t, b.typeSchema(test.typ)); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+			if len(tr.diagnostics) > 0 {
+				t.Errorf("got the problems %v", tr.diagnostics)
+			}
+		})
+	}
+}
+
+func TestEnumSchema(t *testing.T) {
+	enum := &EnumDecl{Name: "QueryMsg", Variants: []Variant{
+		{Name: "TotalSupply", Empty: true},
+		{Name: "Balance", Types: []Type{&StrType{}}},
+	}}
+	b := &schemaBuilder{t: newTranslator(&quintir.Output{}), decls: make(map[string]Decl)}
+	want := `{"oneOf":[` +
+		`{"additionalProperties":false,"properties":{"total_supply":{"type":"object"}},"required":["total_supply"],"type":"object"},` +
+		`{"additionalProperties":false,"properties":{"balance":{"type":"string"}},"required":["balance"],"type":"object"}]}`
+	if got := schemaJSON(t, b.enumSchema(enum)); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestStructSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []Field
+		want   string
+	}{
+		{name: "no fields", want: `{"type":"object"}`},
+		{
+			name:   "required fields",
+			fields: []Field{{Name: "to", Type: &StrType{}}, {Name: "amount", Type: &UInt64Type{}}},
+			want: `{"properties":{"amount":{"format":"uint64","minimum":0,"type":"integer"},"to":{"type":"string"}},` +
+				`"required":["amount","to"],"type":"object"}`,
+		},
+		{
+			name:   "option",
+			fields: []Field{{Name: "to", Type: &StrType{}}, {Name: "memo", Type: &OptionType{ValueType: &StrType{}}}},
+			want: `{"properties":{"memo":{"anyOf":[{"type":"string"},{"type":"null"}]},"to":{"type":"string"}},` +
+				`"required":["to"],"type":"object"}`,
+		},
+		{
+			name:   "only options",
+			fields: []Field{{Name: "memo", Type: &OptionType{ValueType: &StrType{}}}},
+			want:   `{"properties":{"memo":{"anyOf":[{"type":"string"},{"type":"null"}]}},"type":"object"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := &schemaBuilder{t: newTranslator(&quintir.Output{}), decls: make(map[string]Decl), definitions: make(map[string]Schema)}
+			if got := schemaJSON(t, b.structSchema(test.fields)); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"piwasm/quintir"
+)
+
+// most operators on sets and maps are methods of the im collections with a builtin mapping, like
+// `S.exclude(T)` becoming `s.relative_complement(t)`. the ones here need more than a call: membership, which
+// asks the map directly if the set is its keys, the constructions of sets and maps, and the updates of maps
+// that apply an operator.
+
+// resolveCollection translates an operator on sets or maps that has no builtin mapping
+func (t *translator) resolveCollection(e *quintir.App, exprType Type) Expr {
+	args := e.Args
+	want := map[string]int{
+		"in": 2, "contains": 2, "to": 2, "isFinite": 1, "flatten": 1, "setBy": 3, "mapRemoveAll": 2,
+	}[e.Opcode]
+	if e.Opcode != "Map" && len(args) != want {
+		t.errorf(e, "%s expects %d arguments, got %d", e.Opcode, want, len(args))
+		return newTodo()
+	}
+
+	switch e.Opcode {
+	case "in", "contains":
+		// x.in(S) is S.contains(x)
+		set, element := args[0], args[1]
+		if e.Opcode == "in" {
+			set, element = args[1], args[0]
+		}
+		if keys, ok := set.(*quintir.App); ok && keys.Opcode == "keys" && len(keys.Args) == 1 {
+			// m.keys().contains(k) asks the map, instead of collecting its keys into a set
+			return t.resolveBuiltin(&quintir.App{ID: e.ID, Opcode: "has", Args: []quintir.Expr{keys.Args[0], element}}, builtins["quint_stdlib::has"])
+		}
+		return t.resolveBuiltin(&quintir.App{ID: e.ID, Opcode: "contains", Args: []quintir.Expr{set, element}}, builtins["contains"])
+
+	case "to":
+		// the set of the integers from the first up to the second, which is inclusive. the bounds have the
+		// inferred width of the elements.
+		elementType := t.intTypeAt(&quintir.IntType{}, args[0].QuintID())
+		if _, big := elementType.(*BigUintType); big {
+			t.errorf(e, "ranges of %s are not supported, since rust cannot iterate over them", printNode(elementType, 0))
+			return newTodo()
+		}
+		from := t.resolveExpr(args[0], elementType)
+		to := t.resolveExpr(args[1], elementType)
+		return &MethodCall{Value: &BinaryOp{Op: "..=", Left: from, Right: to}, MethodName: "collect", TypeArgs: []Type{&SetType{ElementType: elementType}}}
+
+	case "isFinite":
+		// the sets of rust all have finitely many elements
+		return &BoolLiteral{Value: true}
+
+	case "flatten":
+		// the union of a set of sets
+		return t.collect(e, exprType, &MethodCall{Value: t.iterate(args[0]), MethodName: "flatten"})
+
+	case "Map":
+		// a map from its pairs of keys and values, like Map(k -> v). the pairs are collected, since the type
+		// argument of collect is a type, in which rust fills in the default hasher of the map
+		if mapType, ok := exprType.(*MapType); !ok || !isKnown(mapType.Key) || !isKnown(mapType.Value) {
+			exprType = t.typeOf(e)
+		}
+		var pairType Type
+		collection := &MapType{Key: WildcardType, Value: WildcardType}
+		if mapType, ok := exprType.(*MapType); ok {
+			pairType = &TupleType{Types: []Type{mapType.Key, mapType.Value}}
+			collection = &MapType{Key: orWildcard(mapType.Key), Value: orWildcard(mapType.Value)}
+		}
+		pairs := make([]Expr, len(args))
+		for i, arg := range args {
+			pairs[i] = t.resolveExpr(arg, pairType)
+		}
+		items := &MethodCall{Value: &Macro{Name: "vec", Args: pairs}, MethodName: "into_iter"}
+		return &MethodCall{Value: items, MethodName: "collect", TypeArgs: []Type{collection}}
+
+	case "setBy":
+		// the value of the key is replaced by the operator applied to it
+		closure := t.iteratorClosure(args[2], 1)
+		if closure == nil {
+			return newTodo()
+		}
+		// the map and the key are used twice, so they are bound to variables to be evaluated once
+		m, key := &Variable{VariableName: "__map"}, &Variable{VariableName: "__key"}
+		old := &MethodCall{Value: m, MethodName: "get", Arguments: []Expr{&Borrow{Value: key}}}
+		var value Expr = &MethodCall{Value: &MethodCall{Value: &MethodCall{Value: old, MethodName: "cloned"}, MethodName: "map", Arguments: []Expr{closure}}, MethodName: "unwrap"}
+		if closure.Fallible {
+			closure.Body = closureOk(closure.Body)
+			value = t.propagate(value)
+		}
+		update := &MethodCall{Value: m, MethodName: "update", Arguments: []Expr{key, &Variable{VariableName: "__value"}}}
+		var body Expr = &Let{VariableName: "__value", Value: value, Body: update}
+		body = &Let{VariableName: "__key", Value: t.resolveExpr(args[1], nil), Body: body}
+		body = &Let{VariableName: "__map", Value: t.resolveExpr(args[0], exprType), Body: body}
+		return &Block{Statements: []Stmt{&Return{Value: body}}}
+
+	case "mapRemoveAll":
+		// the keys are removed one after the other
+		removed := &MethodCall{Value: &Variable{VariableName: "map"}, MethodName: "without", Arguments: []Expr{&Variable{VariableName: "key"}}}
+		closure := &Closure{Params: []string{"map", "key"}, Body: removed}
+		keys := &MethodCall{Value: t.resolveExpr(args[1], &SetType{ElementType: WildcardType}), MethodName: "iter"}
+		return &MethodCall{Value: keys, MethodName: "fold", Arguments: []Expr{t.resolveExpr(args[0], exprType), closure}}
+	}
+	t.errorf(e, "app opcode not supported for resolving expr: %s", e.Opcode)
+	return newTodo()
+}
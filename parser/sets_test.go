@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"piwasm/quintir"
+)
+
+// TestSetBy checks that the map and the key of setBy are evaluated once, though the translation uses them twice
+func TestSetBy(t *testing.T) {
+	integer, str := &quintir.IntType{}, &quintir.StrType{}
+	balances := &quintir.FunType{Arg: str, Res: integer}
+	ir := &quintir.Output{}
+	b := newExprBuilder(ir)
+	v := b.param("v", integer)
+	// the map and the key are calls, which should not be repeated
+	accounts := &quintir.OpDef{ID: b.id(nil), Name: "accounts", Qualifier: "pureval"}
+	owner := &quintir.OpDef{ID: b.id(nil), Name: "owner", Qualifier: "pureval"}
+	m, key := b.call(accounts, balances), b.call(owner, str)
+	add := b.lambda([]*quintir.Param{v}, b.app("iadd", integer, b.use(v, integer), b.int(1)))
+	tr := newTranslator(ir)
+	// the indentation is left to rustfmt
+	got := strings.Join(strings.Fields(rust(tr.resolveExpr(b.app("setBy", balances, m, key, add), nil))), " ")
+	if len(tr.diagnostics) > 0 {
+		t.Errorf("got the problems %v", tr.diagnostics)
+	}
+	want := "{ let __map = accounts(); let __key = owner(); " +
+		"let __value = __map.get(&__key).cloned().map(|v| v + 1_u64).unwrap(); __map.update(__key, __value) }"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	for _, part := range []string{"accounts", "owner"} {
+		if n := strings.Count(got, part); n != 1 {
+			t.Errorf("%s is evaluated %d times", part, n)
+		}
+	}
+}
+
+func TestSetOperators(t *testing.T) {
+	integer, str := &quintir.IntType{}, &quintir.StrType{}
+	balances := &quintir.FunType{Arg: str, Res: integer}
+	tests := []struct {
+		name       string
+		intDefault string
+		expr       func(b *exprBuilder) quintir.Expr
+		want       string
+		// a part of the problem that is reported, if any
+		err string
+	}{
+		{
+			name:       "range",
+			intDefault: "u64",
+			expr: func(b *exprBuilder) quintir.Expr {
+				return b.app("to", &quintir.SetType{Elem: integer}, b.int(1), b.name("n", integer))
+			},
+			want: "(1_u64 ..= n).collect::<HashSet::<u64>>()",
+		},
+		{
+			name:       "signed range",
+			intDefault: "i64",
+			expr: func(b *exprBuilder) quintir.Expr {
+				return b.app("to", &quintir.SetType{Elem: integer}, b.int(1), b.name("n", integer))
+			},
+			want: "(1_i64 ..= n).collect::<HashSet::<i64>>()",
+		},
+		{
+			name:       "range of Uint128",
+			intDefault: "Uint128",
+			expr: func(b *exprBuilder) quintir.Expr {
+				return b.app("to", &quintir.SetType{Elem: integer}, b.int(1), b.name("n", integer))
+			},
+			err: "ranges of cosmwasm_std::Uint128 are not supported",
+		},
+		{
+			name:       "map",
+			intDefault: "u64",
+			expr: func(b *exprBuilder) quintir.Expr {
+				pair := b.app("Tup", &quintir.TupType{Fields: row(false, "0", str, "1", integer)}, b.str("alice"), b.int(3))
+				return b.app("Map", balances, pair)
+			},
+			want: "vec!((\"alice\".to_string(), 3_u64)).into_iter().collect::<HashMap::<String, u64>>()",
+		},
+		{
+			name:       "empty map",
+			intDefault: "u64",
+			expr:       func(b *exprBuilder) quintir.Expr { return b.app("Map", balances) },
+			want:       "vec!().into_iter().collect::<HashMap::<String, u64>>()",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ir := &quintir.Output{}
+			b := newExprBuilder(ir)
+			expr := test.expr(b)
+			tr := newTranslator(ir)
+			tr.intDefault = test.intDefault
+			got := rust(tr.resolveExpr(expr, nil))
+			if test.err != "" {
+				if len(tr.diagnostics) != 1 || !strings.Contains(tr.diagnostics[0].Message, test.err) {
+					t.Errorf("got the problems %v, want one containing %q", tr.diagnostics, test.err)
+				}
+				return
+			}
+			if len(tr.diagnostics) > 0 {
+				t.Errorf("got the problems %v", tr.diagnostics)
+			}
+			if got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"piwasm/quintir"
+)
+
+// Position is a one-based line and column in the generated rust code. the column counts characters, not bytes,
+// like the columns of the diagnostics of rustc.
+type Position struct {
+	Line int `json:"line"`
+	Col  int `json:"col"`
+}
+
+// Mapping says that the rust code from Start to End (exclusive) was translated from Origin
+type Mapping struct {
+	Start  Position `json:"start"`
+	End    Position `json:"end"`
+	Origin Origin   `json:"origin"`
+}
+
+func (m Mapping) contains(pos Position) bool {
+	afterStart := pos.Line > m.Start.Line || (pos.Line == m.Start.Line && pos.Col >= m.Start.Col)
+	beforeEnd := pos.Line < m.End.Line || (pos.Line == m.End.Line && pos.Col < m.End.Col)
+	return afterStart && beforeEnd
+}
+
+// SourceMap is the file written next to the rust output, mapping rust ranges back to the quint model
+type SourceMap struct {
+	// the rust file the mappings are about
+	File     string    `json:"file"`
+	Mappings []Mapping `json:"mappings"`
+}
+
+// find returns the innermost mapping that contains pos
+func (s *SourceMap) find(pos Position) (Mapping, bool) {
+	var best Mapping
+	found := false
+	for _, m := range s.Mappings {
+		if !m.contains(pos) {
+			continue
+		}
+		// mappings are nested, so the innermost one starts last
+		if !found || m.Start.Line > best.Start.Line || (m.Start.Line == best.Start.Line && m.Start.Col >= best.Start.Col) {
+			best, found = m, true
+		}
+	}
+	return best, found
+}
+
+// the printer wraps nodes with an origin in these markers, see printNode.
+// the origin is stored as json, which never contains the raw marker bytes.
+const (
+	markerStart = '\x00'
+	markerOpen  = '\x01'
+	closeMarker = "\x00\x02"
+)
+
+func openMarker(origin Origin) string {
+	data, _ := json.Marshal(origin)
+	return string(markerStart) + string(data) + string(markerOpen)
+}
+
+// extractMappings removes the markers from printed code and returns where they were
+func extractMappings(marked string) (string, []Mapping) {
+	var sb strings.Builder
+	var mappings []Mapping
+	var open []Mapping
+
+	pos := Position{Line: 1, Col: 1}
+	for i := 0; i < len(marked); i++ {
+		c := marked[i]
+		if c == markerStart {
+			if marked[i+1] == closeMarker[1] {
+				m := open[len(open)-1]
+				open = open[:len(open)-1]
+				m.End = pos
+				mappings = append(mappings, m)
+				i++
+				continue
+			}
+			end := strings.IndexByte(marked[i:], markerOpen)
+			var origin Origin
+			_ = json.Unmarshal([]byte(marked[i+1:i+end]), &origin)
+			open = append(open, Mapping{Start: pos, Origin: origin})
+			i += end
+			continue
+		}
+
+		sb.WriteByte(c)
+		if c == '\n' {
+			pos.Line++
+			pos.Col = 1
+		} else if utf8.RuneStart(c) {
+			// the other bytes of a character that is not ascii, like the é of "café", take no column
+			pos.Col++
+		}
+	}
+
+	return sb.String(), mappings
+}
+
+// setOrigin records that node was translated from quintNode, unless node already has an origin
+func (t *translator) setOrigin(node AST, quintNode quintir.Node) {
+	// the placeholders are shared, so they must not get an origin
+	if node == nil || node == AST(TodoType) || node == AST(WildcardType) || quintNode == nil || quintNode.QuintID() == 0 {
+		return
+	}
+	n, ok := node.(interface{ origin() *Origin })
+	if !ok || n.origin().QuintID != 0 {
+		return
+	}
+	id := quintNode.QuintID()
+	*n.origin() = Origin{
+		QuintID: id,
+		Module:  t.context.module,
+		Decl:    t.context.name,
+		Loc:     t.ir.SourceMap[id],
+	}
+}
+
+func writeSourceMap(path string, rustFile string, mappings []Mapping) error {
+	data, err := json.MarshalIndent(SourceMap{File: filepath.Base(rustFile), Mappings: mappings}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// rustc points at code with lines like `  --> src/contract/ibc_transfer.rs:41:9`
+var rustcLocation = regexp.MustCompile(`^\s*--> (.+):(\d+):(\d+)\s*$`)
+
+// explain copies compiler output, adding the quint origin after every location in the generated file.
+// it implements the `explain` subcommand and returns the exit code.
+func explain(args []string) int {
+	flags := flag.NewFlagSet("explain", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s explain <source map path> [compiler output path]\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Reads the compiler output from stdin if no path is given, e.g. `cargo build 2>&1 | piwasm explain ibc_transfer.rs.map.json`")
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return 1
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading source map:", err)
+		return 1
+	}
+	var sourceMap SourceMap
+	if err := json.Unmarshal(data, &sourceMap); err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading source map:", err)
+		return 1
+	}
+
+	var input io.Reader = os.Stdin
+	if flags.NArg() > 1 {
+		file, err := os.Open(flags.Arg(1))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading compiler output:", err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fmt.Println(line)
+
+		match := rustcLocation.FindStringSubmatch(line)
+		if match == nil || filepath.Base(match[1]) != sourceMap.File {
+			continue
+		}
+		lineNumber, _ := strconv.Atoi(match[2])
+		col, _ := strconv.Atoi(match[3])
+		if m, ok := sourceMap.find(Position{Line: lineNumber, Col: col}); ok {
+			indent := line[:strings.Index(line, "-->")]
+			fmt.Printf("%s= quint: %s\n", indent, m.Origin.Describe())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading compiler output:", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestExtractMappings(t *testing.T) {
+	origin := Origin{QuintID: 7, Module: "m", Decl: "d"}
+	marked := "let x = \"café\";\nlet y = \"é\" + " + openMarker(origin) + "z" + closeMarker + ";"
+	code, mappings := extractMappings(marked)
+	if want := "let x = \"café\";\nlet y = \"é\" + z;"; code != want {
+		t.Errorf("got the code %q, want %q", code, want)
+	}
+	// the é is one column, though it is two bytes
+	want := Mapping{Start: Position{Line: 2, Col: 15}, End: Position{Line: 2, Col: 16}, Origin: origin}
+	if len(mappings) != 1 || mappings[0] != want {
+		t.Errorf("got the mappings %+v, want %+v", mappings, want)
+	}
+}
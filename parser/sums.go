@@ -0,0 +1,230 @@
+package main
+
+import (
+	"piwasm/quintir"
+)
+
+// sum types, `type T = A(int) | B`, become rust enums with the same variants. quint declares a constructor
+// for every variant, `pure def A(__AParam: int): T = variant("A", __AParam)` and `pure val B: T = variant("B", {})`,
+// whose uses construct the variant directly, and `match` expressions become `match` on the enum.
+
+// resolveSumDecl translates the typedef of a sum type into an enum
+func (t *translator) resolveSumDecl(d *quintir.TypeDef, sum *quintir.SumType) Decl {
+	enum := &EnumDecl{
+		Name: d.Name,
+		Attrs: []string{
+			"derive(Clone, Debug, PartialEq, Eq, Hash, Serialize, Deserialize)",
+			`serde(rename_all = "snake_case")`,
+		},
+	}
+	fields, _ := quintir.RowFields(sum.Fields)
+	for _, field := range fields {
+		variant := Variant{Name: field.FieldName}
+		if !isUnitType(field.FieldType) {
+			variant.Types = []Type{t.payloadType(field.FieldType)}
+		}
+		enum.Variants = append(enum.Variants, variant)
+	}
+	deriveDefault(enum)
+	t.setOrigin(enum, d)
+	return enum
+}
+
+// deriveDefault makes the first variant without payload the default value of the enum, so that the structs
+// with fields of the enum can derive Default. an enum whose variants all have a payload has no default.
+func deriveDefault(enum *EnumDecl) {
+	for i := range enum.Variants {
+		if variant := &enum.Variants[i]; len(variant.Types) == 0 && len(variant.Fields) == 0 {
+			variant.Default = true
+			enum.Attrs[0] = "derive(Clone, Debug, Default, PartialEq, Eq, Hash, Serialize, Deserialize)"
+			return
+		}
+	}
+}
+
+// hasDefault checks if the rust type of typ implements Default, which the enums only do if they have a variant
+// without payload
+func (t *translator) hasDefault(typ quintir.Type) bool {
+	if name, ok := typ.(*quintir.ConstType); ok {
+		if record, ok := t.taggedRecords[name.Name]; ok {
+			for _, variant := range record.variants {
+				if len(variant.fields) == 0 {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	if _, isOption := t.optionPayload(typ); isOption {
+		return true
+	}
+	switch tt := t.records.expand(typ).(type) {
+	case *quintir.RecType:
+		fields, _ := quintir.RowFields(tt.Fields)
+		for _, field := range fields {
+			if !t.hasDefault(field.FieldType) {
+				return false
+			}
+		}
+	case *quintir.TupType:
+		fields, _ := quintir.RowFields(tt.Fields)
+		for _, field := range fields {
+			if !t.hasDefault(field.FieldType) {
+				return false
+			}
+		}
+	case *quintir.SumType:
+		fields, _ := quintir.RowFields(tt.Fields)
+		for _, field := range fields {
+			if isUnitType(field.FieldType) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// payloadType translates the type of the payload of a variant, which must have a name if it is a record
+func (t *translator) payloadType(typ quintir.Type) Type {
+	if named := t.namedType(typ); named != nil {
+		return named
+	}
+	t.errorf(typ, "the payload of a variant must be a type that can be named in rust, like a record with a typedef")
+	return TodoType
+}
+
+// isUnitType checks if typ is the payload of variants without one, the empty record or tuple
+func isUnitType(typ quintir.Type) bool {
+	switch tt := typ.(type) {
+	case *quintir.RecType:
+		fields, closed := quintir.RowFields(tt.Fields)
+		return closed && len(fields) == 0
+	case *quintir.TupType:
+		fields, closed := quintir.RowFields(tt.Fields)
+		return closed && len(fields) == 0
+	}
+	return false
+}
+
+// sumVariants returns the variants of the sum type with the given typedef name, by label,
+// or nil if there is no such sum type
+func (t *translator) sumVariants(name string) map[string]quintir.Type {
+	sum, ok := t.records.expand(&quintir.ConstType{Name: name}).(*quintir.SumType)
+	if !ok {
+		return nil
+	}
+	fields, _ := quintir.RowFields(sum.Fields)
+	variants := make(map[string]quintir.Type, len(fields))
+	for _, field := range fields {
+		variants[field.FieldName] = field.FieldType
+	}
+	return variants
+}
+
+// sumName returns the name of the sum type that expr has, or "" after reporting that it is not known
+func (t *translator) sumName(expr quintir.Expr, exprType Type) string {
+	if constType, ok := exprType.(*ConstType); ok && isKnown(exprType) && t.sumVariants(constType.Name) != nil {
+		return constType.Name
+	}
+	if constType, ok := t.typeOf(expr).(*ConstType); ok && t.sumVariants(constType.Name) != nil {
+		return constType.Name
+	}
+	t.errorf(expr, "the sum type of the variant is not known")
+	return ""
+}
+
+// variantConstructor returns the variant application in the body of def, if def is the constructor of a variant
+func variantConstructor(def *quintir.OpDef) *quintir.App {
+	body := def.Expr
+	if lambda, ok := body.(*quintir.Lambda); ok {
+		body = lambda.Expr
+	}
+	if app, ok := body.(*quintir.App); ok && app.Opcode == "variant" && len(app.Args) == 2 {
+		return app
+	}
+	return nil
+}
+
+// resolveVariant translates the construction of the variant with the given label, like `variant("A", 3)`
+// or a call of its constructor `A(3)`, into `T::A(3)`
+func (t *translator) resolveVariant(expr quintir.Expr, label quintir.Expr, value quintir.Expr, exprType Type) Expr {
+	labelLit, ok := label.(*quintir.StrLit)
+	if !ok {
+		t.errorf(label, "variant labels must be string literals")
+		return newTodo()
+	}
+	if option := t.optionType(expr, exprType); option != nil {
+		return t.resolveOptionVariant(labelLit, value, option)
+	}
+	name := t.sumName(expr, exprType)
+	if name == "" {
+		return newTodo()
+	}
+	payload, ok := t.sumVariants(name)[labelLit.Value]
+	if !ok {
+		t.errorf(label, "the sum type %s has no variant %s", name, labelLit.Value)
+		return newTodo()
+	}
+
+	if isUnitType(payload) {
+		return &Variable{VariableName: name + "::" + labelLit.Value}
+	}
+	return &EnumCons{
+		EnumName: name,
+		Variant:  labelLit.Value,
+		Params:   []Expr{t.resolveExpr(value, t.payloadType(payload))},
+	}
+}
+
+// resolveMatchVariant translates `match e { A(x) => a | B => b | _ => c }`, which quint represents as
+// `matchVariant(e, "A", (x) => a, "B", (_) => b, "_", (_) => c)`, into a match with one arm per case
+func (t *translator) resolveMatchVariant(e *quintir.App, exprType Type) Expr {
+	var name string
+	var variants map[string]quintir.Type
+	var match *Match
+	option := t.optionType(e.Args[0], nil)
+	if option != nil {
+		name = "Option"
+		variants = map[string]quintir.Type{"Some": nil, "None": &quintir.TupType{Fields: &quintir.EmptyRow{}}}
+		match = &Match{Value: t.resolveExpr(e.Args[0], option)}
+	} else {
+		if name = t.sumName(e.Args[0], nil); name == "" {
+			return newTodo()
+		}
+		variants = t.sumVariants(name)
+		match = &Match{Value: t.resolveExpr(e.Args[0], &ConstType{Name: name})}
+	}
+
+	for i := 1; i+1 < len(e.Args); i += 2 {
+		label, ok := e.Args[i].(*quintir.StrLit)
+		if !ok {
+			t.errorf(e.Args[i], "variant labels must be string literals")
+			return newTodo()
+		}
+		lambda, ok := e.Args[i+1].(*quintir.Lambda)
+		if !ok || len(lambda.Params) != 1 {
+			t.errorf(e.Args[i+1], "the case %s of a match must be an operator with one parameter", label.Value)
+			return newTodo()
+		}
+
+		var pattern Expr
+		payload, known := variants[label.Value]
+		switch {
+		case label.Value == "_":
+			pattern = &Variable{VariableName: "_"}
+		case !known:
+			t.errorf(label, "the sum type %s has no variant %s", name, label.Value)
+			return newTodo()
+		case option != nil:
+			pattern = optionPattern(label.Value, lambda.Params[0].Name)
+		case isUnitType(payload):
+			pattern = &Variable{VariableName: name + "::" + label.Value}
+		default:
+			binding := &Variable{VariableName: lambda.Params[0].Name}
+			pattern = &EnumCons{EnumName: name, Variant: label.Value, Params: []Expr{binding}}
+		}
+		match.Arms = append(match.Arms, MatchArm{Pattern: pattern, Body: t.resolveExpr(lambda.Expr, exprType)})
+	}
+	return match
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"piwasm/quintir"
+)
+
+// quint has no sum types, so the models emulate them with tagged records like
+// `type StdResult = { tag: str, res: Result, error: Error }`, which are constructed by pure defs that fix the tag:
+// `pure def Ok(res: Result): StdResult = { tag: "ok", res: res, error: {msg: "no msg, since there is no error"} }`.
+// the payload of a tag are the fields that its constructions set to something other than a constant. the other
+// fields only fill the record, since quint needs all of them, like the error of Ok. such records become rust enums
+// with one variant per tag, StdResult::Ok(Result) and StdResult::Err(Error). a field that no tag has in its
+// payload implies a variant of its own, which the model does not construct: the error of
+// `type NeutronResult = { tag: str, messages: List[SubMsg_IbcTransfer], error: str }` is only set to a constant
+// by the "ok" tag, so NeutronResult becomes NeutronResult::Ok { messages } and NeutronResult::Error { error }.
+
+// taggedRecord is a record typedef that emulates a sum type
+type taggedRecord struct {
+	name string
+	// the variants in the order their tags are first constructed in the model
+	variants []*taggedVariant
+}
+
+type taggedVariant struct {
+	tag  string
+	name string
+	// the payload fields, in the order of the typedef
+	fields []string
+	// the fields that a construction of the variant sets to something other than a constant
+	set map[string]bool
+	// the variant has a single payload field whose type is a typedef, which names the payload well enough
+	// for a tuple variant like Ok(Result). other payloads keep their field names, like Ok { messages }.
+	tuple bool
+}
+
+// taggedConstructor is a pure def that constructs a tagged record with a fixed tag
+type taggedConstructor struct {
+	record  *taggedRecord
+	variant *taggedVariant
+	// the parameters of the def, and the expressions of the record fields in its body
+	params []string
+	values map[string]quintir.Expr
+}
+
+// findTaggedRecords finds the typedefs with a `tag: str` field that are constructed with literal tags,
+// and the defs that construct them
+func (t *translator) findTaggedRecords() {
+	candidates := make(map[string][]quintir.RowField)
+	for name, typeDef := range t.typeDefs {
+		rec, ok := typeDef.Type.(*quintir.RecType)
+		if !ok {
+			continue
+		}
+		fields, _ := quintir.RowFields(rec.Fields)
+		var payload []quintir.RowField
+		hasTag := false
+		for _, field := range fields {
+			if field.FieldName == "tag" {
+				_, hasTag = field.FieldType.(*quintir.StrType)
+			} else {
+				payload = append(payload, field)
+			}
+		}
+		if hasTag && len(payload) > 0 {
+			candidates[name] = payload
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	for _, module := range t.ir.Modules {
+		for _, decl := range module.Declarations {
+			def, ok := decl.(*quintir.OpDef)
+			if !ok {
+				continue
+			}
+			quintir.Walk(def.Expr, func(expr quintir.Expr) {
+				app, ok := expr.(*quintir.App)
+				if !ok || app.Opcode != "Rec" {
+					return
+				}
+				name, tag, values := t.taggedFields(app)
+				fields, ok := candidates[name]
+				if !ok || tag == "" {
+					return
+				}
+				record := t.taggedRecords[name]
+				if record == nil {
+					record = &taggedRecord{name: name}
+					t.taggedRecords[name] = record
+				}
+				variant := record.variant(tag)
+				if variant == nil {
+					variant = &taggedVariant{tag: tag, name: camelCase(tag), set: make(map[string]bool)}
+					record.variants = append(record.variants, variant)
+				}
+				for _, field := range fields {
+					if value := values[field.FieldName]; value != nil && !isConstant(value) {
+						variant.set[field.FieldName] = true
+					}
+				}
+
+				if lambda, ok := def.Expr.(*quintir.Lambda); ok && def.Qualifier == "puredef" && lambda.Expr == app {
+					constructor := &taggedConstructor{record: record, variant: variant, values: values}
+					for _, param := range lambda.Params {
+						constructor.params = append(constructor.params, param.Name)
+					}
+					t.constructors[def.ID] = constructor
+				}
+			})
+		}
+	}
+	for _, record := range t.taggedRecords {
+		record.addPayloads(candidates[record.name])
+	}
+}
+
+// taggedFields returns the name of the typedef of a record, its literal tag (or "" if the tag is not a literal),
+// and the expressions of its fields
+func (t *translator) taggedFields(rec *quintir.App) (name string, tag string, values map[string]quintir.Expr) {
+	inferred, ok := t.ir.TypeOf(rec.ID).(*quintir.RecType)
+	if !ok {
+		return "", "", nil
+	}
+	name, err := t.records.resolve(inferred)
+	if err != nil {
+		return "", "", nil
+	}
+	values = make(map[string]quintir.Expr)
+	for i := 0; i+1 < len(rec.Args); i += 2 {
+		if field, ok := rec.Args[i].(*quintir.StrLit); ok {
+			values[field.Value] = rec.Args[i+1]
+		}
+	}
+	if lit, ok := values["tag"].(*quintir.StrLit); ok {
+		tag = lit.Value
+	}
+	return name, tag, values
+}
+
+func (r *taggedRecord) variant(tag string) *taggedVariant {
+	for _, variant := range r.variants {
+		if variant.tag == tag {
+			return variant
+		}
+	}
+	return nil
+}
+
+// addPayloads decides the payload of every variant from the fields of the typedef other than tag, leaving out
+// the fields that the variant only sets to constants. the fields that are left out of every payload get a variant
+// of their own, named after the field.
+func (r *taggedRecord) addPayloads(fields []quintir.RowField) {
+	for _, variant := range r.variants {
+		for _, field := range fields {
+			if variant.set[field.FieldName] {
+				variant.fields = append(variant.fields, field.FieldName)
+			}
+		}
+	}
+	for _, field := range fields {
+		if !r.inPayload(field.FieldName) && r.variant(field.FieldName) == nil {
+			variant := &taggedVariant{tag: field.FieldName, name: camelCase(field.FieldName), set: make(map[string]bool)}
+			variant.fields = []string{field.FieldName}
+			r.variants = append(r.variants, variant)
+		}
+	}
+	for _, variant := range r.variants {
+		if len(variant.fields) != 1 {
+			continue
+		}
+		for _, field := range fields {
+			if field.FieldName == variant.fields[0] {
+				_, variant.tuple = field.FieldType.(*quintir.ConstType)
+			}
+		}
+	}
+}
+
+// inPayload checks if a variant has the field in its payload
+func (r *taggedRecord) inPayload(field string) bool {
+	for _, variant := range r.variants {
+		if contains(variant.fields, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// isConstant checks if expr is a literal, or a record, tuple or collection of literals
+func isConstant(expr quintir.Expr) bool {
+	switch e := expr.(type) {
+	case *quintir.BoolLit, *quintir.IntLit, *quintir.StrLit:
+		return true
+	case *quintir.App:
+		switch e.Opcode {
+		case "Rec", "Tup", "List", "Set":
+			for _, arg := range e.Args {
+				if !isConstant(arg) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTaggedDecl translates a tagged record typedef into an enum, with tuple variants like Ok(Result) and
+// struct variants like Ok { messages }
+func (t *translator) resolveTaggedDecl(record *taggedRecord) *EnumDecl {
+	enum := &EnumDecl{
+		Name: record.name,
+		Attrs: []string{
+			"derive(Clone, Debug, PartialEq, Eq, Hash, Serialize, Deserialize)",
+			`serde(rename_all = "snake_case")`,
+		},
+	}
+	recordType := &ConstType{Name: record.name}
+	for _, variant := range record.variants {
+		resolved := Variant{Name: variant.name}
+		for _, field := range variant.fields {
+			resolved.Fields = append(resolved.Fields, Field{Name: field, Type: t.fieldType(recordType, field)})
+		}
+		if variant.tuple {
+			resolved.Types = []Type{resolved.Fields[0].Type}
+			resolved.Fields = nil
+		}
+		enum.Variants = append(enum.Variants, resolved)
+	}
+	deriveDefault(enum)
+	return enum
+}
+
+// resolveTaggedCons translates the construction of a variant, from the expressions of the record fields
+func (t *translator) resolveTaggedCons(node quintir.Node, record *taggedRecord, variant *taggedVariant, values map[string]quintir.Expr) Expr {
+	recordType := &ConstType{Name: record.name}
+	payload := make([]Expr, len(variant.fields))
+	for i, field := range variant.fields {
+		value, ok := values[field]
+		if !ok {
+			t.errorf(node, "the %s %s is constructed without its field %s", record.name, variant.tag, field)
+			return newTodo()
+		}
+		payload[i] = t.resolveExpr(value, t.fieldType(recordType, field))
+	}
+
+	return variantCons(record, variant, payload)
+}
+
+// variantCons constructs a variant from the values of its payload fields
+func variantCons(record *taggedRecord, variant *taggedVariant, payload []Expr) Expr {
+	path := record.name + "::" + variant.name
+	switch {
+	case len(payload) == 0:
+		return &Variable{VariableName: path}
+	case variant.tuple:
+		return &EnumCons{EnumName: record.name, Variant: variant.name, Params: payload}
+	}
+	cons := &StructCons{StructName: path}
+	for i, field := range variant.fields {
+		cons.Fields = append(cons.Fields, FieldValue{Name: field, Value: payload[i]})
+	}
+	return cons
+}
+
+// resolveConstructorCall translates a call of a constructor like Ok(result) into the construction of its variant,
+// with the parameters in the body of the constructor replaced by the arguments of the call
+func (t *translator) resolveConstructorCall(call *quintir.App, constructor *taggedConstructor) Expr {
+	values := make(map[string]quintir.Expr, len(constructor.values))
+	for field, value := range constructor.values {
+		values[field] = value
+		if name, ok := value.(*quintir.Name); ok {
+			for i, param := range constructor.params {
+				if name.Name == param && i < len(call.Args) {
+					values[field] = call.Args[i]
+				}
+			}
+		}
+	}
+	return t.resolveTaggedCons(call, constructor.record, constructor.variant, values)
+}
+
+// tagComparison matches `x.tag == "ok"` and `"ok" == x.tag`, and returns x and the compared tag
+func (t *translator) tagComparison(eq *quintir.App) (quintir.Expr, *taggedRecord, *quintir.StrLit, bool) {
+	if eq.Opcode != "eq" && eq.Opcode != "neq" || len(eq.Args) != 2 {
+		return nil, nil, nil, false
+	}
+	for i := 0; i < 2; i++ {
+		field, ok := eq.Args[i].(*quintir.App)
+		lit, isLit := eq.Args[1-i].(*quintir.StrLit)
+		if !ok || !isLit || field.Opcode != "field" || len(field.Args) != 2 {
+			continue
+		}
+		if name, ok := field.Args[1].(*quintir.StrLit); !ok || name.Value != "tag" {
+			continue
+		}
+		record := t.taggedRecordOf(field.Args[0])
+		if record == nil {
+			continue
+		}
+		return field.Args[0], record, lit, true
+	}
+	return nil, nil, nil, false
+}
+
+// taggedRecordOf returns the tagged record that expr is, or nil if it is none
+func (t *translator) taggedRecordOf(expr quintir.Expr) *taggedRecord {
+	if constType, ok := t.typeOf(expr).(*ConstType); ok {
+		return t.taggedRecords[constType.Name]
+	}
+	return nil
+}
+
+// variantPattern returns the pattern that matches the variant, binding its payload to the given names,
+// or ignoring it if there are none
+func variantPattern(record *taggedRecord, variant *taggedVariant, bindings []string) Expr {
+	pattern := &VariantPattern{EnumName: record.name, Variant: variant.name, Bindings: bindings}
+	if len(variant.fields) == 0 {
+		return pattern
+	}
+	pattern.Rest = bindings == nil
+	if !variant.tuple {
+		pattern.Struct = true
+		if bindings != nil {
+			pattern.Fields = variant.fields
+		}
+	}
+	return pattern
+}
+
+// comparedVariant returns the variant of the tag that a tag comparison compares with,
+// or nil after reporting that no variant has it
+func (t *translator) comparedVariant(record *taggedRecord, tag *quintir.StrLit) *taggedVariant {
+	variant := record.variant(tag.Value)
+	if variant == nil {
+		t.errorf(tag, "%s is never constructed with the tag %q, so it has no variant for it", record.name, tag.Value)
+	}
+	return variant
+}
+
+// resolveTagTest translates `x.tag == "ok"` into `matches!(x, StdResult::Ok(..))`
+func (t *translator) resolveTagTest(eq *quintir.App, value quintir.Expr, record *taggedRecord, tag *quintir.StrLit) Expr {
+	variant := t.comparedVariant(record, tag)
+	if variant == nil {
+		return newTodo()
+	}
+	test := &Macro{Name: "matches", Args: []Expr{t.resolveExpr(value, nil), variantPattern(record, variant, nil)}}
+	if eq.Opcode == "neq" {
+		return &UnaryOp{Op: "!", Value: test}
+	}
+	return test
+}
+
+// resolveTagMatch translates `if (x.tag == "ok") a else b` into a match on x, in which the payload fields
+// of the variant are bound to variables, so that a can read them: `match x { StdResult::Ok(x_res) => a, _ => b }`.
+// it returns nil if the condition does not compare the tag of a variable.
+func (t *translator) resolveTagMatch(ite *quintir.App, exprType Type) Expr {
+	cond, ok := ite.Args[0].(*quintir.App)
+	if !ok {
+		return nil
+	}
+	value, record, tag, ok := t.tagComparison(cond)
+	if !ok {
+		return nil
+	}
+	name, ok := value.(*quintir.Name)
+	if !ok {
+		return nil
+	}
+	variant := t.comparedVariant(record, tag)
+	if variant == nil {
+		return newTodo()
+	}
+	then, els := ite.Args[1], ite.Args[2]
+	if cond.Opcode == "neq" {
+		then, els = els, then
+	}
+
+	bindings := make([]string, len(variant.fields))
+	payload := make(map[string]string, len(variant.fields))
+	for i, field := range variant.fields {
+		bindings[i] = name.Name + "_" + field
+		payload[field] = bindings[i]
+	}
+	outer := t.payloads[name.Name]
+	t.payloads[name.Name] = payload
+	thenExpr := t.resolveExpr(then, exprType)
+	t.payloads[name.Name] = outer
+	elseExpr := t.resolveExpr(els, exprType)
+
+	return &Match{
+		Value: t.resolveExpr(value, nil),
+		Arms: []MatchArm{
+			{Pattern: variantPattern(record, variant, bindings), Body: thenExpr},
+			{Pattern: &Variable{VariableName: "_"}, Body: elseExpr},
+		},
+	}
+}
+
+// resolveTaggedField translates reading a field of a tagged record, which is only possible for the payload
+// of the variant matched by an enclosing resolveTagMatch
+func (t *translator) resolveTaggedField(access *quintir.App, record *taggedRecord, field string) Expr {
+	if name, ok := access.Args[0].(*quintir.Name); ok {
+		if binding, ok := t.payloads[name.Name][field]; ok {
+			return &Variable{VariableName: binding}
+		}
+	}
+	if field == "tag" {
+		t.errorf(access, "the tag of %s can only be compared with a string literal", record.name)
+	} else {
+		t.errorf(access, "the field %s of %s can only be read in the branch of an if that checks the tag of a variable, like `if (x.tag == \"ok\") x.%s else ...`", field, record.name, field)
+	}
+	return newTodo()
+}
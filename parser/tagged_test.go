@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"piwasm/quintir"
+)
+
+// findDef returns the top-level definition with the given name of the module
+func findDef(t *testing.T, ir *quintir.Output, module, name string) *quintir.OpDef {
+	t.Helper()
+	for _, decl := range ir.Module(module).Declarations {
+		if def, ok := decl.(*quintir.OpDef); ok && def.Name == name {
+			return def
+		}
+	}
+	t.Fatalf("%s has no definition %s", module, name)
+	return nil
+}
+
+// TestTaggedRecordDecls checks the enums of the tagged records of the stdlib, which the hand-written conversions
+// into cosmwasm results match on
+func TestTaggedRecordDecls(t *testing.T) {
+	tests := map[string]string{
+		"StdResult": "pub enum StdResult {\n    Ok(Result),\n    Err(Error),\n}",
+		// the error of the "ok" tag is only set to a constant, so it has a variant of its own
+		"NeutronResult": "pub enum NeutronResult {\n    Ok { messages: Vector::<SubMsg_IbcTransfer> },\n    Error { error: String },\n}",
+	}
+	tr := newTranslator(loadModel(t))
+	for name, want := range tests {
+		got := rust(tr.resolveTypeDef(tr.typeDefs[name]))
+		if !strings.Contains(got, want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", name, got, want)
+		}
+	}
+	if len(tr.diagnostics) > 0 {
+		t.Errorf("got the problems %v", tr.diagnostics)
+	}
+}
+
+func TestTaggedExprs(t *testing.T) {
+	result, neutronResult := &quintir.ConstType{Name: "StdResult"}, &quintir.ConstType{Name: "NeutronResult"}
+	str := &quintir.StrType{}
+	tests := []struct {
+		name string
+		expr func(b *exprBuilder, ir *quintir.Output) quintir.Expr
+		want string
+		// a part of the problem that is reported, if any
+		err string
+	}{
+		{
+			name: "tag test",
+			expr: func(b *exprBuilder, _ *quintir.Output) quintir.Expr {
+				return b.app("eq", nil, b.app("field", str, b.name("r", result), b.str("tag")), b.str("ok"))
+			},
+			want: "matches!(r, StdResult::Ok(..))",
+		},
+		{
+			name: "tag on the right",
+			expr: func(b *exprBuilder, _ *quintir.Output) quintir.Expr {
+				return b.app("eq", nil, b.str("err"), b.app("field", str, b.name("r", result), b.str("tag")))
+			},
+			want: "matches!(r, StdResult::Err(..))",
+		},
+		{
+			name: "negated tag test",
+			expr: func(b *exprBuilder, _ *quintir.Output) quintir.Expr {
+				return b.app("neq", nil, b.app("field", str, b.name("r", result), b.str("tag")), b.str("ok"))
+			},
+			want: "!matches!(r, StdResult::Ok(..))",
+		},
+		{
+			name: "unknown tag",
+			expr: func(b *exprBuilder, _ *quintir.Output) quintir.Expr {
+				return b.app("eq", nil, b.app("field", str, b.name("r", result), b.str("tag")), b.str("pending"))
+			},
+			err: `StdResult is never constructed with the tag "pending", so it has no variant for it`,
+		},
+		{
+			name: "if on the tag",
+			expr: func(b *exprBuilder, _ *quintir.Output) quintir.Expr {
+				cond := b.app("eq", nil, b.app("field", str, b.name("r", result), b.str("tag")), b.str("ok"))
+				data := b.app("field", str, b.app("field", &quintir.ConstType{Name: "Result"}, b.name("r", result), b.str("res")), b.str("data"))
+				return b.app("ite", str, cond, data, b.str("failed"))
+			},
+			want: "match r {\n    StdResult::Ok(r_res) => r_res.data,\n    _ => \"failed\".to_string(),\n}",
+		},
+		{
+			name: "tag test of a struct variant",
+			expr: func(b *exprBuilder, _ *quintir.Output) quintir.Expr {
+				return b.app("eq", nil, b.app("field", str, b.name("n", neutronResult), b.str("tag")), b.str("error"))
+			},
+			want: "matches!(n, NeutronResult::Error { .. })",
+		},
+		{
+			name: "if on the tag of a struct variant",
+			expr: func(b *exprBuilder, _ *quintir.Output) quintir.Expr {
+				cond := b.app("eq", nil, b.app("field", str, b.name("n", neutronResult), b.str("tag")), b.str("error"))
+				return b.app("ite", str, cond, b.app("field", str, b.name("n", neutronResult), b.str("error")), b.str("none"))
+			},
+			want: "match n {\n    NeutronResult::Error { error: n_error } => n_error,\n    _ => \"none\".to_string(),\n}",
+		},
+		{
+			name: "payload outside of an if on the tag",
+			expr: func(b *exprBuilder, _ *quintir.Output) quintir.Expr {
+				return b.app("field", &quintir.ConstType{Name: "Error"}, b.name("r", result), b.str("error"))
+			},
+			err: "the field error of StdResult can only be read in the branch of an if that checks the tag of a variable",
+		},
+		{
+			name: "constructor call",
+			expr: func(b *exprBuilder, ir *quintir.Output) quintir.Expr {
+				return b.call(findDef(t, ir, "wasm_stdlib", "Err"), result, b.name("e", &quintir.ConstType{Name: "Error"}))
+			},
+			want: "StdResult::Err(e)",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ir := loadModel(t)
+			tr := newTranslator(ir)
+			expr := test.expr(newExprBuilder(ir), ir)
+			got := rust(tr.resolveExpr(expr, nil))
+			if test.err != "" {
+				if len(tr.diagnostics) != 1 || !strings.Contains(tr.diagnostics[0].Message, test.err) {
+					t.Errorf("got the problems %v, want one containing %q", tr.diagnostics, test.err)
+				}
+				return
+			}
+			if len(tr.diagnostics) > 0 {
+				t.Errorf("got the problems %v", tr.diagnostics)
+			}
+			if got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
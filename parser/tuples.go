@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"piwasm/quintir"
+)
+
+// the elements of tuples are numbered from 1 in quint, `r._1`, and from 0 in rust, `r.0`. a val that is
+// only used through its elements, like the `val result = instantiate(...)` of
+// `all { storage' = result._2, result._1.tag == "ok" }`, is destructured instead,
+// `let (result_1, result_2) = instantiate(...)`, so that the elements can be moved out of it separately.
+
+// resolveItem translates the projection of an element of a tuple
+func (t *translator) resolveItem(e *quintir.App) Expr {
+	if len(e.Args) != 2 {
+		t.errorf(e, "item expects 2 arguments, got %d", len(e.Args))
+		return newTodo()
+	}
+	index, ok := e.Args[1].(*quintir.IntLit)
+	if !ok || !index.Value.IsInt64() || index.Value.Int64() < 1 {
+		t.errorf(e.Args[1], "tuple elements must be projected with a positive integer literal")
+		return newTodo()
+	}
+	i := int(index.Value.Int64())
+
+	if name, ok := e.Args[0].(*quintir.Name); ok {
+		if lookup := t.ir.Lookup(name.ID); lookup != nil {
+			if names, ok := t.destructured[lookup.Def.QuintID()]; ok && i <= len(names) {
+				// the element already is a variable of its own
+				variable := &Variable{VariableName: names[i-1], Copy: isCopy(t.ir.TypeOf(e.ID))}
+				return t.cloneCaptured(lookup.Def.QuintID(), t.ir.TypeOf(e.ID), variable)
+			}
+		}
+	}
+	return &FieldAccess{Value: t.resolveExpr(e.Args[0], nil), Field: strconv.Itoa(i - 1)}
+}
+
+// destructure decides if the val of the let is destructured into the variables of its elements, and remembers
+// their names for the projections in the body. the elements that are not used are bound to _.
+// it has to be called before the body is resolved, and returns the names, or nil if the val stays a tuple.
+func (t *translator) destructure(e *quintir.Let) []string {
+	if e.Opdef.Qualifier != "val" && e.Opdef.Qualifier != "pureval" {
+		return nil
+	}
+	tuple, ok := t.ir.TypeOf(e.Opdef.ID).(*quintir.TupType)
+	if !ok {
+		return nil
+	}
+	fields, _ := quintir.RowFields(tuple.Fields)
+
+	// every use of the val must be the projection of an element
+	uses, projected := 0, make(map[int]bool)
+	quintir.Walk(e.Expr, func(expr quintir.Expr) {
+		switch x := expr.(type) {
+		case *quintir.Name:
+			if t.refersTo(x, e.Opdef.ID) {
+				uses++
+			}
+		case *quintir.App:
+			if x.Opcode != "item" || len(x.Args) != 2 {
+				return
+			}
+			name, isName := x.Args[0].(*quintir.Name)
+			index, isLit := x.Args[1].(*quintir.IntLit)
+			if isName && isLit && t.refersTo(name, e.Opdef.ID) && index.Value.IsInt64() {
+				if i := int(index.Value.Int64()); i >= 1 && i <= len(fields) {
+					projected[i] = true
+					uses--
+				}
+			}
+		}
+	})
+	if uses != 0 || len(projected) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(fields))
+	for i := range names {
+		names[i] = "_"
+		if projected[i+1] {
+			names[i] = fmt.Sprintf("%s_%d", e.Opdef.Name, i+1)
+		}
+	}
+	t.destructured[e.Opdef.ID] = names
+	return names
+}
+
+// refersTo checks if name is a use of the def with the given id
+func (t *translator) refersTo(name *quintir.Name, id int) bool {
+	lookup := t.ir.Lookup(name.ID)
+	return lookup != nil && lookup.Def.QuintID() == id
+}
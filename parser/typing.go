@@ -0,0 +1,303 @@
+package main
+
+import (
+	"piwasm/quintir"
+)
+
+// translator holds the typechecker output while it is translated into the rust AST.
+type translator struct {
+	ir *quintir.Output
+
+	// typedefs of all modules by name, including the modules that are not translated
+	typeDefs map[string]*quintir.TypeDef
+	// names anonymous records by their typedefs
+	records *recordResolver
+	// top-level definitions of all modules by id.
+	// we need these because the lookup table does not contain type annotations.
+	opDefs map[int]*quintir.OpDef
+
+	// types of let-bound vals, keyed by the id of the val.
+	// records are structural in quint, so `val x = {data: ""}` only gets a name from the places x is used in,
+	// e.g. `Ok(x)` tells us that x is a Result.
+	letTypes map[int]Type
+
+	// the records that emulate sum types, by the name of their typedef, and the defs that construct them by id
+	taggedRecords map[string]*taggedRecord
+	constructors  map[int]*taggedConstructor
+	// translate polymorphic defs into a copy per type they are used with, instead of generic functions.
+	// the copies that are still to be translated, the names of all copies, and the types of the type variables
+	// of the copy that is translated
+	monomorphize  bool
+	instances     []*instance
+	instanceNames map[string]bool
+	typeArgs      map[string]Type
+	// how integer operators are translated, see arithmetics
+	arithmetic string
+	// the width of the integers that are not inferred, and the inferred widths, see widths.go
+	intDefault string
+	widths     *intInference
+	// the defs that can fail with checked arithmetic and return a Result, by id
+	fallible map[int]bool
+	// whether the errors of checked arithmetic are returned from the function being translated, or panic
+	propagates bool
+	// the variables captured by the closures being translated, which are cloned where they are used, by id
+	captured map[int]bool
+	// whether a run is translated. runs are not polymorphic, so their type variables are not constrained at all,
+	// like the value type of the `Map()` of `Map().mapRemove(3)`, and any type does
+	inRun bool
+	// the names of the variables that let-bound tuples are destructured into, by the id of the val, see tuples.go
+	destructured map[int][]string
+	// the stdlib module that is translated instead of the modules of the contract, if any
+	stdlib string
+	// the names of the modules of the top-level definitions, by id
+	defModules map[int]string
+
+	// the variables bound to the payload of a matched tagged record, by the name of the variable that holds the
+	// record and the field
+	payloads map[string]map[string]string
+
+	// the declaration that is currently translated, and the problems found so far
+	context     declContext
+	diagnostics Diagnostics
+}
+
+func newTranslator(ir *quintir.Output) *translator {
+	records := newRecordResolver(ir.Modules)
+	t := &translator{
+		ir:       ir,
+		typeDefs: records.typeDefs,
+		records:  records,
+		opDefs:   make(map[int]*quintir.OpDef),
+		letTypes: make(map[int]Type),
+
+		taggedRecords: make(map[string]*taggedRecord),
+		constructors:  make(map[int]*taggedConstructor),
+		payloads:      make(map[string]map[string]string),
+
+		instanceNames: make(map[string]bool),
+		defModules:    make(map[int]string),
+		arithmetic:    "plain",
+		intDefault:    "u64",
+		fallible:      make(map[int]bool),
+		destructured:  make(map[int][]string),
+	}
+	for _, module := range ir.Modules {
+		for _, decl := range module.Declarations {
+			if def, ok := decl.(*quintir.OpDef); ok {
+				t.opDefs[def.ID] = def
+				t.defModules[def.ID] = module.Name
+			}
+		}
+	}
+	t.findTaggedRecords()
+	return t
+}
+
+// typeOf returns the type the typechecker inferred for expr,
+// or nil if that type cannot be named in rust, e.g. because it contains type variables.
+func (t *translator) typeOf(expr quintir.Expr) Type {
+	inferred := t.ir.TypeOf(expr.QuintID())
+	if inferred == nil {
+		return nil
+	}
+	return t.namedType(inferred)
+}
+
+// namedType translates an inferred type like resolveType, except that anonymous records are replaced by
+// the typedef they match. it returns nil if some part of the type cannot be named.
+func (t *translator) namedType(typ quintir.Type) Type {
+	switch qt := typ.(type) {
+	case *quintir.VarType:
+		// only known in a copy of a polymorphic def
+		if typeArg, ok := t.typeArgs[qt.Name]; ok {
+			return typeArg
+		}
+		if t.inRun {
+			return &TupleType{}
+		}
+	case *quintir.BoolType, *quintir.IntType, *quintir.StrType, *quintir.ConstType:
+		return t.resolveType(typ)
+	case *quintir.RecType:
+		name, err := t.records.resolve(qt)
+		if err != nil {
+			return nil
+		}
+		return &ConstType{Name: name}
+	case *quintir.SumType, *quintir.AppType:
+		if payload, ok := t.optionPayload(qt); ok {
+			if value := t.namedType(payload); value != nil {
+				return &OptionType{ValueType: value}
+			}
+			return nil
+		}
+		sum, ok := qt.(*quintir.SumType)
+		if !ok {
+			return nil
+		}
+		name, err := t.records.resolveSum(sum)
+		if err != nil {
+			return nil
+		}
+		return &ConstType{Name: name}
+	case *quintir.SetType:
+		if elem := t.namedType(qt.Elem); elem != nil {
+			return &SetType{ElementType: elem}
+		}
+	case *quintir.ListType:
+		if elem := t.namedType(qt.Elem); elem != nil {
+			return &ListType{ElementType: elem}
+		}
+	case *quintir.FunType:
+		key, value := t.namedType(qt.Arg), t.namedType(qt.Res)
+		if key != nil && value != nil {
+			return &MapType{Key: key, Value: value}
+		}
+	case *quintir.TupType:
+		fields, closed := quintir.RowFields(qt.Fields)
+		if !closed {
+			return nil
+		}
+		types := make([]Type, len(fields))
+		for i, field := range fields {
+			if types[i] = t.namedType(field.FieldType); types[i] == nil {
+				return nil
+			}
+		}
+		return &TupleType{Types: types}
+	}
+	return nil
+}
+
+// expectedType returns exprType if the context of expr determines its type, and otherwise the inferred type of expr.
+func (t *translator) expectedType(expr quintir.Expr, exprType Type) Type {
+	if isKnown(exprType) {
+		return exprType
+	}
+	return t.typeOf(expr)
+}
+
+// isKnown checks that typ is neither missing nor a placeholder
+func isKnown(typ Type) bool {
+	return typ != nil && typ != WildcardType && typ != TodoType
+}
+
+// recordLetType remembers the type of a let-bound val from a place where it is used with a known type
+func (t *translator) recordLetType(name *quintir.Name, exprType Type) {
+	if _, ok := exprType.(*ConstType); !ok || !isKnown(exprType) {
+		return
+	}
+	lookup := t.ir.Lookup(name.ID)
+	if lookup == nil {
+		return
+	}
+	def, ok := lookup.Def.(*quintir.OpDef)
+	if !ok || def.Qualifier != "val" {
+		return
+	}
+	if _, known := t.letTypes[def.ID]; !known {
+		t.letTypes[def.ID] = exprType
+	}
+}
+
+// fieldType returns the type of a field of a named record type, or nil if it is unknown
+func (t *translator) fieldType(recordType Type, field string) Type {
+	constType, ok := recordType.(*ConstType)
+	if !ok {
+		return nil
+	}
+	typeDef, ok := t.typeDefs[constType.Name]
+	if !ok || typeDef.Type == nil {
+		return nil
+	}
+
+	switch typ := typeDef.Type.(type) {
+	case *quintir.RecType:
+		fields, _ := quintir.RowFields(typ.Fields)
+		for _, f := range fields {
+			if f.FieldName == field {
+				return t.resolveType(f.FieldType)
+			}
+		}
+	case *quintir.ConstType:
+		// an alias of another named type
+		return t.fieldType(&ConstType{Name: typ.Name}, field)
+	}
+	return nil
+}
+
+// paramTypes returns the parameter types of the definition that app calls,
+// or nil if app applies a builtin operator.
+func (t *translator) paramTypes(app *quintir.App) []Type {
+	lookup := t.ir.Lookup(app.ID)
+	if lookup == nil {
+		return nil
+	}
+	def, ok := t.opDefs[lookup.Def.QuintID()]
+	if !ok {
+		return nil
+	}
+	operType, ok := def.TypeAnnotation.(*quintir.OperType)
+	if !ok {
+		return nil
+	}
+	// generic parameters like Set[a] have no type that can be named, they are left nil. this holds in runs too,
+	// whose type variables are unit, since the type variables of the def are not those of the run.
+	inRun := t.inRun
+	t.inRun = false
+	defer func() { t.inRun = inRun }()
+	types := make([]Type, len(operType.Args))
+	for i, arg := range operType.Args {
+		types[i] = t.namedType(arg)
+	}
+	return types
+}
+
+// defType returns the type annotation of def, or the type the typechecker inferred if there is none
+func (t *translator) defType(def *quintir.OpDef) quintir.Type {
+	if def.TypeAnnotation != nil {
+		return def.TypeAnnotation
+	}
+	return t.ir.TypeOf(def.ID)
+}
+
+// elementType returns the type of the i-th element of a tuple, or of the elements of a set or list
+func elementType(collectionType Type, i int) Type {
+	switch typ := collectionType.(type) {
+	case *TupleType:
+		if i < len(typ.Types) {
+			return typ.Types[i]
+		}
+	case *SetType:
+		return typ.ElementType
+	case *ListType:
+		return typ.ElementType
+	}
+	return nil
+}
+
+func typeAt(types []Type, i int) Type {
+	if i < len(types) {
+		return types[i]
+	}
+	return nil
+}
+
+// structName returns the name of the rust struct that the record constructed by rec has.
+// if the context does not say which struct it is, the record is matched against the typedefs.
+func (t *translator) structName(rec *quintir.App, exprType Type) string {
+	if constType, ok := exprType.(*ConstType); ok && isKnown(exprType) {
+		return constType.Name
+	}
+
+	inferred, ok := t.ir.TypeOf(rec.ID).(*quintir.RecType)
+	if !ok {
+		t.errorf(rec, "record without an inferred record type")
+		return Todo.Name
+	}
+	name, err := t.records.resolve(inferred)
+	if err != nil {
+		t.errorf(rec, "could not name record: %s", err)
+		return Todo.Name
+	}
+	return name
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"piwasm/quintir"
+)
+
+// quint has a single unbounded int, which becomes a rust integer of a fixed width. the widths are inferred per
+// variable, parameter, result and record field: the integers that have to be the same rust type are grouped
+// (the operands of an operator, an argument and its parameter, a value and the field it is stored in, ...),
+// and a group becomes signed if it can be negative, because it has a negative literal, a unary minus or a
+// subtraction, and wider if it has a literal that does not fit otherwise. the remaining groups, and the
+// integers in collections, variants and tuples, have the width of --int-default.
+// a group that needs another width than the one it is stuck with, like a negative value stored in a set of u64,
+// is reported, since the generated code would not compile.
+
+// intWidths are the widths integers can have, narrowest first
+var intWidths = []string{"u64", "i64", "i128", "Uint128"}
+
+// validIntWidth checks the value of --int-default
+func validIntWidth(width string) error {
+	if !contains(intWidths, width) {
+		return fmt.Errorf("unknown integer width %q, expected one of %s", width, strings.Join(intWidths, ", "))
+	}
+	return nil
+}
+
+// widthType returns the rust type of an integer width
+func widthType(width string) Type {
+	switch width {
+	case "i64", "i128":
+		return &SignedType{Name: width}
+	case "Uint128":
+		return &BigUintType{Name: width}
+	}
+	return &UInt64Type{}
+}
+
+// widthRange returns the smallest and largest value of an integer width
+func widthRange(width string) (*big.Int, *big.Int) {
+	bits := map[string]uint{"u64": 64, "i64": 63, "i128": 127, "Uint128": 128}[width]
+	max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits), big.NewInt(1))
+	min := new(big.Int)
+	if strings.HasPrefix(width, "i") {
+		min.Neg(max).Sub(min, big.NewInt(1))
+	}
+	return min, max
+}
+
+// intGroup is a group of integers that have the same rust type
+type intGroup struct {
+	parent *intGroup
+	// the node that makes the group signed, or nil
+	signed quintir.Node
+	// the node that sticks the group to the default width, or nil
+	pinned quintir.Node
+	// the literals of the group, with their signs
+	literals []*quintir.IntLit
+	negated  map[*quintir.IntLit]bool
+	width    string
+}
+
+func (g *intGroup) root() *intGroup {
+	for g.parent != nil {
+		g = g.parent
+	}
+	return g
+}
+
+// intInference groups the integers of the model, keyed by the ids of expressions, parameters and defs,
+// and by `Record.field` for the fields of records
+type intInference struct {
+	t      *translator
+	groups map[string]*intGroup
+	// the top-level def of every expression, to report problems in
+	defs map[int]*quintir.OpDef
+	def  *quintir.OpDef
+}
+
+func (n *intInference) group(key string) *intGroup {
+	g, ok := n.groups[key]
+	if !ok {
+		g = &intGroup{negated: make(map[*quintir.IntLit]bool)}
+		n.groups[key] = g
+	}
+	return g.root()
+}
+
+func idKey(id int) string {
+	return strconv.Itoa(id)
+}
+
+// union puts the integers with the given keys in the same group
+func (n *intInference) union(a, b string) {
+	ga, gb := n.group(a), n.group(b)
+	if ga == gb {
+		return
+	}
+	gb.parent = ga
+	if ga.signed == nil {
+		ga.signed = gb.signed
+	}
+	if ga.pinned == nil {
+		ga.pinned = gb.pinned
+	}
+	ga.literals = append(ga.literals, gb.literals...)
+	for lit, negated := range gb.negated {
+		ga.negated[lit] = negated
+	}
+}
+
+// isInt checks if the typechecker inferred int for the expression
+func (n *intInference) isInt(expr quintir.Expr) bool {
+	_, ok := n.t.ir.TypeOf(expr.QuintID()).(*quintir.IntType)
+	return ok
+}
+
+// unionExprs puts the integer expressions in the same group as key
+func (n *intInference) unionExprs(key string, exprs ...quintir.Expr) {
+	for _, expr := range exprs {
+		if n.isInt(expr) {
+			n.union(key, idKey(expr.QuintID()))
+		}
+	}
+}
+
+// pin sticks the integer expressions to the default width, since their rust type is fixed elsewhere
+func (n *intInference) pin(exprs ...quintir.Expr) {
+	for _, expr := range exprs {
+		if n.isInt(expr) {
+			if g := n.group(idKey(expr.QuintID())); g.pinned == nil {
+				g.pinned = expr
+			}
+		}
+	}
+}
+
+// recordName returns the name of the record type of expr, or "" if it is no named record
+func (n *intInference) recordName(expr quintir.Expr) string {
+	switch typ := n.t.ir.TypeOf(expr.QuintID()).(type) {
+	case *quintir.ConstType:
+		return typ.Name
+	case *quintir.RecType:
+		name, err := n.t.records.resolve(typ)
+		if err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// fieldKey returns the key of a field of the record type of expr, or "" if the record has no name
+func (n *intInference) fieldKey(expr quintir.Expr, field quintir.Expr) string {
+	name := n.recordName(expr)
+	lit, ok := field.(*quintir.StrLit)
+	if name == "" || !ok {
+		return ""
+	}
+	if _, tagged := n.t.taggedRecords[name]; tagged {
+		// the payloads of tagged records become fields of enum variants, which are not inferred
+		return ""
+	}
+	return name + "." + lit.Value
+}
+
+// inferDef groups the integers of a top-level def
+func (n *intInference) inferDef(def *quintir.OpDef) {
+	body := def.Expr
+	if lambda, ok := body.(*quintir.Lambda); ok {
+		body = lambda.Expr
+	}
+	n.def = def
+	n.unionExprs(idKey(def.ID), body)
+	n.inferExpr(def.Expr)
+}
+
+// inferExpr groups the integers of expr and its subexpressions
+func (n *intInference) inferExpr(expr quintir.Expr) {
+	key := idKey(expr.QuintID())
+	n.defs[expr.QuintID()] = n.def
+	switch e := expr.(type) {
+	case *quintir.IntLit:
+		g := n.group(key)
+		g.literals = append(g.literals, e)
+
+	case *quintir.Name:
+		lookup := n.t.ir.Lookup(e.ID)
+		if lookup == nil {
+			break
+		}
+		if module, ok := n.t.defModules[lookup.Def.QuintID()]; ok && !n.inferred(module) {
+			// a def of the hand-written stdlib, whose rust type is fixed
+			n.pin(e)
+		} else if n.isInt(e) {
+			n.union(key, idKey(lookup.Def.QuintID()))
+		}
+
+	case *quintir.Let:
+		n.unionExprs(idKey(e.Opdef.ID), e.Opdef.Expr)
+		n.unionExprs(key, e.Expr)
+		n.inferExpr(e.Opdef.Expr)
+		n.inferExpr(e.Expr)
+
+	case *quintir.Lambda:
+		n.inferExpr(e.Expr)
+
+	case *quintir.App:
+		n.inferApp(e)
+		for _, arg := range e.Args {
+			n.inferExpr(arg)
+		}
+	}
+}
+
+// inferApp groups the integers of an operator application with its arguments
+func (n *intInference) inferApp(e *quintir.App) {
+	key := idKey(e.ID)
+	args := e.Args
+	switch e.Opcode {
+	case "iadd", "imul", "idiv", "imod":
+		n.unionExprs(key, args...)
+	case "isub":
+		n.unionExprs(key, args...)
+		n.signed(key, e)
+	case "iuminus":
+		n.unionExprs(key, args...)
+		n.signed(key, e)
+		if lit, ok := args[0].(*quintir.IntLit); ok {
+			n.group(key).negated[lit] = true
+		}
+	case "ipow":
+		// the exponent is a u32 of its own
+		n.unionExprs(key, args[0])
+	case "igt", "ilt", "igte", "ilte", "eq", "neq":
+		if len(args) == 2 && n.isInt(args[0]) {
+			n.unionExprs(idKey(args[0].QuintID()), args[1])
+		}
+	case "ite":
+		n.unionExprs(key, args[1], args[2])
+	case "Rec":
+		for i := 0; i+1 < len(args); i += 2 {
+			if field := n.fieldKey(e, args[i]); field != "" {
+				n.unionExprs(field, args[i+1])
+			} else {
+				n.pin(args[i+1])
+			}
+		}
+	case "field":
+		if field := n.fieldKey(args[0], args[1]); field != "" {
+			n.unionExprs(field, e)
+		} else {
+			n.pin(e)
+		}
+	case "with":
+		if field := n.fieldKey(args[0], args[1]); field != "" {
+			n.unionExprs(field, args[2])
+		} else {
+			n.pin(args[2])
+		}
+	case "and", "or", "not", "implies", "iff":
+		// only booleans
+	default:
+		lookup := n.t.ir.Lookup(e.ID)
+		if lookup != nil {
+			if def, ok := lookup.Def.(*quintir.OpDef); ok && n.inferred(n.t.defModules[def.ID]) {
+				// a call of a def of the model, whose parameters and result are inferred with its arguments
+				if lambda, ok := def.Expr.(*quintir.Lambda); ok && len(lambda.Params) == len(args) {
+					for i, param := range lambda.Params {
+						n.unionExprs(idKey(param.ID), args[i])
+					}
+					n.unionExprs(idKey(def.ID), e)
+					return
+				}
+			}
+		}
+		// the builtins and the hand-written stdlib have fixed types, and so do the collections, tuples and
+		// variants they build, including the parameters and results of the operators they are passed
+		n.pin(e)
+		for _, arg := range args {
+			if lambda, ok := arg.(*quintir.Lambda); ok {
+				for _, param := range lambda.Params {
+					if g := n.group(idKey(param.ID)); g.pinned == nil {
+						g.pinned = lambda
+					}
+				}
+				n.pin(lambda.Expr)
+			} else {
+				n.pin(arg)
+			}
+		}
+	}
+}
+
+// signed marks the group of key as possibly negative because of node
+func (n *intInference) signed(key string, node quintir.Node) {
+	if g := n.group(key); g.signed == nil {
+		g.signed = node
+	}
+}
+
+// inferred checks if the integers of the defs of a module are inferred, which are the ones of the translated
+// modules and of the tests, which call them
+func (n *intInference) inferred(module string) bool {
+	return n.t.translates(module) || strings.HasSuffix(module, "_test")
+}
+
+// inferWidths chooses the widths of the integers of the model
+func (t *translator) inferWidths() {
+	n := &intInference{t: t, groups: make(map[string]*intGroup), defs: make(map[int]*quintir.OpDef)}
+	t.widths = n
+	if t.bigUint() != "" {
+		// with --arithmetic uint128 and uint256, every integer is a cosmwasm integer
+		return
+	}
+	for id, def := range t.opDefs {
+		if n.inferred(t.defModules[id]) {
+			n.inferDef(def)
+		}
+	}
+	// the order of the defs is not fixed, so the groups are decided after all of them are known
+	for key := range n.groups {
+		if g := n.group(key); g.width == "" {
+			g.width = t.chooseWidth(g)
+		}
+	}
+}
+
+// chooseWidth returns the width of a group, which is the default if it fits, and reports when no width fits
+func (t *translator) chooseWidth(g *intGroup) string {
+	candidates := append([]string{t.intDefault}, intWidths...)
+	if g.pinned != nil {
+		candidates = []string{t.intDefault}
+	}
+	for _, width := range candidates {
+		if t.fitsWidth(g, width) {
+			return width
+		}
+	}
+
+	width := t.intDefault
+	switch {
+	case g.pinned != nil && g.signed != nil && !strings.HasPrefix(width, "i"):
+		t.enterDefOf(g.signed)
+		t.errorf(g.signed, "this integer can be negative, but it is also used where the integers are %s, like in a collection (at id %d); pass --int-default i64 to use signed integers there",
+			width, g.pinned.QuintID())
+	default:
+		for _, lit := range g.literals {
+			if !t.fitsLiteral(lit, g.negated[lit], width) {
+				value := lit.Value.String()
+				if g.negated[lit] {
+					value = "-" + value
+				}
+				t.enterDefOf(lit)
+				t.errorf(lit, "the literal %s does not fit into the integers it is used with, which are %s", value, width)
+				break
+			}
+		}
+	}
+	return width
+}
+
+// enterDefOf reports the following problems in the top-level def of node
+func (t *translator) enterDefOf(node quintir.Node) {
+	if def := t.widths.defs[node.QuintID()]; def != nil {
+		t.enter(t.defModules[def.ID], def)
+	}
+}
+
+// fitsWidth checks if the integers of the group can have the width
+func (t *translator) fitsWidth(g *intGroup, width string) bool {
+	if g.signed != nil && !strings.HasPrefix(width, "i") {
+		return false
+	}
+	for _, lit := range g.literals {
+		if !t.fitsLiteral(lit, g.negated[lit], width) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *translator) fitsLiteral(lit *quintir.IntLit, negated bool, width string) bool {
+	min, max := widthRange(width)
+	value := new(big.Int).Set(lit.Value)
+	if negated {
+		value.Neg(value)
+	}
+	return value.Cmp(min) >= 0 && value.Cmp(max) <= 0
+}
+
+// widthOf returns the width of the integers with the given key
+func (t *translator) widthOf(key string) string {
+	if t.widths == nil {
+		return t.intDefault
+	}
+	if g, ok := t.widths.groups[key]; ok {
+		if width := g.root().width; width != "" {
+			return width
+		}
+	}
+	return t.intDefault
+}
+
+// intTypeAt translates the type of a parameter, result or value with the given id, which is an inferred
+// integer if typ is int
+func (t *translator) intTypeAt(typ quintir.Type, id int) Type {
+	if _, ok := typ.(*quintir.IntType); ok && t.bigUint() == "" {
+		return widthType(t.widthOf(idKey(id)))
+	}
+	return t.resolveType(typ)
+}
+
+// fieldIntType returns the inferred type of an integer field of a record
+func (t *translator) fieldIntType(record string, field string) Type {
+	if t.bigUint() != "" {
+		return t.intType()
+	}
+	return widthType(t.widthOf(record + "." + field))
+}
+
+// widthLiteral returns the literal of an integer expression with the inferred width
+func (t *translator) widthLiteral(lit *quintir.IntLit) Expr {
+	if t.bigUint() != "" {
+		return t.intLiteral(lit.Value)
+	}
+	switch width := t.widthOf(idKey(lit.ID)); width {
+	case "i64", "i128":
+		return &SignedLiteral{TypeName: width, Value: lit.Value}
+	case "Uint128":
+		return &BigUintLiteral{TypeName: width, Value: lit.Value}
+	}
+	return &UInt64Literal{Value: lit.Value.Uint64()}
+}
+
+// mixedWidths checks if some integers have another width than the default
+func (t *translator) mixedWidths() bool {
+	if t.widths == nil {
+		return false
+	}
+	for _, g := range t.widths.groups {
+		if w := g.root().width; w != "" && w != t.intDefault {
+			return true
+		}
+	}
+	return false
+}
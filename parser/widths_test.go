@@ -0,0 +1,159 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"piwasm/quintir"
+)
+
+// bigInt parses a decimal integer of any size
+func bigInt(s string) *big.Int {
+	value, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("not an integer: " + s)
+	}
+	return value
+}
+
+func TestWidthRange(t *testing.T) {
+	tests := []struct {
+		width    string
+		min, max string
+	}{
+		{width: "u64", min: "0", max: "18446744073709551615"},
+		{width: "i64", min: "-9223372036854775808", max: "9223372036854775807"},
+		{width: "i128", min: "-170141183460469231731687303715884105728", max: "170141183460469231731687303715884105727"},
+		{width: "Uint128", min: "0", max: "340282366920938463463374607431768211455"},
+	}
+	for _, test := range tests {
+		min, max := widthRange(test.width)
+		if min.Cmp(bigInt(test.min)) != 0 || max.Cmp(bigInt(test.max)) != 0 {
+			t.Errorf("%s: got [%s, %s], want [%s, %s]", test.width, min, max, test.min, test.max)
+		}
+	}
+}
+
+func TestFitsLiteral(t *testing.T) {
+	tests := []struct {
+		value   string
+		negated bool
+		width   string
+		want    bool
+	}{
+		{value: "0", width: "u64", want: true},
+		{value: "18446744073709551615", width: "u64", want: true},
+		{value: "18446744073709551616", width: "u64", want: false},
+		{value: "1", negated: true, width: "u64", want: false},
+		{value: "0", negated: true, width: "u64", want: true},
+		{value: "9223372036854775807", width: "i64", want: true},
+		{value: "9223372036854775808", width: "i64", want: false},
+		{value: "9223372036854775808", negated: true, width: "i64", want: true},
+		{value: "9223372036854775809", negated: true, width: "i64", want: false},
+		{value: "-5", width: "i64", want: true},
+		{value: "-5", negated: true, width: "u64", want: true},
+		{value: "18446744073709551616", width: "i128", want: true},
+		{value: "170141183460469231731687303715884105728", width: "i128", want: false},
+		{value: "170141183460469231731687303715884105728", width: "Uint128", want: true},
+		{value: "340282366920938463463374607431768211456", width: "Uint128", want: false},
+		{value: "3", negated: true, width: "Uint128", want: false},
+	}
+	tr := newTranslator(&quintir.Output{})
+	for _, test := range tests {
+		lit := &quintir.IntLit{Value: bigInt(test.value)}
+		if got := tr.fitsLiteral(lit, test.negated, test.width); got != test.want {
+			t.Errorf("%s (negated: %v) in %s: got %v, want %v", test.value, test.negated, test.width, got, test.want)
+		}
+	}
+}
+
+func TestChooseWidth(t *testing.T) {
+	minus := &quintir.App{ID: 1, Opcode: "iuminus"}
+	collection := &quintir.App{ID: 2, Opcode: "Set"}
+	tests := []struct {
+		name       string
+		intDefault string
+		// the literals of the group, negated if they start with -
+		literals []string
+		signed   bool
+		pinned   bool
+		want     string
+		// a part of the problem that is reported, if any
+		err string
+	}{
+		{name: "no literals", intDefault: "u64", want: "u64"},
+		{name: "small literals", intDefault: "u64", literals: []string{"3", "18446744073709551615"}, want: "u64"},
+		{name: "negative literal", intDefault: "u64", literals: []string{"-1"}, want: "i64"},
+		{name: "signed", intDefault: "u64", signed: true, want: "i64"},
+		{name: "signed default", intDefault: "i64", signed: true, want: "i64"},
+		{name: "too big for i64", intDefault: "u64", literals: []string{"-1", "18446744073709551615"}, want: "i128"},
+		{name: "too big for u64", intDefault: "u64", literals: []string{"18446744073709551616"}, want: "i128"},
+		{name: "too big for i128", intDefault: "u64", literals: []string{"170141183460469231731687303715884105728"}, want: "Uint128"},
+		{name: "default fits", intDefault: "Uint128", literals: []string{"18446744073709551616"}, want: "Uint128"},
+		{name: "wider default first", intDefault: "i128", literals: []string{"5"}, want: "i128"},
+		{name: "pinned", intDefault: "u64", literals: []string{"5"}, pinned: true, want: "u64"},
+		{
+			name:       "pinned and signed",
+			intDefault: "u64",
+			signed:     true,
+			pinned:     true,
+			want:       "u64",
+			err:        "this integer can be negative, but it is also used where the integers are u64, like in a collection (at id 2)",
+		},
+		{name: "pinned and signed default", intDefault: "i64", signed: true, pinned: true, want: "i64"},
+		{
+			name:       "pinned and too big",
+			intDefault: "u64",
+			literals:   []string{"18446744073709551616"},
+			pinned:     true,
+			want:       "u64",
+			err:        "the literal 18446744073709551616 does not fit into the integers it is used with, which are u64",
+		},
+		{
+			name:       "pinned and negative",
+			intDefault: "u64",
+			literals:   []string{"-1"},
+			pinned:     true,
+			want:       "u64",
+			err:        "the literal -1 does not fit into the integers it is used with, which are u64",
+		},
+		{
+			name:       "too big for every width",
+			intDefault: "u64",
+			literals:   []string{"340282366920938463463374607431768211456"},
+			signed:     true,
+			want:       "u64",
+			err:        "the literal 340282366920938463463374607431768211456 does not fit",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tr := newTranslator(&quintir.Output{})
+			tr.intDefault = test.intDefault
+			tr.widths = &intInference{t: tr, groups: make(map[string]*intGroup), defs: make(map[int]*quintir.OpDef)}
+			g := tr.widths.group("x")
+			for _, literal := range test.literals {
+				lit := &quintir.IntLit{Value: bigInt(strings.TrimPrefix(literal, "-"))}
+				g.literals = append(g.literals, lit)
+				g.negated[lit] = strings.HasPrefix(literal, "-")
+			}
+			if test.signed {
+				g.signed = minus
+			}
+			if test.pinned {
+				g.pinned = collection
+			}
+
+			if got := tr.chooseWidth(g); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+			switch {
+			case test.err == "" && len(tr.diagnostics) > 0:
+				t.Errorf("got the problem %q, want none", tr.diagnostics[0].Message)
+			case test.err != "" && (len(tr.diagnostics) != 1 || !strings.Contains(tr.diagnostics[0].Message, test.err)):
+				t.Errorf("got the problems %v, want one containing %q", tr.diagnostics, test.err)
+			}
+		})
+	}
+}